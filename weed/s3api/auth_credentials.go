@@ -1039,13 +1039,18 @@ func (iam *IdentityAccessManagement) GetAccountIdByEmail(email string) string {
 func (iam *IdentityAccessManagement) Auth(f http.HandlerFunc, action Action) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !iam.isEnabled() {
-			f(w, r)
+			if admitAuthenticated(w, r) {
+				f(w, r)
+			}
 			return
 		}
 
-		identity, errCode := iam.authRequest(r, action)
+		identity, errCode, authType := iam.authRequestWithAuthType(r, action)
 		if errCode != s3err.ErrNone {
 			glog.V(3).Infof("auth error: %v", errCode)
+			recordAuthFailure(r, errCode, authType)
+		} else {
+			recordMetricsAuthMode(r, authType)
 		}
 
 		iam.handleAuthResult(w, r, identity, errCode, f)
@@ -1061,7 +1066,9 @@ func (iam *IdentityAccessManagement) Auth(f http.HandlerFunc, action Action) htt
 func (iam *IdentityAccessManagement) AuthPostPolicy(f http.HandlerFunc, action Action) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !iam.isEnabled() {
-			f(w, r)
+			if admitAuthenticated(w, r) {
+				f(w, r)
+			}
 			return
 		}
 
@@ -1084,6 +1091,9 @@ func (iam *IdentityAccessManagement) AuthPostPolicy(f http.HandlerFunc, action A
 
 		if errCode != s3err.ErrNone {
 			glog.V(3).Infof("auth error: %v", errCode)
+			recordAuthFailure(r, errCode, authType)
+		} else {
+			recordMetricsAuthMode(r, authType)
 		}
 
 		iam.handleAuthResult(w, r, identity, errCode, f)
@@ -1099,8 +1109,11 @@ func (iam *IdentityAccessManagement) handleAuthResult(w http.ResponseWriter, r *
 			// This is especially important for JWT users whose identity is not in the identities list
 			ctx = s3_constants.SetIdentityInContext(ctx, identity)
 			r = r.WithContext(ctx)
+			recordMetricsIdentity(r)
+		}
+		if admitAuthenticated(w, r) {
+			f(w, r)
 		}
-		f(w, r)
 		return
 	}
 	s3err.WriteErrorResponse(w, r, errCode)
@@ -100,6 +100,7 @@ func (r *BucketRegistry) LoadBucketMetadata(entry *filer_pb.Entry) {
 	r.metadataCacheLock.Unlock()
 	// Remove from notFound cache since bucket now exists
 	r.unMarkNotFound(entry.Name)
+	bucketAccounts.invalidate(entry.Name)
 }
 
 func buildBucketMetadata(accountManager AccountManager, entry *filer_pb.Entry) *BucketMetaData {
@@ -165,6 +166,7 @@ func (r *BucketRegistry) RemoveBucketMetadata(entry *filer_pb.Entry) {
 	r.removeMetadataCache(entry.Name)
 	r.unMarkNotFound(entry.Name)
 	r.removeTableLocationCache(entry.Name)
+	bucketAccounts.invalidate(entry.Name)
 }
 
 func (r *BucketRegistry) GetBucketMetadata(bucketName string) (*BucketMetaData, s3err.ErrorCode) {
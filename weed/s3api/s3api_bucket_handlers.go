@@ -644,7 +644,9 @@ func (s3a *S3ApiServer) AuthWithPublicRead(handler http.HandlerFunc, action Acti
 			glog.V(4).Infof("AuthWithPublicRead: bucket=%s, isPublicACL=%v", bucket, isPublic)
 			if isPublic {
 				glog.V(3).Infof("AuthWithPublicRead: allowing anonymous access to public-read bucket %s (ACL)", bucket)
-				handler(w, r)
+				if admitAuthenticated(w, r) {
+					handler(w, r)
+				}
 				return
 			}
 
@@ -663,7 +665,9 @@ func (s3a *S3ApiServer) AuthWithPublicRead(handler http.HandlerFunc, action Acti
 				if allowed {
 					// Policy explicitly allows anonymous access
 					glog.V(3).Infof("AuthWithPublicRead: allowing anonymous access to bucket %s (bucket policy)", bucket)
-					handler(w, r)
+					if admitAuthenticated(w, r) {
+						handler(w, r)
+					}
 					return
 				} else {
 					// Policy explicitly denies anonymous access
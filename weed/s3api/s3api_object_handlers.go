@@ -48,9 +48,13 @@ var zeroBuf = make([]byte, 32*1024)
 type countingWriter struct {
 	w       io.Writer
 	written int64
+	// offered counts the bytes handed to Write, whether or not they could
+	// be written.
+	offered int64
 }
 
 func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.offered += int64(len(p))
 	n, err := cw.w.Write(p)
 	cw.written += int64(n)
 	return n, err
@@ -964,19 +968,16 @@ func (s3a *S3ApiServer) streamFromVolumeServers(w http.ResponseWriter, r *http.R
 			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+size-1, totalSize))
 			w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
 			w.WriteHeader(http.StatusPartialContent)
-			written, err := w.Write(entry.Content[start:end])
-			if written > 0 {
-				BucketTrafficSent(int64(written), r)
-			}
+			markCacheHit(w)
+			_, err := w.Write(entry.Content[start:end])
 			return err
 		}
 		// Non-range request for inline content
 		s3a.setResponseHeaders(w, r, entry, totalSize)
 		w.WriteHeader(http.StatusOK)
-		written, err := w.Write(entry.Content)
-		if written > 0 {
-			BucketTrafficSent(int64(written), r)
-		}
+		// Inline content comes with the entry, without a volume server fetch.
+		markCacheHit(w)
+		_, err := w.Write(entry.Content)
 		return err
 	}
 
@@ -1030,7 +1031,9 @@ func (s3a *S3ApiServer) streamFromVolumeServers(w http.ResponseWriter, r *http.R
 
 	// Resolve chunk manifests with the requested range
 	tChunkResolve := time.Now()
+	StartBackendCall(ctx)
 	resolvedChunks, _, err := filer.ResolveChunkManifest(ctx, lookupFileIdFn, chunks, offset, offset+size)
+	EndBackendCall(ctx)
 	chunkResolveTime = time.Since(tChunkResolve)
 	if err != nil {
 		glog.Errorf("streamFromVolumeServers: failed to resolve chunks: %v", err)
@@ -1041,6 +1044,7 @@ func (s3a *S3ApiServer) streamFromVolumeServers(w http.ResponseWriter, r *http.R
 
 	// Prepare streaming function with simple master client wrapper
 	tStreamPrep := time.Now()
+	StartBackendCall(ctx)
 	// Use filerClient directly (not wrapped) so it can support cache invalidation
 	streamFn, err := filer.PrepareStreamContentWithThrottler(
 		ctx,
@@ -1051,6 +1055,7 @@ func (s3a *S3ApiServer) streamFromVolumeServers(w http.ResponseWriter, r *http.R
 		size,
 		0, // no throttling
 	)
+	EndBackendCall(ctx)
 	streamPrepTime = time.Since(tStreamPrep)
 	if err != nil {
 		glog.Errorf("streamFromVolumeServers: failed to prepare stream: %v", err)
@@ -1088,10 +1093,8 @@ func (s3a *S3ApiServer) streamFromVolumeServers(w http.ResponseWriter, r *http.R
 	cw := &countingWriter{w: w}
 	err = streamFn(cw)
 	streamExecTime = time.Since(tStreamExec)
-	// Track traffic even on partial writes for accurate egress accounting
-	if cw.written > 0 {
-		BucketTrafficSent(cw.written, r)
-	}
+	// Everything streamFn wrote was fetched from the volume servers.
+	recordBackendBytes(w, cw.offered)
 	if err != nil {
 		glog.Errorf("streamFromVolumeServers: streamFn failed after writing %d bytes: %v", cw.written, err)
 		// Streaming error after WriteHeader was called - response already partially written
@@ -1238,13 +1241,9 @@ func (s3a *S3ApiServer) streamFromVolumeServersWithSSE(w http.ResponseWriter, r
 	if isRangeRequest {
 		glog.V(2).Infof("Using range-aware SSE decryption for offset=%d size=%d", offset, size)
 		streamFetchTime = 0 // No full stream fetch in range-aware path
-		written, err := s3a.streamDecryptedRangeFromChunks(r.Context(), w, entry, offset, size, sseType, decryptionKey)
+		_, err := s3a.streamDecryptedRangeFromChunks(r.Context(), w, entry, offset, size, sseType, decryptionKey)
 		decryptSetupTime = time.Since(tDecryptSetup)
 		copyTime = decryptSetupTime // Streaming is included in decrypt setup for range-aware path
-		// Track traffic even on partial writes for accurate egress accounting
-		if written > 0 {
-			BucketTrafficSent(written, r)
-		}
 		if err != nil {
 			// Error after WriteHeader - response already written
 			return newStreamErrorWithResponse(err)
@@ -1391,10 +1390,6 @@ func (s3a *S3ApiServer) streamFromVolumeServersWithSSE(w http.ResponseWriter, r
 	buf := make([]byte, 128*1024)
 	copied, copyErr := io.CopyBuffer(w, decryptedReader, buf)
 	copyTime = time.Since(tCopy)
-	// Track traffic even on partial writes for accurate egress accounting
-	if copied > 0 {
-		BucketTrafficSent(copied, r)
-	}
 	if copyErr != nil {
 		glog.Errorf("Failed to copy full object: copied %d bytes: %v", copied, copyErr)
 		// Error after WriteHeader - response already written
@@ -193,12 +193,14 @@ func (s3a *S3ApiServer) DeleteMultipleObjectsHandler(w http.ResponseWriter, r *h
 
 	deleteXMLBytes, err := io.ReadAll(r.Body)
 	if err != nil {
+		recordRequestWeightError(r, "read")
 		s3err.WriteErrorResponse(w, r, s3err.ErrInternalError)
 		return
 	}
 
 	deleteObjects := &DeleteObjectsRequest{}
 	if err := xml.Unmarshal(deleteXMLBytes, deleteObjects); err != nil {
+		recordRequestWeightError(r, "malformed")
 		s3err.WriteErrorResponse(w, r, s3err.ErrMalformedXML)
 		return
 	}
@@ -207,6 +209,8 @@ func (s3a *S3ApiServer) DeleteMultipleObjectsHandler(w http.ResponseWriter, r *h
 		s3err.WriteErrorResponse(w, r, s3err.ErrInvalidMaxDeleteObjects)
 		return
 	}
+	// Every key is billed as a write of its own.
+	recordRequestWeight(r, len(deleteObjects.Objects), deleteMultipleObjectsLimit)
 
 	var deletedObjects []ObjectIdentifier
 	var deleteErrors []DeleteError
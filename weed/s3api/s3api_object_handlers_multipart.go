@@ -116,6 +116,7 @@ func (s3a *S3ApiServer) NewMultipartUploadHandler(w http.ResponseWriter, r *http
 	}
 
 	writeSuccessResponseXML(w, r, response)
+	MultipartUploadCreated(aws.StringValue(response.UploadId))
 
 }
 
@@ -137,9 +138,12 @@ func (s3a *S3ApiServer) CompleteMultipartUploadHandler(w http.ResponseWriter, r
 
 	parts := &CompleteMultipartUpload{}
 	if err := xmlDecoder(r.Body, parts, r.ContentLength); err != nil {
+		recordRequestWeightError(r, "malformed")
 		s3err.WriteErrorResponse(w, r, s3err.ErrMalformedXML)
 		return
 	}
+	// Every part is billed as a write of its own.
+	recordRequestWeight(r, len(parts.Parts), s3_constants.MaxS3MultipartParts)
 
 	// Get upload id.
 	uploadID, _, _, _ := getObjectResources(r.URL.Query())
@@ -28,6 +28,10 @@ func (s3a *S3ApiServer) PostPolicyBucketHandler(w http.ResponseWriter, r *http.R
 
 	glog.V(3).Infof("PostPolicyBucketHandler %s", bucket)
 
+	// The form is read before the signature in it can be verified, that is
+	// before track admits the request and counts its body.
+	body := &countingBody{ReadCloser: r.Body}
+	r.Body = body
 	reader, err := r.MultipartReader()
 	if err != nil {
 		s3err.WriteErrorResponse(w, r, s3err.ErrMalformedPOSTRequest)
@@ -79,6 +83,11 @@ func (s3a *S3ApiServer) PostPolicyBucketHandler(w http.ResponseWriter, r *http.R
 		s3err.WriteErrorResponse(w, r, errCode)
 		return
 	}
+	// AuthPostPolicy delegates authentication of anonymous form uploads.
+	if !admitAuthenticated(w, r) {
+		return
+	}
+	recordReceivedBytes(r, body.bytesRead())
 
 	policyBytes, err := base64.StdEncoding.DecodeString(formValues.Get("Policy"))
 	if err != nil {
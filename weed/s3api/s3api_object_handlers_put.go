@@ -283,6 +283,8 @@ func (s3a *S3ApiServer) PutObjectHandler(w http.ResponseWriter, r *http.Request)
 }
 
 func (s3a *S3ApiServer) putToFiler(r *http.Request, filePath string, dataReader io.Reader, bucket string, partNumber int) (etag string, code s3err.ErrorCode, sseMetadata SSEResponseMetadata) {
+	start := time.Now()
+
 	// NEW OPTIMIZATION: Write directly to volume servers, bypassing filer proxy
 	// This eliminates the filer proxy overhead for PUT operations
 	// Note: filePath is now passed directly instead of URL (no parsing needed)
@@ -678,7 +680,8 @@ func (s3a *S3ApiServer) putToFiler(r *http.Request, filePath string, dataReader
 	glog.V(2).Infof("putToFiler: Metadata saved SUCCESS - path=%s, etag(hex)=%s, size=%d, partNumber=%d",
 		filePath, etag, entry.Attributes.FileSize, partNumber)
 
-	BucketTrafficReceived(chunkResult.TotalSize, r)
+	ObjectUploaded(chunkResult.TotalSize, r)
+	UploadCompletionTime(r.Method, start, chunkResult.TotalSize, r)
 
 	// Build SSE response metadata with encryption details
 	responseMetadata := SSEResponseMetadata{
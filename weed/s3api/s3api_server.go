@@ -28,10 +28,12 @@ import (
 	. "github.com/seaweedfs/seaweedfs/weed/s3api/s3_constants"
 	"github.com/seaweedfs/seaweedfs/weed/s3api/s3err"
 	"github.com/seaweedfs/seaweedfs/weed/security"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
 	"github.com/seaweedfs/seaweedfs/weed/util"
 	"github.com/seaweedfs/seaweedfs/weed/util/grace"
 	util_http "github.com/seaweedfs/seaweedfs/weed/util/http"
 	util_http_client "github.com/seaweedfs/seaweedfs/weed/util/http/client"
+	"github.com/seaweedfs/seaweedfs/weed/util/version"
 	"github.com/seaweedfs/seaweedfs/weed/wdclient"
 )
 
@@ -227,7 +229,20 @@ func NewS3ApiServerWithStore(router *mux.Router, option *S3ApiServerOption, expl
 			}
 		})
 	}
+	grace.OnReload(ReloadInternalCIDRs)
+	grace.OnReload(ReloadBlockedCIDRs)
+	grace.OnReload(ReloadBucketAllowCIDRs)
+	grace.OnReload(ReloadClientGroups)
+	WatchInternalCIDRsFile()
+	warnTrustedProxyConfig()
+	warnInternalHeaderConfig()
+	registerStatusHandlers()
+	stats_collect.SetS3BuildInfo(version.VERSION, version.COMMIT)
+	startBillingEmitter()
+	startOtelTracing()
+	stats_collect.SetActiveBucketsWindow(time.Duration(envInt("S3_ACTIVE_BUCKETS_WINDOW", 300)) * time.Second)
 	s3ApiServer.bucketRegistry = NewBucketRegistry(s3ApiServer)
+	bucketAccounts.setResolver(s3ApiServer.bucketRegistry.bucketOwner)
 	if option.LocalFilerSocket == "" {
 		if s3ApiServer.client, err = util_http.NewGlobalHttpClient(); err != nil {
 			return nil, err
@@ -427,6 +442,7 @@ func (s3a *S3ApiServer) handleCORSOriginValidation(w http.ResponseWriter, r *htt
 func (s3a *S3ApiServer) registerRouter(router *mux.Router) {
 	// API Router
 	apiRouter := router.PathPrefix("/").Subrouter()
+	apiRouter.Use(clientIPMiddleware)
 
 	// S3 Tables API endpoint
 	// POST / with X-Amz-Target: S3Tables.<OperationName>
@@ -40,6 +40,12 @@ func WriteEmptyResponse(w http.ResponseWriter, r *http.Request, statusCode int)
 	PostLog(r, statusCode, ErrNone)
 }
 
+// ErrorCodeRecorder is implemented by response writers that keep track of the
+// S3 error code written through them, such as the metrics status recorder.
+type ErrorCodeRecorder interface {
+	RecordErrorCode(code string)
+}
+
 func WriteErrorResponse(w http.ResponseWriter, r *http.Request, errorCode ErrorCode) {
 	vars := mux.Vars(r)
 	bucket := vars["bucket"]
@@ -50,6 +56,9 @@ func WriteErrorResponse(w http.ResponseWriter, r *http.Request, errorCode ErrorC
 
 	apiError := GetAPIError(errorCode)
 	errorResponse := getRESTErrorResponse(apiError, r.URL.Path, bucket, object)
+	if recorder, ok := w.(ErrorCodeRecorder); ok {
+		recorder.RecordErrorCode(apiError.Code)
+	}
 	WriteXMLResponse(w, r, apiError.HTTPStatusCode, errorResponse)
 	PostLog(r, apiError.HTTPStatusCode, errorCode)
 }
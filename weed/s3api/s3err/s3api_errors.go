@@ -142,6 +142,20 @@ const (
 	// Bucket encryption errors
 	ErrNoSuchBucketEncryptionConfiguration
 	ErrInvalidStorageClass
+
+	// ErrSlowDown rejects requests over a rate, quota or concurrency limit
+	// of the gateway.
+	ErrSlowDown
+
+	// ErrServiceUnavailable rejects requests to a bucket while its backend
+	// error circuit breaker is open.
+	ErrServiceUnavailable
+
+	// ErrRequestEntityTooLarge rejects a request whose Content-Length exceeds
+	// S3_MAX_OBJECT_SIZE before its body is read. It has the code of
+	// ErrEntityTooLarge, which is sent with 400 once an upload turns out too
+	// large, but answers 413 since the request is refused from its headers.
+	ErrRequestEntityTooLarge
 )
 
 // Error message constants for checksum validation
@@ -594,6 +608,22 @@ var errorCodeResponse = map[ErrorCode]APIError{
 		Description:    "The storage class you specified is not valid",
 		HTTPStatusCode: http.StatusBadRequest,
 	},
+
+	ErrSlowDown: {
+		Code:           "SlowDown",
+		Description:    "Please reduce your request rate.",
+		HTTPStatusCode: http.StatusServiceUnavailable,
+	},
+	ErrServiceUnavailable: {
+		Code:           "ServiceUnavailable",
+		Description:    "Service is unable to handle request.",
+		HTTPStatusCode: http.StatusServiceUnavailable,
+	},
+	ErrRequestEntityTooLarge: {
+		Code:           "EntityTooLarge",
+		Description:    "Your proposed upload exceeds the maximum allowed object size.",
+		HTTPStatusCode: http.StatusRequestEntityTooLarge,
+	},
 }
 
 // GetAPIError provides API Error for input API error code.
@@ -8,43 +8,380 @@ import (
 	"github.com/seaweedfs/seaweedfs/weed/util/version"
 
 	"github.com/seaweedfs/seaweedfs/weed/s3api/s3_constants"
+	"github.com/seaweedfs/seaweedfs/weed/s3api/s3err"
 	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
 )
 
+// blankBucketOnForbidden records denied requests without their bucket, so
+// that the metrics do not reveal which bucket names were probed. Disabling it
+// keeps the bucket on every metric recorded for a 403 response.
+var blankBucketOnForbidden = envBool("S3_METRICS_BLANK_BUCKET_ON_FORBIDDEN", true)
+
+// slowRequestThreshold is the duration beyond which a request is counted in
+// S3SlowRequestCounter. Zero, the default, disables the counter.
+var slowRequestThreshold = envDuration("S3_SLOW_REQUEST_THRESHOLD", 0)
+
 func track(f http.HandlerFunc, action string) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+	// Normalized once per route, as the label of every metric below.
+	action = normalizeAction(action)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		entered := time.Now()
 		inFlightGauge := stats_collect.S3InFlightRequestsGauge.WithLabelValues(action)
 		inFlightGauge.Inc()
 		defer inFlightGauge.Dec()
+		defer enterSaturation()()
+
+		// Resolved once per request, as the input of the classifier and of
+		// every per-action counter below.
+		s3Action := requestS3Action(r)
+		class := classifyRequest(s3Action, r)
+		inFlightClassGauge := stats_collect.S3InFlightByClass.WithLabelValues(class.String())
+		inFlightClassGauge.Inc()
+		defer inFlightClassGauge.Dec()
 
-		bucket, _ := s3_constants.GetBucketAndObject(r)
+		bucket, object := s3_constants.GetBucketAndObject(r)
 		w.Header().Set("Server", "SeaweedFS "+version.VERSION)
+		if debugClientIP {
+			setDebugClientIPHeader(w, r)
+		}
+		if isDisallowedMethod(r.Method) {
+			stats_collect.S3DisallowedMethodCounter.WithLabelValues(r.Method).Inc()
+			reject(w, r, action, bucket, s3err.ErrMethodNotAllowed)
+			return
+		}
+		if prefix, blocked := blockedClient(r); blocked {
+			stats_collect.S3BlockedRequestCounter.WithLabelValues(prefix.String()).Inc()
+			reject(w, r, action, bucket, s3err.ErrAccessDenied)
+			return
+		}
+		if bucketIPDenied(r, bucket) {
+			stats_collect.S3BucketIPDeniedCounter.WithLabelValues(bucket).Inc()
+			reject(w, r, action, bucket, s3err.ErrAccessDenied)
+			return
+		}
+		if oversizedRequest(r) {
+			stats_collect.S3OversizedRequestCounter.WithLabelValues(bucket).Inc()
+			reject(w, r, action, bucket, s3err.ErrRequestEntityTooLarge)
+			return
+		}
+		now := time.Now()
+		if prefix, rejected := clientRateLimits.rejected(r, now); rejected {
+			stats_collect.S3ClientRateLimitedCounter.WithLabelValues(clientNetworkLabel(prefix)).Inc()
+			setRetryAfter(w, clientRateLimits.retryAfter(prefix, now))
+			reject(w, r, action, bucket, s3err.ErrSlowDown)
+			return
+		}
+		// The limits of the bucket are only charged once the auth wrapper
+		// inside f has authenticated the request; see admitAuthenticated.
+		r, gate := withAdmission(r, action, bucket)
+		// Deferred so that the slot is given back even if the handler panics,
+		// which counts as a backend error.
+		breakerStatus := http.StatusInternalServerError
+		defer func() { gate.done(breakerStatus) }()
 		recorder := stats_collect.NewStatusResponseWriter(w)
+		r, identity := withMetricsIdentity(r)
+		r, weight := withRequestWeight(r, action)
+		r, backend := withBackendTiming(r)
 		start := time.Now()
 		f(recorder, r)
-		if recorder.Status == http.StatusForbidden {
+		breakerStatus = recorder.Status
+		if gate.rejected {
+			// Counted by reject already, and never billed.
+			return
+		}
+		if blankBucketOnForbidden && recorder.Status == http.StatusForbidden {
 			bucket = ""
 		}
-		stats_collect.S3RequestHistogram.WithLabelValues(action, bucket).Observe(time.Since(start).Seconds())
-		stats_collect.S3RequestCounter.WithLabelValues(action, strconv.Itoa(recorder.Status), bucket).Inc()
+		// Time spent before the handler ran, mostly waiting for a
+		// concurrency slot.
+		stats_collect.S3QueueWaitHistogram.WithLabelValues(bucket).Observe((start.Sub(entered) + gate.waited).Seconds())
+		if slowRequestThreshold > 0 && time.Since(start) > slowRequestThreshold {
+			stats_collect.S3SlowRequestCounter.WithLabelValues(action, bucket).Inc()
+		}
+		if sampleHistogram() {
+			end := time.Now()
+			elapsed := end.Sub(start).Seconds()
+			stats_collect.S3RequestHistogram.WithLabelValues(action, bucket).Observe(elapsed)
+			stats_collect.S3RequestHistogramByOrigin.WithLabelValues(action, bucket, clientOrigin(r)).Observe(elapsed)
+			observeProcessingAndTransfer(action, bucket, start, end, recorder)
+			if elapsed, ok := backend.elapsed(end); ok {
+				stats_collect.S3BackendLatencyHistogram.WithLabelValues(action).Observe(elapsed.Seconds())
+			}
+		}
+		accessKey := identity.accessKeyLabel()
+		stats_collect.S3RequestCounter.WithLabelValues(action, strconv.Itoa(recorder.Status), bucket, accessKey).Inc()
+		bucketRequestWindow.add(bucket)
+		client, internal := requestClientIP(r)
+		if internal {
+			stats_collect.S3InternalRequestCounter.WithLabelValues(bucket).Inc()
+		} else {
+			stats_collect.S3ExternalRequestCounter.WithLabelValues(bucket).Inc()
+		}
+		if hasClientGroups() {
+			stats_collect.S3ClientGroupRequestCounter.WithLabelValues(bucket, clientGroup(client)).Inc()
+		}
+		stats_collect.S3StatusClassCounter.WithLabelValues(bucket, statusClass(recorder.Status)).Inc()
+		// 304 Not Modified is a cache validation, not a redirect.
+		if recorder.Status/100 == 3 && recorder.Status != http.StatusNotModified {
+			stats_collect.S3RedirectCounter.WithLabelValues(bucket, strconv.Itoa(recorder.Status)).Inc()
+		}
+		if recorder.Status >= http.StatusInternalServerError {
+			stats_collect.S3BucketLastErrorTime.WithLabelValues(bucket).SetToCurrentTime()
+		}
+		stats_collect.RecordS3Operation(action, bucket, recorder.Status)
+		stats_collect.S3AuthModeCounter.WithLabelValues(bucket, identity.authModeLabel()).Inc()
+		trackConditionalRead(r, recorder.Status, bucket)
+		if attempt := retryAttemptLabel(r); attempt != "" {
+			stats_collect.S3RetryAttemptCounter.WithLabelValues(bucket, attempt).Inc()
+		}
+		if isPresigned(r) {
+			stats_collect.S3PresignedCounter.WithLabelValues(bucket, r.Method).Inc()
+		}
+		if isSigV2(r) {
+			stats_collect.S3SigV2Counter.WithLabelValues(bucket).Inc()
+		}
+		if isChunkedUpload(r) {
+			stats_collect.S3ChunkedUploadCounter.WithLabelValues(bucket).Inc()
+		}
+		if bucket != "" {
+			stats_collect.S3AddressingStyleCounter.WithLabelValues(bucket, addressingStyle(r)).Inc()
+		}
+		trackTLS(r, bucket)
+		stats_collect.S3ProtocolCounter.WithLabelValues(bucket, protocolLabel(r)).Inc()
+		if recorder.ErrorCode != "" && recorder.Status/100 != 2 {
+			stats_collect.S3ErrorCodeCounter.WithLabelValues(action, bucket, recorder.ErrorCode).Inc()
+		}
+		// Requests that fail authentication are counted, but never billed.
+		if !isAuthFailure(recorder.Status) {
+			billRequest(class, r, bucket, object, accessKey, weight.units)
+			if received := gate.bytesReceived(); received > 0 {
+				BucketTrafficReceived(received, r)
+				stats_collect.S3RequestBytesHistogram.WithLabelValues(bucket).Observe(float64(received))
+			}
+			// A 304 has no body; whatever a handler wrote anyway never
+			// reached the client as content and is not egress.
+			if recorder.BytesWritten > 0 && recorder.Status != http.StatusNotModified {
+				// Only object content is split into cache hits and misses.
+				if isObjectBodyRead(s3Action, r) {
+					BucketTrafficSentWithCacheStatus(recorder.BytesWritten, r, recorder.CacheHit)
+				} else {
+					bucketTrafficSent(recorder.BytesWritten, r)
+				}
+				stats_collect.S3ResponseBytesHistogram.WithLabelValues(bucket).Observe(float64(recorder.BytesWritten))
+			}
+		}
+		trackAbortedTransfer(r, recorder, bucket)
+		trackMultipartUpload(s3Action, r, recorder.Status, bucket)
+		trackObjectRead(s3Action, r, recorder.Status, bucket, recorder.BytesWritten)
+		if hasUntrustedForwardingHeader(r) {
+			stats_collect.S3UntrustedForwardedHeaderCounter.WithLabelValues(bucket).Inc()
+		}
 		stats_collect.RecordBucketActiveTime(bucket)
+		if accessLog != nil {
+			accessLog.log(newAccessLogEntry(r, action, class, bucket, object, accessKey, recorder.Status,
+				gate.bytesReceived(), recorder.BytesWritten, start, time.Now(), recorder.FirstWrite))
+		}
+	}
+	if otelEnabled {
+		return traceRequest(handler, action)
+	}
+	return handler
+}
+
+// observeProcessingAndTransfer splits the latency of a request into the time
+// the server took to produce the first body byte and the time spent writing
+// the body, which mostly depends on how fast the client reads it.
+func observeProcessingAndTransfer(action, bucket string, start, end time.Time, recorder *stats_collect.StatusRecorder) {
+	if recorder.FirstWrite.IsZero() {
+		stats_collect.S3ProcessingTimeHistogram.WithLabelValues(action, bucket).Observe(end.Sub(start).Seconds())
+		return
+	}
+	stats_collect.S3ProcessingTimeHistogram.WithLabelValues(action, bucket).Observe(recorder.FirstWrite.Sub(start).Seconds())
+	stats_collect.S3TransferTimeHistogram.WithLabelValues(action, bucket).Observe(recorder.LastWrite.Sub(recorder.FirstWrite).Seconds())
+}
+
+// billRequest adds weight to the billing counter of the request's class.
+// Reads and writes may stand for several billed units; the other classes,
+// like S3RequestCounter, count HTTP requests.
+func billRequest(class rwClass, r *http.Request, bucket, object, accessKey string, weight int) {
+	switch class {
+	case rwRead:
+		billRead(newBillingRecord(bucket, object, accessKey), int64(weight))
+	case rwWrite:
+		record := newBillingRecord(bucket, object, accessKey)
+		record.StorageClass = storageClassLabel(r)
+		billWrite(record, int64(weight))
+		if billConditionalWriteAsRead && isConditional(r) {
+			record.StorageClass = ""
+			billRead(record, 1)
+		}
+	case rwList:
+		stats_collect.S3ListCounter.WithLabelValues(bucket).Inc()
+	case rwHead:
+		stats_collect.S3HeadCounter.WithLabelValues(bucket).Inc()
+	case rwPreflight:
+		stats_collect.S3CorsPreflightCounter.WithLabelValues(bucket).Inc()
+	case rwMetadata:
+		stats_collect.S3MetadataOpCounter.WithLabelValues(bucket, r.Method).Inc()
+	case rwOther:
+		// Upgrades are long-lived connections, counted apart so that they
+		// do not distort the request rates.
+		if isUpgradeRequest(r) {
+			stats_collect.S3UpgradeRequestCounter.WithLabelValues(bucket).Inc()
+		} else {
+			stats_collect.S3OtherCounter.WithLabelValues(bucket).Inc()
+		}
+	default:
+		if name, ok := customClassName(class); ok {
+			stats_collect.S3CustomClassCounter.WithLabelValues(bucket, name).Inc()
+		} else {
+			stats_collect.S3OtherCounter.WithLabelValues(bucket).Inc()
+		}
 	}
 }
 
+// isAuthFailure reports whether status means the request was not authorized.
+func isAuthFailure(status int) bool {
+	return status == http.StatusUnauthorized || status == http.StatusForbidden
+}
+
+// TimeToFirstByte records the time from start to the first byte of the
+// response. A zero start is a caller that never captured it; it is counted
+// instead of observed, so it cannot skew the histogram.
 func TimeToFirstByte(action string, start time.Time, r *http.Request) {
+	if start.IsZero() {
+		stats_collect.S3TTFBMissingStartCounter.WithLabelValues(action).Inc()
+		return
+	}
 	bucket, _ := s3_constants.GetBucketAndObject(r)
-	stats_collect.S3TimeToFirstByteHistogram.WithLabelValues(action, bucket).Observe(float64(time.Since(start).Milliseconds()))
+	stats_collect.S3TimeToFirstByteHistogram.WithLabelValues(action, bucket).Observe(float64(time.Since(start)) / float64(time.Millisecond))
 	stats_collect.RecordBucketActiveTime(bucket)
 }
 
+// UploadCompletionTime records how long an upload of bytes took to be stored
+// since start, and its throughput. Empty uploads have no throughput.
+func UploadCompletionTime(action string, start time.Time, bytes int64, r *http.Request) {
+	bucket, _ := s3_constants.GetBucketAndObject(r)
+	elapsed := time.Since(start).Seconds()
+	stats_collect.S3UploadCompletionHistogram.WithLabelValues(action, bucket).Observe(elapsed)
+	if bytes > 0 && elapsed > 0 {
+		stats_collect.S3UploadThroughputHistogram.WithLabelValues(action, bucket).Observe(float64(bytes) / elapsed)
+	}
+	stats_collect.RecordBucketActiveTime(bucket)
+}
+
+// BucketTrafficReceived records bytes received from the client. Handlers
+// wrapped by track need not call it: track records every request body byte
+// the handler has read.
 func BucketTrafficReceived(bytesReceived int64, r *http.Request) {
 	bucket, _ := s3_constants.GetBucketAndObject(r)
 	stats_collect.RecordBucketActiveTime(bucket)
-	stats_collect.S3BucketTrafficReceivedBytesCounter.WithLabelValues(bucket).Add(float64(bytesReceived))
+	bucketQuotas.addReceived(bucket, bytesReceived)
+	billBytesReceived(BillingRecord{Bucket: bucket, Account: bucketAccountLabel(bucket)}, bytesReceived)
+	if _, internal := requestClientIP(r); !internal {
+		stats_collect.S3BucketExternalReceivedBytesCounter.WithLabelValues(bucket).Add(float64(bytesReceived))
+	}
 }
 
+// ObjectUploaded records the size of an object or part stored by an upload.
+func ObjectUploaded(size int64, r *http.Request) {
+	bucket, _ := s3_constants.GetBucketAndObject(r)
+	stats_collect.S3ObjectSizeHistogram.WithLabelValues(bucket, "write").Observe(float64(size))
+}
+
+// BucketTrafficSent records bytes sent to the client that had to be fetched
+// from volume servers. Use BucketTrafficSentWithCacheStatus when the bytes
+// may have been served without that fetch. Handlers wrapped by track need not
+// call either: track records every response body it has seen written.
 func BucketTrafficSent(bytesTransferred int64, r *http.Request) {
+	BucketTrafficSentWithCacheStatus(bytesTransferred, r, false)
+}
+
+// BucketTrafficSentWithCacheStatus records bytes sent to the client, counting
+// them as cache hits when they were served without a volume server fetch.
+func BucketTrafficSentWithCacheStatus(bytesTransferred int64, r *http.Request, cacheHit bool) {
+	bucket, _ := s3_constants.GetBucketAndObject(r)
+	if cacheHit {
+		stats_collect.S3CacheHitBytesCounter.WithLabelValues(bucket).Add(float64(bytesTransferred))
+	} else {
+		stats_collect.S3CacheMissBytesCounter.WithLabelValues(bucket).Add(float64(bytesTransferred))
+	}
+	bucketTrafficSent(bytesTransferred, r)
+}
+
+// bucketTrafficSent records bytes sent to the client that are not object
+// content, such as listings and error bodies, which have no cache status.
+func bucketTrafficSent(bytesTransferred int64, r *http.Request) {
 	bucket, _ := s3_constants.GetBucketAndObject(r)
+	bucketEgressRates.add(bucket, bytesTransferred)
+	bucketQuotas.addSent(bucket, bytesTransferred)
 	stats_collect.RecordBucketActiveTime(bucket)
-	stats_collect.S3BucketTrafficSentBytesCounter.WithLabelValues(bucket).Add(float64(bytesTransferred))
+	billBytesSent(BillingRecord{Bucket: bucket, Account: bucketAccountLabel(bucket)}, bytesTransferred)
+	clientIP, network := requestClientNetwork(r)
+	switch network {
+	case networkInternal:
+		stats_collect.S3BucketInternalSentBytesCounter.WithLabelValues(bucket).Add(float64(bytesTransferred))
+	case networkSemi:
+		stats_collect.S3BucketSemiInternalSentBytesCounter.WithLabelValues(bucket).Add(float64(bytesTransferred))
+	default:
+		stats_collect.S3BucketExternalSentBytesCounter.WithLabelValues(bucket).Add(float64(bytesTransferred))
+		recordExternalEgressCountry(bytesTransferred, clientIP)
+	}
+	recordClientEgress(bytesTransferred, clientIP)
+}
+
+// isObjectBodyRead reports whether the response body of r, whose S3 action is
+// s3Action, is object content served by the object GET and HEAD handlers, as
+// opposed to a listing, an error or any other XML reply.
+func isObjectBodyRead(s3Action string, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	switch s3Action {
+	case s3_constants.S3_ACTION_GET_OBJECT, s3_constants.S3_ACTION_GET_OBJECT_VERSION:
+		return true
+	}
+	return false
+}
+
+// markCacheHit records that the response body written to w was served
+// without a volume server fetch.
+func markCacheHit(w http.ResponseWriter) {
+	if recorder := statusRecorderOf(w); recorder != nil {
+		recorder.CacheHit = true
+	}
+}
+
+// statusRecorderOf returns the StatusRecorder w is or wraps, or nil when
+// the request is not tracked.
+func statusRecorderOf(w http.ResponseWriter) *stats_collect.StatusRecorder {
+	for {
+		switch rw := w.(type) {
+		case *stats_collect.StatusRecorder:
+			return rw
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// reject answers r with code before it reaches its handler. The rejection is
+// counted in S3RequestCounter and S3StatusClassCounter like a handled request,
+// so that the request rate and error ratio include it.
+func reject(w http.ResponseWriter, r *http.Request, action, bucket string, code s3err.ErrorCode) {
+	s3err.WriteErrorResponse(w, r, code)
+	status := s3err.GetAPIError(code).HTTPStatusCode
+	if blankBucketOnForbidden && status == http.StatusForbidden {
+		bucket = ""
+	}
+	m, _ := r.Context().Value(metricsIdentityKey{}).(*metricsIdentity)
+	stats_collect.S3RequestCounter.WithLabelValues(action, strconv.Itoa(status), bucket, m.accessKeyLabel()).Inc()
+	stats_collect.S3StatusClassCounter.WithLabelValues(bucket, statusClass(status)).Inc()
+}
+
+// statusClass returns the first digit of an HTTP status code, "2" for 2xx.
+func statusClass(status int) string {
+	return strconv.Itoa(status / 100)
 }
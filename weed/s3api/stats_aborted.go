@@ -0,0 +1,27 @@
+package s3api
+
+import (
+	"net/http"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// recordBackendBytes adds n to the bytes fetched from the volume servers for
+// the response written to w.
+func recordBackendBytes(w http.ResponseWriter, n int64) {
+	if recorder := statusRecorderOf(w); recorder != nil {
+		recorder.BackendBytes += n
+	}
+}
+
+// trackAbortedTransfer counts the body bytes that were fetched for r but not
+// delivered because the client disconnected, noticed either as a failed
+// write or as the cancelled request context.
+func trackAbortedTransfer(r *http.Request, recorder *stats_collect.StatusRecorder, bucket string) {
+	if !recorder.WriteFailed && r.Context().Err() == nil {
+		return
+	}
+	if discarded := recorder.BackendBytes - recorder.BytesWritten; discarded > 0 {
+		stats_collect.S3AbortedTransferBytes.WithLabelValues(bucket).Add(float64(discarded))
+	}
+}
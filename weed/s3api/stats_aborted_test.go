@@ -0,0 +1,81 @@
+package s3api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// disconnectingWriter accepts limit body bytes and then fails like the
+// connection of a client that went away.
+type disconnectingWriter struct {
+	*httptest.ResponseRecorder
+	limit int
+}
+
+func (w *disconnectingWriter) Write(b []byte) (int, error) {
+	if len(b) > w.limit {
+		n, _ := w.ResponseRecorder.Write(b[:w.limit])
+		w.limit = 0
+		return n, errors.New("broken pipe")
+	}
+	w.limit -= len(b)
+	return w.ResponseRecorder.Write(b)
+}
+
+// streamingHandler fetches chunks of size bytes and writes them until a
+// write fails, the way streamFromVolumeServers does.
+func streamingHandler(chunks, size int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cw := &countingWriter{w: w}
+		chunk := make([]byte, size)
+		for i := 0; i < chunks && r.Context().Err() == nil; i++ {
+			if _, err := cw.Write(chunk); err != nil {
+				break
+			}
+		}
+		recordBackendBytes(w, cw.offered)
+	}
+}
+
+func TestTrackCountsAbortedTransferBytes(t *testing.T) {
+	const bucket = "stats-aborted"
+	aborted := stats_collect.S3AbortedTransferBytes.WithLabelValues(bucket)
+
+	// The client reads 250 bytes, the rest of the third chunk is discarded.
+	w := &disconnectingWriter{ResponseRecorder: httptest.NewRecorder(), limit: 250}
+	track(streamingHandler(4, 100), "GET")(w, newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	if got := testutil.ToFloat64(aborted); got != 50 {
+		t.Errorf("aborted bytes = %v, want 50", got)
+	}
+
+	// Completed downloads discard nothing.
+	track(streamingHandler(4, 100), "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	if got := testutil.ToFloat64(aborted); got != 50 {
+		t.Errorf("aborted bytes after a completed download = %v, want 50", got)
+	}
+}
+
+func TestTrackCountsBytesFetchedAfterCancellation(t *testing.T) {
+	const bucket = "stats-aborted-cancel"
+	r := newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234")
+	ctx, cancel := context.WithCancel(r.Context())
+	r = r.WithContext(ctx)
+	// The client disconnects while a fetched chunk waits to be written.
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 100))
+		recordBackendBytes(w, 100)
+		cancel()
+		recordBackendBytes(w, 100)
+	}
+	track(handler, "GET")(httptest.NewRecorder(), r)
+	if got := testutil.ToFloat64(stats_collect.S3AbortedTransferBytes.WithLabelValues(bucket)); got != 100 {
+		t.Errorf("aborted bytes = %v, want 100", got)
+	}
+}
@@ -0,0 +1,102 @@
+package s3api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/seaweedfs/seaweedfs/weed/s3api/s3_constants"
+	"github.com/seaweedfs/seaweedfs/weed/s3api/s3err"
+)
+
+// metricsIncludeAccessKey adds the authenticated access key as a label to the
+// request and billing counters. It is off by default because every access key
+// becomes its own time series.
+var metricsIncludeAccessKey = envBool("S3_METRICS_INCLUDE_ACCESS_KEY", false)
+
+// noAccessKey labels requests while the access key label is disabled.
+const noAccessKey = "-"
+
+// anonymousAccessKey labels requests without an authenticated access key.
+const anonymousAccessKey = "anonymous"
+
+type metricsIdentityKey struct{}
+
+// metricsIdentity carries the authenticated access key and how it was
+// authenticated, or why authentication failed, from the auth wrapper, which
+// runs inside track, back out to track.
+type metricsIdentity struct {
+	accessKey   string
+	authMode    string
+	authFailure string
+}
+
+// withMetricsIdentity prepares r to record its authenticated identity.
+func withMetricsIdentity(r *http.Request) (*http.Request, *metricsIdentity) {
+	m := &metricsIdentity{}
+	return r.WithContext(context.WithValue(r.Context(), metricsIdentityKey{}, m)), m
+}
+
+// recordMetricsIdentity remembers the access key of the identity
+// authenticated for r so that track can label its metrics with it.
+func recordMetricsIdentity(r *http.Request) {
+	m, ok := r.Context().Value(metricsIdentityKey{}).(*metricsIdentity)
+	if !ok || !metricsIncludeAccessKey {
+		return
+	}
+	identity, _ := s3_constants.GetIdentityFromContext(r).(*Identity)
+	m.accessKey = identityAccessKey(identity, r)
+}
+
+// accessKeyLabel returns the authenticated access key, anonymousAccessKey
+// when there is none, or noAccessKey when the label is disabled.
+func (m *metricsIdentity) accessKeyLabel() string {
+	if !metricsIncludeAccessKey {
+		return noAccessKey
+	}
+	if m == nil || m.accessKey == "" {
+		return anonymousAccessKey
+	}
+	return m.accessKey
+}
+
+// identityAccessKey returns the credential of identity that r was signed
+// with. The signature only selects among the credentials of the identity,
+// which authentication verified it against, so a key that is not one of
+// them is never returned.
+func identityAccessKey(identity *Identity, r *http.Request) string {
+	if identity == nil {
+		return ""
+	}
+	signed := requestAccessKey(r)
+	for _, cred := range identity.Credentials {
+		if cred != nil && cred.AccessKey != "" && cred.AccessKey == signed {
+			return cred.AccessKey
+		}
+	}
+	return ""
+}
+
+// requestAccessKey extracts the access key from the signature of r.
+func requestAccessKey(r *http.Request) string {
+	query := r.URL.Query()
+	if credential := query.Get("X-Amz-Credential"); credential != "" {
+		accessKey, _, _ := strings.Cut(credential, "/")
+		return accessKey
+	}
+	if accessKey := query.Get("AWSAccessKeyId"); accessKey != "" {
+		return accessKey
+	}
+	auth := r.Header.Get("Authorization")
+	switch {
+	case strings.HasPrefix(auth, signV4Algorithm):
+		if sv, errCode := parseSignV4(auth); errCode == s3err.ErrNone {
+			return sv.Credential.accessKey
+		}
+	case strings.HasPrefix(auth, signV2Algorithm+" "):
+		if accessKey, errCode := validateV2AuthHeader(auth); errCode == s3err.ErrNone {
+			return accessKey
+		}
+	}
+	return ""
+}
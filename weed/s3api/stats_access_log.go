@@ -0,0 +1,160 @@
+package s3api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+)
+
+const (
+	accessLogJSON     = "json"
+	accessLogCombined = "combined"
+)
+
+// accessLog writes a line for every tracked request when S3_ACCESS_LOG is
+// set, using the values track has already computed for the metrics. Lines
+// are JSON objects, or in the Apache combined format with
+// S3_ACCESS_LOG_FORMAT=combined, and go to the file named by
+// S3_ACCESS_LOG_FILE or, by default, to stdout. It is nil when disabled.
+var accessLog = openAccessLogFromEnv()
+
+func openAccessLogFromEnv() *accessLogger {
+	if !envBool("S3_ACCESS_LOG", false) {
+		return nil
+	}
+	format := strings.ToLower(strings.TrimSpace(os.Getenv("S3_ACCESS_LOG_FORMAT")))
+	switch format {
+	case "":
+		format = accessLogJSON
+	case accessLogJSON, accessLogCombined:
+	default:
+		glog.Warningf("ignoring invalid S3_ACCESS_LOG_FORMAT=%q, using %s", format, accessLogJSON)
+		format = accessLogJSON
+	}
+	path := os.Getenv("S3_ACCESS_LOG_FILE")
+	if path == "" || path == "-" {
+		return newAccessLogger(os.Stdout, format)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		glog.Errorf("open S3_ACCESS_LOG_FILE: %v", err)
+		return nil
+	}
+	return newAccessLogger(f, format)
+}
+
+// accessLogger serializes access log lines to its sink.
+type accessLogger struct {
+	format string
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func newAccessLogger(w io.Writer, format string) *accessLogger {
+	return &accessLogger{format: format, w: w}
+}
+
+// accessLogEntry is one request in the access log.
+type accessLogEntry struct {
+	Time        time.Time `json:"time"`
+	ClientIP    string    `json:"client_ip"`
+	ClientClass string    `json:"client_class"`
+	AccessKey   string    `json:"access_key,omitempty"`
+	Method      string    `json:"method"`
+	Action      string    `json:"action"`
+	Class       string    `json:"class"`
+	Bucket      string    `json:"bucket,omitempty"`
+	Object      string    `json:"object,omitempty"`
+	Status      int       `json:"status"`
+	BytesIn     int64     `json:"bytes_in"`
+	BytesOut    int64     `json:"bytes_out"`
+	// Duration and TTFB, the time until the first body byte was written, are
+	// in seconds. TTFB is omitted for responses without a body.
+	Duration float64 `json:"duration"`
+	TTFB     float64 `json:"ttfb,omitempty"`
+
+	request string
+	referer string
+	agent   string
+}
+
+// newAccessLogEntry collects the access log fields of r, which finished at end.
+func newAccessLogEntry(r *http.Request, action string, class rwClass, bucket, object, accessKey string, status int, bytesIn, bytesOut int64, start, end, firstWrite time.Time) accessLogEntry {
+	addr, network := requestClientNetwork(r)
+	entry := accessLogEntry{
+		Time:        start.UTC(),
+		ClientIP:    anonymizeIP(addr).String(),
+		ClientClass: network,
+		Method:      r.Method,
+		Action:      action,
+		Class:       class.String(),
+		Bucket:      bucket,
+		Object:      object,
+		Status:      status,
+		BytesIn:     bytesIn,
+		BytesOut:    bytesOut,
+		Duration:    end.Sub(start).Seconds(),
+		request:     r.Method + " " + r.URL.RequestURI() + " " + r.Proto,
+		referer:     r.Referer(),
+		agent:       r.UserAgent(),
+	}
+	if accessKey != noAccessKey {
+		entry.AccessKey = accessKey
+	}
+	if !firstWrite.IsZero() {
+		entry.TTFB = firstWrite.Sub(start).Seconds()
+	}
+	return entry
+}
+
+// log writes entry as one line. Write errors are logged and otherwise
+// ignored, so that a full disk does not fail requests.
+func (l *accessLogger) log(entry accessLogEntry) {
+	var line []byte
+	if l.format == accessLogCombined {
+		line = []byte(entry.combined())
+	} else {
+		var err error
+		if line, err = json.Marshal(entry); err != nil {
+			glog.V(1).Infof("encode access log entry: %v", err)
+			return
+		}
+		line = append(line, '\n')
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(line); err != nil {
+		glog.V(1).Infof("write access log: %v", err)
+	}
+}
+
+// combined formats entry in the Apache combined log format, with the access
+// key as the user.
+func (e accessLogEntry) combined() string {
+	user := e.AccessKey
+	if user == "" {
+		user = "-"
+	}
+	size := "-"
+	if e.BytesOut > 0 {
+		size = fmt.Sprint(e.BytesOut)
+	}
+	return fmt.Sprintf("%s - %s [%s] %q %d %s %q %q\n",
+		e.ClientIP, user, e.Time.Format("02/Jan/2006:15:04:05 -0700"), e.request, e.Status, size,
+		dashIfEmpty(e.referer), dashIfEmpty(e.agent))
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,72 @@
+package s3api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+// withAccessLog logs the tracked requests in format to the returned buffer
+// for the duration of the test.
+func withAccessLog(t *testing.T, format string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	old := accessLog
+	accessLog = newAccessLogger(&buf, format)
+	t.Cleanup(func() { accessLog = old })
+	return &buf
+}
+
+func trackAccessLogRequest() {
+	r := newStatsRequest(http.MethodGet, "stats-access-log", "dir/key", "203.0.113.5:1234")
+	r.Header.Set("User-Agent", "aws-sdk-go/1.0")
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte("hello"))
+	}
+	track(handler, "GET")(httptest.NewRecorder(), r)
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	buf := withAccessLog(t, accessLogJSON)
+	trackAccessLogRequest()
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("decode %q: %v", buf.String(), err)
+	}
+	for field, want := range map[string]any{
+		"client_ip":    "203.0.113.5",
+		"client_class": networkExternal,
+		"method":       "GET",
+		"action":       "GET",
+		"class":        "read",
+		"bucket":       "stats-access-log",
+		"object":       "dir/key",
+		"status":       float64(206),
+		"bytes_in":     float64(0),
+		"bytes_out":    float64(5),
+	} {
+		if entry[field] != want {
+			t.Errorf("%s = %v, want %v", field, entry[field], want)
+		}
+	}
+	for _, field := range []string{"time", "duration", "ttfb"} {
+		if _, ok := entry[field]; !ok {
+			t.Errorf("missing %s in %q", field, buf.String())
+		}
+	}
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	buf := withAccessLog(t, accessLogCombined)
+	trackAccessLogRequest()
+
+	want := regexp.MustCompile(`^203\.0\.113\.5 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} \+0000\] "GET /stats-access-log/dir/key HTTP/1\.1" 206 5 "-" "aws-sdk-go/1\.0"\n$`)
+	if !want.Match(buf.Bytes()) {
+		t.Errorf("combined line = %q", buf.String())
+	}
+}
@@ -0,0 +1,94 @@
+package s3api
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/seaweedfs/seaweedfs/weed/s3api/s3err"
+)
+
+// metricsIncludeAccount adds the account owning the bucket as a label to the
+// bucket traffic counters, since bucket names can be reused by other accounts.
+// It is off by default; the label is then always noAccount.
+var metricsIncludeAccount = envBool("S3_METRICS_INCLUDE_ACCOUNT", false)
+
+// noAccount labels traffic whose bucket owner is unknown or not resolved.
+const noAccount = "-"
+
+// maxCachedBucketAccounts bounds bucketAccountCache; the cache starts over
+// when it is full.
+const maxCachedBucketAccounts = 10000
+
+// bucketOwnerResolver returns the ID of the account owning bucket.
+type bucketOwnerResolver func(bucket string) (string, bool)
+
+// bucketAccounts caches the owners of the buckets traffic is counted for. The
+// bucket registry invalidates its entries when bucket metadata changes.
+var bucketAccounts = newBucketAccountCache()
+
+type bucketAccountCache struct {
+	resolve atomic.Pointer[bucketOwnerResolver]
+
+	mu       sync.RWMutex
+	accounts map[string]string
+}
+
+func newBucketAccountCache() *bucketAccountCache {
+	return &bucketAccountCache{accounts: make(map[string]string)}
+}
+
+// setResolver replaces the owner lookup and forgets the cached owners.
+func (c *bucketAccountCache) setResolver(resolve bucketOwnerResolver) {
+	c.resolve.Store(&resolve)
+	c.mu.Lock()
+	c.accounts = make(map[string]string)
+	c.mu.Unlock()
+}
+
+// account returns the owner of bucket, or noAccount when it is unknown.
+// Unknown owners are cached too, until the bucket is invalidated.
+func (c *bucketAccountCache) account(bucket string) string {
+	c.mu.RLock()
+	account, ok := c.accounts[bucket]
+	c.mu.RUnlock()
+	if ok {
+		return account
+	}
+	account = noAccount
+	if resolve := c.resolve.Load(); resolve != nil {
+		if owner, found := (*resolve)(bucket); found && owner != "" {
+			account = owner
+		}
+	}
+	c.mu.Lock()
+	if len(c.accounts) >= maxCachedBucketAccounts {
+		c.accounts = make(map[string]string)
+	}
+	c.accounts[bucket] = account
+	c.mu.Unlock()
+	return account
+}
+
+// invalidate forgets the cached owner of bucket.
+func (c *bucketAccountCache) invalidate(bucket string) {
+	c.mu.Lock()
+	delete(c.accounts, bucket)
+	c.mu.Unlock()
+}
+
+// bucketAccountLabel returns the account label of traffic to bucket.
+func bucketAccountLabel(bucket string) string {
+	if !metricsIncludeAccount || bucket == "" {
+		return noAccount
+	}
+	return bucketAccounts.account(bucket)
+}
+
+// bucketOwner resolves the owning account of bucket from its metadata.
+func (r *BucketRegistry) bucketOwner(bucket string) (string, bool) {
+	metadata, errCode := r.GetBucketMetadata(bucket)
+	if errCode != s3err.ErrNone || metadata.Owner == nil || metadata.Owner.ID == nil {
+		return "", false
+	}
+	return *metadata.Owner.ID, true
+}
@@ -0,0 +1,74 @@
+package s3api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// withBucketOwners resolves bucket owners from owners for the duration of the
+// test, counting the lookups in *lookups.
+func withBucketOwners(t *testing.T, owners map[string]string, lookups *int) {
+	t.Helper()
+	oldInclude, oldCache := metricsIncludeAccount, bucketAccounts
+	t.Cleanup(func() { metricsIncludeAccount, bucketAccounts = oldInclude, oldCache })
+	metricsIncludeAccount = true
+	bucketAccounts = newBucketAccountCache()
+	bucketAccounts.setResolver(func(bucket string) (string, bool) {
+		*lookups++
+		owner, ok := owners[bucket]
+		return owner, ok
+	})
+}
+
+func TestBucketTrafficLabelsAccount(t *testing.T) {
+	var lookups int
+	withBucketOwners(t, map[string]string{"stats-account-owned": "acct-1"}, &lookups)
+
+	BucketTrafficSent(100, newStatsRequest(http.MethodGet, "stats-account-owned", "k", "10.0.0.1:1234"))
+	BucketTrafficSent(20, newStatsRequest(http.MethodGet, "stats-account-owned", "k", "10.0.0.1:1234"))
+	BucketTrafficReceived(7, newStatsRequest(http.MethodPut, "stats-account-owned", "k", "10.0.0.1:1234"))
+	BucketTrafficSent(3, newStatsRequest(http.MethodGet, "stats-account-unowned", "k", "10.0.0.1:1234"))
+
+	if got := testutil.ToFloat64(stats_collect.S3BucketTrafficSentBytesCounter.WithLabelValues("stats-account-owned", "acct-1")); got != 120 {
+		t.Errorf("acct-1 sent bytes = %v, want 120", got)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3BucketTrafficReceivedBytesCounter.WithLabelValues("stats-account-owned", "acct-1")); got != 7 {
+		t.Errorf("acct-1 received bytes = %v, want 7", got)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3BucketTrafficSentBytesCounter.WithLabelValues("stats-account-unowned", noAccount)); got != 3 {
+		t.Errorf("unknown owner sent bytes = %v, want 3", got)
+	}
+	if lookups != 2 {
+		t.Errorf("owner lookups = %d, want one per bucket", lookups)
+	}
+}
+
+func TestBucketAccountCacheInvalidation(t *testing.T) {
+	var lookups int
+	owners := map[string]string{"b": "acct-1"}
+	withBucketOwners(t, owners, &lookups)
+
+	if got := bucketAccountLabel("b"); got != "acct-1" {
+		t.Fatalf("account = %q, want acct-1", got)
+	}
+	owners["b"] = "acct-2"
+	if got := bucketAccountLabel("b"); got != "acct-1" {
+		t.Errorf("account = %q before invalidation, want the cached acct-1", got)
+	}
+	bucketAccounts.invalidate("b")
+	if got := bucketAccountLabel("b"); got != "acct-2" {
+		t.Errorf("account = %q after invalidation, want acct-2", got)
+	}
+	if lookups != 2 {
+		t.Errorf("owner lookups = %d, want 2", lookups)
+	}
+
+	metricsIncludeAccount = false
+	if got := bucketAccountLabel("b"); got != noAccount {
+		t.Errorf("account = %q with the label disabled, want %q", got, noAccount)
+	}
+}
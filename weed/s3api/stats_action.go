@@ -0,0 +1,41 @@
+package s3api
+
+import "strings"
+
+// trackActions are the action labels the S3 routes register track with.
+// normalizeAction maps the aliases of these labels back onto them.
+var trackActions = []string{"GET", "HEAD", "PUT", "POST", "DELETE", "LIST", "COPY", "OPTIONS"}
+
+// actionPrefixes and actionSuffixes are stripped, regardless of case, from an
+// action label before it is matched against trackActions, so that "s3:GET",
+// "GetHandler" and "get" share the series of "GET".
+var (
+	actionPrefixes = []string{"S3:", "S3_ACTION_", "ACTION_"}
+	actionSuffixes = []string{"_HANDLER", "HANDLER"}
+)
+
+// normalizeAction canonicalizes the action label of a route. A label that is
+// an alias of one of trackActions is replaced by it; any other label, such as
+// "STS-AssumeRole", is only trimmed and keeps its casing.
+func normalizeAction(action string) string {
+	action = strings.TrimSpace(action)
+	base := action
+	for _, prefix := range actionPrefixes {
+		if len(base) > len(prefix) && strings.EqualFold(base[:len(prefix)], prefix) {
+			base = base[len(prefix):]
+			break
+		}
+	}
+	for _, suffix := range actionSuffixes {
+		if n := len(base) - len(suffix); n > 0 && strings.EqualFold(base[n:], suffix) {
+			base = base[:n]
+			break
+		}
+	}
+	for _, known := range trackActions {
+		if strings.EqualFold(base, known) {
+			return known
+		}
+	}
+	return action
+}
@@ -0,0 +1,101 @@
+package s3api
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func TestNormalizeAction(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"GET", "GET"},
+		{"get", "GET"},
+		{" List ", "LIST"},
+		{"s3:GET", "GET"},
+		{"S3:put", "PUT"},
+		{"ACTION_LIST", "LIST"},
+		{"S3_ACTION_DELETE", "DELETE"},
+		{"CopyHandler", "COPY"},
+		{"GET_HANDLER", "GET"},
+		{"s3:getHandler", "GET"},
+		{"handler", "handler"},
+		{"s3:", "s3:"},
+		{"Read", "Read"},
+		{"STS-AssumeRole", "STS-AssumeRole"},
+		{"S3Tables-CreateTableBucket", "S3Tables-CreateTableBucket"},
+		{"s3:CustomHandler", "s3:CustomHandler"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeAction(tt.raw); got != tt.want {
+			t.Errorf("normalizeAction(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+// TestNormalizeActionKeepsRouteLabels checks that every action label track
+// is registered with in this package is already in its normalized form, so
+// normalization never renames an existing series.
+func TestNormalizeActionKeepsRouteLabels(t *testing.T) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi fs.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := 0
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			ast.Inspect(file, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok || len(call.Args) != 2 {
+					return true
+				}
+				if fn, ok := call.Fun.(*ast.Ident); !ok || fn.Name != "track" {
+					return true
+				}
+				lit, ok := call.Args[1].(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					return true
+				}
+				label, err := strconv.Unquote(lit.Value)
+				if err != nil {
+					t.Fatalf("%s: %v", fset.Position(lit.Pos()), err)
+				}
+				labels++
+				if got := normalizeAction(label); got != label {
+					t.Errorf("%s: normalizeAction(%q) = %q, want it unchanged", fset.Position(lit.Pos()), label, got)
+				}
+				return true
+			})
+		}
+	}
+	if labels == 0 {
+		t.Fatal("found no track calls")
+	}
+}
+
+func TestTrackNormalizesActionLabel(t *testing.T) {
+	const bucket = "stats-action-label"
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	for _, action := range []string{"GET", "get", "s3:GetHandler"} {
+		track(ok, action)(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	}
+	if got := testutil.ToFloat64(stats_collect.S3RequestCounter.WithLabelValues("GET", "200", bucket, noAccessKey)); got != 3 {
+		t.Errorf("GET requests = %v, want 3", got)
+	}
+}
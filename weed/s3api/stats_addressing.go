@@ -0,0 +1,29 @@
+package s3api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// The S3AddressingStyleCounter styles.
+const (
+	addressingPath  = "path"
+	addressingVhost = "vhost"
+)
+
+// addressingStyle returns whether the bucket of r was addressed
+// virtual-hosted style, in the Host header, or path style. It tells the two
+// apart by the route r matched, since only the virtual-host routes take the
+// bucket from a host template.
+func addressingStyle(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return addressingPath
+	}
+	if host, err := route.GetHostTemplate(); err == nil && strings.Contains(host, "{bucket") {
+		return addressingVhost
+	}
+	return addressingPath
+}
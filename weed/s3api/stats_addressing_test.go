@@ -0,0 +1,47 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func TestTrackCountsAddressingStyle(t *testing.T) {
+	const bucket = "stats-addressing"
+	// Routed like the gateway with a virtual-host domain.
+	router := mux.NewRouter().SkipClean(true)
+	ok := track(func(w http.ResponseWriter, r *http.Request) {}, "GET")
+	for _, sub := range []*mux.Router{
+		router.Host("{bucket:.+}.s3.example.com").Subrouter(),
+		router.PathPrefix("/{bucket}").Subrouter(),
+	} {
+		sub.Methods(http.MethodGet).Path("/{object:(?s).+}").HandlerFunc(ok)
+	}
+
+	for _, target := range []string{
+		"http://s3.example.com/" + bucket + "/key",
+		"http://" + bucket + ".s3.example.com/key",
+		"http://" + bucket + ".s3.example.com/" + bucket + "/key",
+	} {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.RemoteAddr = "203.0.113.5:1234"
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	for style, want := range map[string]float64{addressingPath: 1, addressingVhost: 2} {
+		if got := testutil.ToFloat64(stats_collect.S3AddressingStyleCounter.WithLabelValues(bucket, style)); got != want {
+			t.Errorf("%s requests = %v, want %v", style, got, want)
+		}
+	}
+}
+
+func TestAddressingStyleWithoutRoute(t *testing.T) {
+	if got := addressingStyle(newStatsRequest(http.MethodGet, "b", "k", "203.0.113.5:1234")); got != addressingPath {
+		t.Errorf("addressingStyle() = %q, want %q", got, addressingPath)
+	}
+}
@@ -0,0 +1,115 @@
+package s3api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/seaweedfs/seaweedfs/weed/s3api/s3err"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+type admissionKey struct{}
+
+// admission carries the per-bucket limits of a request from track into the
+// auth wrapper, which charges them once the request is authenticated, and
+// the outcome back out to track.
+type admission struct {
+	action   string
+	bucket   string
+	checked  bool
+	admitted bool
+	rejected bool
+	probe    bool
+	release  func()
+	waited   time.Duration
+	body     *countingBody
+	received int64
+}
+
+// withAdmission prepares r to be admitted to bucket by admitAuthenticated.
+func withAdmission(r *http.Request, action, bucket string) (*http.Request, *admission) {
+	a := &admission{action: action, bucket: bucket}
+	return r.WithContext(context.WithValue(r.Context(), admissionKey{}, a)), a
+}
+
+// admitAuthenticated charges r to the rate limit, quota, error breaker and
+// concurrency limit of its bucket. The auth wrappers call it right before the
+// handler, once r is authenticated or allowed anonymously, so that requests
+// failing authentication never use up the limits of a bucket. It returns
+// false, having answered r, when r must not reach the handler. Requests that
+// are not tracked, or were admitted already, always pass.
+func admitAuthenticated(w http.ResponseWriter, r *http.Request) bool {
+	a, ok := r.Context().Value(admissionKey{}).(*admission)
+	if !ok || a.checked {
+		return true
+	}
+	a.checked = true
+	bucket := a.bucket
+	now := time.Now()
+	if !bucketRateLimits.allow(bucket, now) {
+		stats_collect.S3RateLimitedCounter.WithLabelValues(bucket).Inc()
+		setRetryAfter(w, bucketRateLimits.retryAfter(bucket, now))
+		a.reject(w, r, s3err.ErrSlowDown)
+		return false
+	}
+	if direction, exceeded := bucketQuotas.exceeded(bucket); exceeded {
+		stats_collect.S3QuotaExceededCounter.WithLabelValues(bucket, direction).Inc()
+		errorCode := bucketQuotas.errorCode()
+		if errorCode == s3err.ErrSlowDown {
+			setRetryAfter(w, bucketQuotas.untilReset(now))
+		}
+		a.reject(w, r, errorCode)
+		return false
+	}
+	probe, admitted := bucketErrorBreakers.allow(bucket)
+	if !admitted {
+		a.reject(w, r, s3err.ErrServiceUnavailable)
+		return false
+	}
+	release, acquired := bucketConcurrencyLimits.acquire(r.Context(), bucket, bucketConcurrencyMaxWait)
+	a.waited = time.Since(now)
+	if !acquired {
+		// The backend was never reached, so the rejection says nothing
+		// about its health.
+		bucketErrorBreakers.cancel(bucket, probe)
+		stats_collect.S3ConcurrencyRejectedCounter.WithLabelValues(bucket).Inc()
+		a.reject(w, r, s3err.ErrSlowDown)
+		return false
+	}
+	a.admitted, a.probe, a.release = true, probe, release
+	// Wrapped only now, so that whatever authentication reads of the body
+	// is verified against the raw request.
+	a.body = countRequestBody(r)
+	return true
+}
+
+// recordReceivedBytes adds n bytes that the handler of r read from its body
+// before admitting it to the ingress of r.
+func recordReceivedBytes(r *http.Request, n int64) {
+	if a, ok := r.Context().Value(admissionKey{}).(*admission); ok && a.admitted {
+		a.received += n
+	}
+}
+
+// bytesReceived returns the bytes of the request body read since r was
+// admitted. Requests that were never admitted received none.
+func (a *admission) bytesReceived() int64 {
+	return a.received + a.body.bytesRead()
+}
+
+// reject answers r with code and tells track that it was rejected.
+func (a *admission) reject(w http.ResponseWriter, r *http.Request, code s3err.ErrorCode) {
+	a.rejected = true
+	reject(w, r, a.action, a.bucket, code)
+}
+
+// done gives back the concurrency slot of an admitted request and reports
+// its status to the error breaker.
+func (a *admission) done(status int) {
+	if !a.admitted {
+		return
+	}
+	a.release()
+	bucketErrorBreakers.done(a.bucket, a.probe, status)
+}
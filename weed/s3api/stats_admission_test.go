@@ -0,0 +1,80 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/seaweedfs/seaweedfs/weed/s3api/s3_constants"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// authDisabled wraps f like a route with authentication disabled, which
+// admits every request to its bucket.
+func authDisabled(f http.HandlerFunc) http.HandlerFunc {
+	return (&IdentityAccessManagement{}).Auth(f, s3_constants.ACTION_READ)
+}
+
+func TestUnauthenticatedRequestsAreNotCharged(t *testing.T) {
+	const bucket = "stats-admission-unauthenticated"
+	old := bucketRateLimits
+	bucketRateLimits = parseBucketRateLimits(bucket + "=1")
+	t.Cleanup(func() { bucketRateLimits = old })
+	withBucketConcurrencyLimits(t, bucket+"=1", time.Millisecond)
+	iam := &IdentityAccessManagement{isAuthEnabled: true}
+	iam.identityAnonymous = &Identity{Name: "anonymous", Account: &AccountAnonymous, Actions: []Action{s3_constants.ACTION_READ}}
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	rateLimited := stats_collect.S3RateLimitedCounter.WithLabelValues(bucket)
+	before := testutil.ToFloat64(rateLimited)
+
+	// Anonymous writes fail authentication and take no token.
+	for i := 0; i < 20; i++ {
+		w := httptest.NewRecorder()
+		track(iam.Auth(ok, s3_constants.ACTION_WRITE), "PUT")(w, newStatsRequest(http.MethodPut, bucket, "k", "203.0.113.5:1234"))
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("unauthenticated write = %d, want 403", w.Code)
+		}
+	}
+	if got := testutil.ToFloat64(rateLimited) - before; got != 0 {
+		t.Errorf("rate limited = %v, want no unauthenticated request throttled", got)
+	}
+
+	read := func() int {
+		w := httptest.NewRecorder()
+		track(iam.Auth(ok, s3_constants.ACTION_READ), "GET")(w, newStatsRequest(http.MethodGet, bucket, "k", "203.0.113.5:1234"))
+		return w.Code
+	}
+	if got := read(); got != http.StatusOK {
+		t.Errorf("allowed read after the burst = %d, want 200", got)
+	}
+	if got := read(); got != http.StatusServiceUnavailable {
+		t.Errorf("second allowed read = %d, want 503 once the token is used", got)
+	}
+	if got := testutil.ToFloat64(rateLimited) - before; got != 1 {
+		t.Errorf("rate limited = %v, want 1", got)
+	}
+}
+
+func TestAdmitAuthenticatedOnce(t *testing.T) {
+	const bucket = "stats-admission-once"
+	withBucketConcurrencyLimits(t, bucket+"=1", time.Millisecond)
+	var admitted []bool
+	// A signed form upload is admitted by the auth wrapper and again by
+	// PostPolicyBucketHandler.
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		admitted = append(admitted, admitAuthenticated(w, r), admitAuthenticated(w, r))
+	}
+	track(handler, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	if len(admitted) != 2 || !admitted[0] || !admitted[1] {
+		t.Errorf("admitted = %v, want the second call to pass without a second slot", admitted)
+	}
+	// The slot was given back.
+	w := httptest.NewRecorder()
+	track(authDisabled(func(w http.ResponseWriter, r *http.Request) {}), "GET")(w, newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	if w.Code != http.StatusOK {
+		t.Errorf("next request = %d, want 200", w.Code)
+	}
+}
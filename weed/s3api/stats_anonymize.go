@@ -0,0 +1,30 @@
+package s3api
+
+import "net/netip"
+
+// anonymizeClientIP masks client addresses, S3_ANONYMIZE_CLIENT_IP, wherever
+// they end up in a metric label or the access log. Classification, rate
+// limiting and access control still see the full address.
+var anonymizeClientIP = envBool("S3_ANONYMIZE_CLIENT_IP", false)
+
+// anonymizeIP returns addr with its last octet zeroed for IPv4, including
+// IPv4-mapped IPv6, and its last 80 bits zeroed for IPv6, when
+// anonymizeClientIP is set. Otherwise, or if addr is invalid, it returns
+// addr unchanged.
+func anonymizeIP(addr netip.Addr) netip.Addr {
+	if !anonymizeClientIP || !addr.IsValid() {
+		return addr
+	}
+	bits := 48
+	switch {
+	case addr.Is4():
+		bits = 24
+	case addr.Is4In6():
+		bits = 96 + 24
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return addr
+	}
+	return prefix.Addr()
+}
@@ -0,0 +1,78 @@
+package s3api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+// withAnonymizeClientIP sets anonymizeClientIP for the duration of the test.
+func withAnonymizeClientIP(t *testing.T, enabled bool) {
+	t.Helper()
+	old := anonymizeClientIP
+	anonymizeClientIP = enabled
+	t.Cleanup(func() { anonymizeClientIP = old })
+}
+
+func TestAnonymizeIP(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"203.0.113.57", "203.0.113.0"},
+		{"::ffff:203.0.113.57", "::ffff:203.0.113.0"},
+		{"2001:db8:1234:5678:9abc:def0:1234:5678", "2001:db8:1234::"},
+		{"fe80::1%eth0", "fe80::"},
+	}
+	withAnonymizeClientIP(t, true)
+	for _, tt := range tests {
+		if got := anonymizeIP(netip.MustParseAddr(tt.addr)); got != netip.MustParseAddr(tt.want) {
+			t.Errorf("anonymizeIP(%s) = %s, want %s", tt.addr, got, tt.want)
+		}
+	}
+	if got := anonymizeIP(netip.Addr{}); got.IsValid() {
+		t.Errorf("anonymizeIP(invalid) = %s", got)
+	}
+
+	withAnonymizeClientIP(t, false)
+	for _, tt := range tests {
+		if addr := netip.MustParseAddr(tt.addr); anonymizeIP(addr) != addr {
+			t.Errorf("anonymizeIP(%s) changed the address while disabled", tt.addr)
+		}
+	}
+}
+
+func TestAnonymizedClientIsClassifiedByFullAddress(t *testing.T) {
+	withAnonymizeClientIP(t, true)
+	withPrivateAsInternal(t, false)
+	// Only the full address is internal; its anonymized form is not.
+	withInternalCIDRs(t, "203.0.113.57/32")
+	buf := withAccessLog(t, accessLogJSON)
+
+	r := newStatsRequest(http.MethodGet, "stats-anonymize", "k", "203.0.113.57:1234")
+	track(func(w http.ResponseWriter, r *http.Request) {}, "GET")(httptest.NewRecorder(), r)
+
+	var entry accessLogEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("decode %q: %v", buf.String(), err)
+	}
+	if entry.ClientIP != "203.0.113.0" {
+		t.Errorf("logged client ip = %q, want 203.0.113.0", entry.ClientIP)
+	}
+	if entry.ClientClass != networkInternal {
+		t.Errorf("client class = %q, want %q", entry.ClientClass, networkInternal)
+	}
+}
+
+func TestClientEgressPrefixIsAnonymized(t *testing.T) {
+	withAnonymizeClientIP(t, true)
+	old := clientEgressPrefixBitsV4
+	clientEgressPrefixBitsV4 = 32
+	t.Cleanup(func() { clientEgressPrefixBitsV4 = old })
+	prefix, ok := clientEgressPrefix(netip.MustParseAddr("203.0.113.57"))
+	if !ok || prefix.String() != "203.0.113.0/32" {
+		t.Errorf("clientEgressPrefix() = %s, %v, want 203.0.113.0/32", prefix, ok)
+	}
+}
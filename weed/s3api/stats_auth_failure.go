@@ -0,0 +1,66 @@
+package s3api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/seaweedfs/seaweedfs/weed/s3api/s3err"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// The S3AuthFailureCounter reasons.
+const (
+	authFailureNoCredentials = "no_credentials"
+	authFailureBadSignature  = "bad_signature"
+	authFailureExpired       = "expired"
+	authFailureUnknownKey    = "unknown_key"
+)
+
+// authFailureReason maps the error of a failed authentication to its
+// S3AuthFailureCounter reason. Errors that are not about the credentials of
+// the request, such as a policy denying a signed request, have no reason.
+func authFailureReason(errCode s3err.ErrorCode, t authType) (string, bool) {
+	switch errCode {
+	case s3err.ErrAuthHeaderEmpty:
+		return authFailureNoCredentials, true
+	case s3err.ErrAccessDenied:
+		if t == authTypeAnonymous {
+			return authFailureNoCredentials, true
+		}
+	case s3err.ErrInvalidAccessKeyID:
+		return authFailureUnknownKey, true
+	case s3err.ErrExpiredPresignRequest, s3err.ErrExpiredToken, s3err.ErrRequestTimeTooSkewed:
+		return authFailureExpired, true
+	case s3err.ErrSignatureDoesNotMatch,
+		s3err.ErrCredMalformed, s3err.ErrMalformedCredentialDate, s3err.ErrMissingCredTag,
+		s3err.ErrMissingSignTag, s3err.ErrMissingSignHeadersTag, s3err.ErrUnsignedHeaders,
+		s3err.ErrInvalidQuerySignatureAlgo, s3err.ErrSignatureVersionNotSupported,
+		s3err.ErrMalformedPresignedDate, s3err.ErrMalformedExpires, s3err.ErrNegativeExpires,
+		s3err.ErrMaximumExpires, s3err.ErrMissingDateHeader, s3err.ErrMalformedDate:
+		return authFailureBadSignature, true
+	}
+	return "", false
+}
+
+// recordAuthFailure counts a failed authentication of r in
+// S3AuthFailureCounter and, when r passed through track, remembers the
+// reason in its context.
+func recordAuthFailure(r *http.Request, errCode s3err.ErrorCode, t authType) {
+	reason, ok := authFailureReason(errCode, t)
+	if !ok {
+		return
+	}
+	stats_collect.S3AuthFailureCounter.WithLabelValues(reason).Inc()
+	if m, ok := r.Context().Value(metricsIdentityKey{}).(*metricsIdentity); ok {
+		m.authFailure = reason
+	}
+}
+
+// AuthFailureReasonFromContext returns why authentication of the request ctx
+// belongs to failed, or "" when it did not fail or was not tracked.
+func AuthFailureReasonFromContext(ctx context.Context) string {
+	if m, ok := ctx.Value(metricsIdentityKey{}).(*metricsIdentity); ok {
+		return m.authFailure
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/seaweedfs/seaweedfs/weed/s3api/s3err"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func TestAuthFailureReason(t *testing.T) {
+	tests := []struct {
+		errCode  s3err.ErrorCode
+		authType authType
+		want     string
+	}{
+		{s3err.ErrAuthHeaderEmpty, authTypeUnknown, authFailureNoCredentials},
+		{s3err.ErrAccessDenied, authTypeAnonymous, authFailureNoCredentials},
+		{s3err.ErrSignatureDoesNotMatch, authTypeSigned, authFailureBadSignature},
+		{s3err.ErrCredMalformed, authTypeSigned, authFailureBadSignature},
+		{s3err.ErrExpiredPresignRequest, authTypePresigned, authFailureExpired},
+		{s3err.ErrRequestTimeTooSkewed, authTypeSigned, authFailureExpired},
+		{s3err.ErrInvalidAccessKeyID, authTypeSigned, authFailureUnknownKey},
+		// A policy denying a signed request is not an authentication failure.
+		{s3err.ErrAccessDenied, authTypeSigned, ""},
+		{s3err.ErrNoSuchBucket, authTypeSigned, ""},
+	}
+	for _, tt := range tests {
+		got, ok := authFailureReason(tt.errCode, tt.authType)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("authFailureReason(%v, %v) = %q, %v, want %q", tt.errCode, tt.authType, got, ok, tt.want)
+		}
+	}
+}
+
+func TestTrackRecordsAuthFailureReason(t *testing.T) {
+	tests := []struct {
+		errCode s3err.ErrorCode
+		want    string
+	}{
+		{s3err.ErrAuthHeaderEmpty, authFailureNoCredentials},
+		{s3err.ErrSignatureDoesNotMatch, authFailureBadSignature},
+		{s3err.ErrExpiredPresignRequest, authFailureExpired},
+		{s3err.ErrInvalidAccessKeyID, authFailureUnknownKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			counter := stats_collect.S3AuthFailureCounter.WithLabelValues(tt.want)
+			before := testutil.ToFloat64(counter)
+			var reason string
+			// Stands in for the auth wrapper rejecting the request.
+			deny := func(w http.ResponseWriter, r *http.Request) {
+				recordAuthFailure(r, tt.errCode, authTypeSigned)
+				reason = AuthFailureReasonFromContext(r.Context())
+				s3err.WriteErrorResponse(w, r, tt.errCode)
+			}
+			track(deny, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, "stats-auth-failure", "k", "10.0.0.1:1234"))
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Errorf("%s failures = %v, want 1", tt.want, got)
+			}
+			if reason != tt.want {
+				t.Errorf("reason in context = %q, want %q", reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthWrapperRecordsAuthFailure(t *testing.T) {
+	iam := &IdentityAccessManagement{isAuthEnabled: true}
+	iam.identityAnonymous = &Identity{Name: "anonymous", Account: &AccountAnonymous, Actions: []Action{"Read"}}
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	counter := stats_collect.S3AuthFailureCounter.WithLabelValues(authFailureNoCredentials)
+	before := testutil.ToFloat64(counter)
+
+	track(iam.Auth(ok, "Write"), "PUT")(httptest.NewRecorder(), newStatsRequest(http.MethodPut, "stats-auth-failure-wrapper", "k", "10.0.0.1:1234"))
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Errorf("anonymous write failures = %v, want 1", got)
+	}
+}
@@ -0,0 +1,42 @@
+package s3api
+
+import "net/http"
+
+// authModeUnknown labels requests that were not authenticated, because
+// authentication failed, is disabled or was never reached.
+const authModeUnknown = "unknown"
+
+// authModeLabel returns the S3AuthModeCounter label of an auth type.
+func authModeLabel(t authType) string {
+	switch t {
+	case authTypeAnonymous:
+		return "anonymous"
+	case authTypeSigned, authTypeStreamingSigned, authTypeStreamingUnsigned:
+		return "sigv4"
+	case authTypeSignedV2:
+		return "sigv2"
+	case authTypePresigned, authTypePresignedV2:
+		return "presigned"
+	case authTypeJWT:
+		return "jwt"
+	default:
+		return authModeUnknown
+	}
+}
+
+// recordMetricsAuthMode remembers how r was authenticated so that track can
+// count it in S3AuthModeCounter.
+func recordMetricsAuthMode(r *http.Request, t authType) {
+	if m, ok := r.Context().Value(metricsIdentityKey{}).(*metricsIdentity); ok {
+		m.authMode = authModeLabel(t)
+	}
+}
+
+// authModeLabel returns how the request was authenticated, or
+// authModeUnknown when it was not.
+func (m *metricsIdentity) authModeLabel() string {
+	if m == nil || m.authMode == "" {
+		return authModeUnknown
+	}
+	return m.authMode
+}
@@ -0,0 +1,71 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func TestTrackCountsAuthMode(t *testing.T) {
+	const bucket = "stats-track-auth-mode"
+	tests := []struct {
+		name string
+		// authenticate stands in for the auth wrapper; nil means the request
+		// never reached it.
+		authenticate func(r *http.Request)
+		want         string
+	}{
+		{"anonymous", func(r *http.Request) { recordMetricsAuthMode(r, authTypeAnonymous) }, "anonymous"},
+		{"sigv4", func(r *http.Request) { recordMetricsAuthMode(r, authTypeSigned) }, "sigv4"},
+		{"sigv4 streaming", func(r *http.Request) { recordMetricsAuthMode(r, authTypeStreamingSigned) }, "sigv4"},
+		{"sigv2", func(r *http.Request) { recordMetricsAuthMode(r, authTypeSignedV2) }, "sigv2"},
+		{"presigned v4", func(r *http.Request) { recordMetricsAuthMode(r, authTypePresigned) }, "presigned"},
+		{"presigned v2", func(r *http.Request) { recordMetricsAuthMode(r, authTypePresignedV2) }, "presigned"},
+		{"jwt", func(r *http.Request) { recordMetricsAuthMode(r, authTypeJWT) }, "jwt"},
+		{"unauthenticated", nil, authModeUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := stats_collect.S3AuthModeCounter.WithLabelValues(bucket, tt.want)
+			before := testutil.ToFloat64(counter)
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				if tt.authenticate != nil {
+					tt.authenticate(r)
+				}
+			}
+			track(handler, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Errorf("%s requests = %v, want 1", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAuthWrapperRecordsAuthMode(t *testing.T) {
+	const bucket = "stats-auth-wrapper-mode"
+	previousBlank := blankBucketOnForbidden
+	blankBucketOnForbidden = false
+	t.Cleanup(func() { blankBucketOnForbidden = previousBlank })
+	iam := &IdentityAccessManagement{isAuthEnabled: true}
+	iam.identityAnonymous = &Identity{Name: "anonymous", Account: &AccountAnonymous, Actions: []Action{"Read"}}
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	anonymous := stats_collect.S3AuthModeCounter.WithLabelValues(bucket, "anonymous")
+	unknown := stats_collect.S3AuthModeCounter.WithLabelValues(bucket, authModeUnknown)
+	anonymousBefore, unknownBefore := testutil.ToFloat64(anonymous), testutil.ToFloat64(unknown)
+
+	track(iam.Auth(ok, "Read"), "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	denied := newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234")
+	denied.Header.Set("Authorization", "garbage")
+	track(iam.Auth(ok, "Read"), "GET")(httptest.NewRecorder(), denied)
+
+	if got := testutil.ToFloat64(anonymous) - anonymousBefore; got != 1 {
+		t.Errorf("anonymous requests = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(unknown) - unknownBefore; got != 1 {
+		t.Errorf("unknown requests = %v, want the denied request", got)
+	}
+}
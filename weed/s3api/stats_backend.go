@@ -0,0 +1,73 @@
+package s3api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type backendTimingKey struct{}
+
+// backendTiming accumulates the time a request spends in calls to filer and
+// volume servers. Overlapping calls, e.g. concurrent chunk fetches, are
+// counted once, so the total never exceeds the request duration.
+type backendTiming struct {
+	mu     sync.Mutex
+	calls  int
+	active int
+	since  time.Time
+	total  time.Duration
+}
+
+// withBackendTiming prepares r to accumulate its backend time.
+func withBackendTiming(r *http.Request) (*http.Request, *backendTiming) {
+	b := &backendTiming{}
+	return r.WithContext(context.WithValue(r.Context(), backendTimingKey{}, b)), b
+}
+
+// StartBackendCall marks the start of a call to a filer or volume server on
+// behalf of the request ctx belongs to. Every call must be matched by
+// EndBackendCall. It does nothing outside of a tracked request.
+func StartBackendCall(ctx context.Context) {
+	b, ok := ctx.Value(backendTimingKey{}).(*backendTiming)
+	if !ok {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.active == 0 {
+		b.since = time.Now()
+	}
+	b.active++
+	b.calls++
+}
+
+// EndBackendCall marks the end of a call started with StartBackendCall.
+func EndBackendCall(ctx context.Context) {
+	b, ok := ctx.Value(backendTimingKey{}).(*backendTiming)
+	if !ok {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.active == 0 {
+		return
+	}
+	b.active--
+	if b.active == 0 {
+		b.total += time.Since(b.since)
+	}
+}
+
+// elapsed returns the backend time accumulated until now, counting calls
+// still in progress, and whether any backend call was made.
+func (b *backendTiming) elapsed(now time.Time) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	total := b.total
+	if b.active > 0 {
+		total += now.Sub(b.since)
+	}
+	return total, b.calls > 0
+}
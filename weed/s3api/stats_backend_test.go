@@ -0,0 +1,65 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func TestTrackAccumulatesBackendCalls(t *testing.T) {
+	const action = "BACKEND_TIMING_TEST"
+	backend := stats_collect.S3BackendLatencyHistogram.WithLabelValues(action)
+	var handlerTime time.Duration
+	handler := track(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		for i := 0; i < 2; i++ {
+			StartBackendCall(r.Context())
+			time.Sleep(20 * time.Millisecond)
+			EndBackendCall(r.Context())
+			// Gateway work between the calls is not backend time.
+			time.Sleep(20 * time.Millisecond)
+		}
+		handlerTime = time.Since(start)
+		w.WriteHeader(http.StatusOK)
+	}, action)
+	handler(httptest.NewRecorder(), newStatsRequest(http.MethodGet, "stats-backend", "k", "10.0.0.1:1234"))
+
+	count, sum := observedHistogram(t, backend)
+	if count != 1 {
+		t.Fatalf("backend observations = %d, want 1", count)
+	}
+	if sum < 0.04 || sum >= handlerTime.Seconds() {
+		t.Errorf("backend time = %vs, want at least 40ms and less than the handler's %v", sum, handlerTime)
+	}
+}
+
+func TestBackendTimingCountsOverlapOnce(t *testing.T) {
+	r, b := withBackendTiming(httptest.NewRequest(http.MethodGet, "/", nil))
+	if _, ok := b.elapsed(time.Now()); ok {
+		t.Error("reported backend time without a backend call")
+	}
+	ctx := r.Context()
+	start := time.Now()
+	StartBackendCall(ctx)
+	StartBackendCall(ctx)
+	time.Sleep(20 * time.Millisecond)
+	EndBackendCall(ctx)
+	EndBackendCall(ctx)
+	// An unmatched end is ignored.
+	EndBackendCall(ctx)
+	wall := time.Since(start)
+
+	elapsed, ok := b.elapsed(time.Now())
+	if !ok || elapsed < 20*time.Millisecond || elapsed > wall {
+		t.Errorf("elapsed = %v, %v, want between 20ms and %v", elapsed, ok, wall)
+	}
+}
+
+func TestBackendCallOutsideTrack(t *testing.T) {
+	ctx := httptest.NewRequest(http.MethodGet, "/", nil).Context()
+	StartBackendCall(ctx)
+	EndBackendCall(ctx)
+}
@@ -0,0 +1,88 @@
+package s3api
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+const (
+	billingStatusPath = "/status/s3/billing"
+	billingResetPath  = "/status/s3/billing/reset"
+)
+
+// billingEmitter pushes per-bucket usage to S3_BILLING_WEBHOOK_URL every
+// S3_BILLING_WEBHOOK_INTERVAL seconds. It is nil, and costs nothing on the
+// request path, when no URL is configured.
+var billingEmitter = newBillingEmitterFromEnv()
+
+// billingSnapshot is the resettable billing usage served on
+// billingStatusPath, for test and staging environments that zero it between
+// runs. It is nil unless S3_BILLING_SNAPSHOT_ENABLED is set.
+var billingSnapshot = newBillingSnapshotFromEnv()
+
+var startBillingEmitterOnce sync.Once
+
+func newBillingEmitterFromEnv() *stats_collect.BillingEmitter {
+	url := os.Getenv("S3_BILLING_WEBHOOK_URL")
+	if url == "" {
+		return nil
+	}
+	interval := envInt("S3_BILLING_WEBHOOK_INTERVAL", 60)
+	if interval <= 0 {
+		interval = 60
+	}
+	return stats_collect.NewBillingEmitter(url, time.Duration(interval)*time.Second)
+}
+
+// startBillingEmitter starts pushing usage if a webhook is configured.
+func startBillingEmitter() {
+	if billingEmitter == nil {
+		return
+	}
+	startBillingEmitterOnce.Do(billingEmitter.Start)
+}
+
+func newBillingSnapshotFromEnv() *stats_collect.BillingSnapshot {
+	if !envBool("S3_BILLING_SNAPSHOT_ENABLED", false) {
+		return nil
+	}
+	return stats_collect.NewBillingSnapshot()
+}
+
+// billingStatusHandler serves the billing usage since the last reset as JSON.
+func billingStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if billingSnapshot == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(billingSnapshot.Usage(time.Now())); err != nil {
+		glog.V(1).Infof("write s3 billing usage: %v", err)
+	}
+}
+
+// billingResetHandler zeroes the billing usage served by billingStatusHandler.
+// The Prometheus counters and the billing webhook are not affected.
+func billingResetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if billingSnapshot == nil {
+		http.NotFound(w, r)
+		return
+	}
+	billingSnapshot.Reset()
+	glog.V(0).Infof("reset s3 billing usage snapshot")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,125 @@
+package s3api
+
+import (
+	"sync"
+	"sync/atomic"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// BillingRecord identifies what a billed request or transfer is attributed
+// to.
+type BillingRecord struct {
+	Bucket string
+	// Account is the owning account of Bucket, or "-" unless
+	// S3_METRICS_INCLUDE_ACCOUNT is set.
+	Account string
+	// AccessKey is the access key the request was signed with, or "-" when
+	// it is anonymous or the access key label is disabled. It is only set
+	// for reads and writes.
+	AccessKey string
+	// Tier is the billing tier of the object. It is only set for reads and
+	// writes.
+	Tier string
+	// StorageClass is the requested storage class. It is only set for
+	// writes.
+	StorageClass string
+}
+
+// BillingSink receives the billed usage of the gateway, for metering systems
+// that want it without scraping Prometheus. Its methods are called on the
+// request path, concurrently, and must not block.
+type BillingSink interface {
+	// RecordRead records n billed read operations.
+	RecordRead(record BillingRecord, n int64)
+	// RecordWrite records n billed write operations.
+	RecordWrite(record BillingRecord, n int64)
+	// RecordBytesSent records bytes sent to clients.
+	RecordBytesSent(record BillingRecord, bytes int64)
+	// RecordBytesReceived records bytes received from clients.
+	RecordBytesReceived(record BillingRecord, bytes int64)
+}
+
+// billingSinks are the sinks every billed usage is fanned out to: the
+// built-in sink, then those added with RegisterBillingSink in order.
+var (
+	billingSinks     atomic.Pointer[[]BillingSink]
+	billingSinksLock sync.Mutex
+)
+
+func init() {
+	billingSinks.Store(&[]BillingSink{builtinBillingSink{}})
+}
+
+// RegisterBillingSink adds sink to the sinks receiving the billed usage. It
+// is meant to be called at startup, before the gateway serves requests;
+// usage recorded earlier is not replayed.
+func RegisterBillingSink(sink BillingSink) {
+	billingSinksLock.Lock()
+	defer billingSinksLock.Unlock()
+	sinks := append(append([]BillingSink(nil), *billingSinks.Load()...), sink)
+	billingSinks.Store(&sinks)
+}
+
+// newBillingRecord returns the record of a read or write of object in bucket by
+// accessKey.
+func newBillingRecord(bucket, object, accessKey string) BillingRecord {
+	return BillingRecord{
+		Bucket:    bucket,
+		Account:   bucketAccountLabel(bucket),
+		AccessKey: accessKey,
+		Tier:      classifyTier(bucket, object),
+	}
+}
+
+func billRead(record BillingRecord, n int64) {
+	for _, sink := range *billingSinks.Load() {
+		sink.RecordRead(record, n)
+	}
+}
+
+func billWrite(record BillingRecord, n int64) {
+	for _, sink := range *billingSinks.Load() {
+		sink.RecordWrite(record, n)
+	}
+}
+
+func billBytesSent(record BillingRecord, bytes int64) {
+	for _, sink := range *billingSinks.Load() {
+		sink.RecordBytesSent(record, bytes)
+	}
+}
+
+func billBytesReceived(record BillingRecord, bytes int64) {
+	for _, sink := range *billingSinks.Load() {
+		sink.RecordBytesReceived(record, bytes)
+	}
+}
+
+// builtinBillingSink records the billed usage in the Prometheus billing
+// counters and, when they are enabled, the billing webhook and snapshot.
+type builtinBillingSink struct{}
+
+func (builtinBillingSink) RecordRead(record BillingRecord, n int64) {
+	stats_collect.S3ReadCounter.WithLabelValues(record.Bucket, record.AccessKey, record.Tier).Add(float64(n))
+	billingEmitter.AddReads(record.Bucket, uint64(n))
+	billingSnapshot.AddReads(record.Bucket, uint64(n))
+}
+
+func (builtinBillingSink) RecordWrite(record BillingRecord, n int64) {
+	stats_collect.S3WriteCounter.WithLabelValues(record.Bucket, record.AccessKey, record.Tier, record.StorageClass).Add(float64(n))
+	billingEmitter.AddWrites(record.Bucket, uint64(n))
+	billingSnapshot.AddWrites(record.Bucket, uint64(n))
+}
+
+func (builtinBillingSink) RecordBytesSent(record BillingRecord, bytes int64) {
+	stats_collect.S3BucketTrafficSentBytesCounter.WithLabelValues(record.Bucket, record.Account).Add(float64(bytes))
+	billingEmitter.AddBytesSent(record.Bucket, uint64(bytes))
+	billingSnapshot.AddBytesSent(record.Bucket, uint64(bytes))
+}
+
+func (builtinBillingSink) RecordBytesReceived(record BillingRecord, bytes int64) {
+	stats_collect.S3BucketTrafficReceivedBytesCounter.WithLabelValues(record.Bucket, record.Account).Add(float64(bytes))
+	billingEmitter.AddBytesReceived(record.Bucket, uint64(bytes))
+	billingSnapshot.AddBytesReceived(record.Bucket, uint64(bytes))
+}
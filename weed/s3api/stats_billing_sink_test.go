@@ -0,0 +1,106 @@
+package s3api
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// recordingBillingSink captures the calls of a BillingSink.
+type recordingBillingSink struct {
+	mu                       sync.Mutex
+	reads, writes            map[string]int64
+	bytesSent, bytesReceived map[string]int64
+	lastRead                 BillingRecord
+}
+
+func newRecordingBillingSink() *recordingBillingSink {
+	return &recordingBillingSink{
+		reads:         make(map[string]int64),
+		writes:        make(map[string]int64),
+		bytesSent:     make(map[string]int64),
+		bytesReceived: make(map[string]int64),
+	}
+}
+
+func (s *recordingBillingSink) RecordRead(record BillingRecord, n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reads[record.Bucket] += n
+	s.lastRead = record
+}
+
+func (s *recordingBillingSink) RecordWrite(record BillingRecord, n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writes[record.Bucket] += n
+}
+
+func (s *recordingBillingSink) RecordBytesSent(record BillingRecord, bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bytesSent[record.Bucket] += bytes
+}
+
+func (s *recordingBillingSink) RecordBytesReceived(record BillingRecord, bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bytesReceived[record.Bucket] += bytes
+}
+
+// withBillingSink registers sink for the duration of the test.
+func withBillingSink(t *testing.T, sink BillingSink) {
+	t.Helper()
+	old := billingSinks.Load()
+	RegisterBillingSink(sink)
+	t.Cleanup(func() { billingSinks.Store(old) })
+}
+
+func TestBillingSinksReceiveUsage(t *testing.T) {
+	const bucket = "stats-billing-sink"
+	first, second := newRecordingBillingSink(), newRecordingBillingSink()
+	withBillingSink(t, first)
+	withBillingSink(t, second)
+
+	get := track(func(w http.ResponseWriter, r *http.Request) { w.Write(make([]byte, 10)) }, "GET")
+	put := track(authDisabled(func(w http.ResponseWriter, r *http.Request) { io.Copy(io.Discard, r.Body) }), "PUT")
+	get(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "203.0.113.5:1234"))
+	r := newStatsRequest(http.MethodPut, bucket, "k", "203.0.113.5:1234")
+	r.Body = io.NopCloser(bytes.NewReader(make([]byte, 7)))
+	put(httptest.NewRecorder(), r)
+	BucketTrafficSent(5, newStatsRequest(http.MethodGet, bucket, "k", "203.0.113.5:1234"))
+
+	// Every sink sees all of the usage.
+	for i, sink := range []*recordingBillingSink{first, second} {
+		if got := sink.reads[bucket]; got != 1 {
+			t.Errorf("sink %d: reads = %d, want 1", i, got)
+		}
+		if got := sink.writes[bucket]; got != 1 {
+			t.Errorf("sink %d: writes = %d, want 1", i, got)
+		}
+		if got := sink.bytesSent[bucket]; got != 15 {
+			t.Errorf("sink %d: bytes sent = %d, want 15", i, got)
+		}
+		if got := sink.bytesReceived[bucket]; got != 7 {
+			t.Errorf("sink %d: bytes received = %d, want 7", i, got)
+		}
+	}
+	if got := first.lastRead; got.Bucket != bucket || got.AccessKey != noAccessKey || got.Tier != defaultBillingTier {
+		t.Errorf("read record = %+v", got)
+	}
+
+	// The built-in sink still records the Prometheus counters.
+	if got := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier)); got != 1 {
+		t.Errorf("read counter = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3BucketTrafficSentBytesCounter.WithLabelValues(bucket, noAccount)); got != 15 {
+		t.Errorf("sent bytes counter = %v, want 15", got)
+	}
+}
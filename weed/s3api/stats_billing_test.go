@@ -0,0 +1,88 @@
+package s3api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func withBillingSnapshot(t *testing.T, snapshot *stats_collect.BillingSnapshot) {
+	t.Helper()
+	old := billingSnapshot
+	billingSnapshot = snapshot
+	t.Cleanup(func() { billingSnapshot = old })
+}
+
+func billingUsage(t *testing.T) map[string]stats_collect.BillingUsage {
+	t.Helper()
+	w := httptest.NewRecorder()
+	billingStatusHandler(w, httptest.NewRequest(http.MethodGet, billingStatusPath, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var usage []stats_collect.BillingUsage
+	if err := json.Unmarshal(w.Body.Bytes(), &usage); err != nil {
+		t.Fatalf("decode %s: %v", w.Body.String(), err)
+	}
+	byBucket := make(map[string]stats_collect.BillingUsage)
+	for _, u := range usage {
+		byBucket[u.Bucket] = u
+	}
+	return byBucket
+}
+
+func TestBillingSnapshotHandlers(t *testing.T) {
+	withBillingSnapshot(t, stats_collect.NewBillingSnapshot())
+	const bucket = "stats-billing-snapshot"
+	serve := func(w http.ResponseWriter, r *http.Request) { w.Write(make([]byte, 10)) }
+	get := func() {
+		track(serve, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	}
+	get()
+	get()
+	track(serve, "PUT")(httptest.NewRecorder(), newStatsRequest(http.MethodPut, bucket, "k", "10.0.0.1:1234"))
+
+	got := billingUsage(t)[bucket]
+	if got.Reads != 2 || got.Writes != 1 || got.BytesSent != 30 {
+		t.Errorf("usage = %+v, want 2 reads, 1 write and 30 bytes sent", got)
+	}
+
+	w := httptest.NewRecorder()
+	billingResetHandler(w, httptest.NewRequest(http.MethodPost, billingResetPath, nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("reset status = %d, want 204", w.Code)
+	}
+	if got, ok := billingUsage(t)[bucket]; ok {
+		t.Errorf("usage after reset = %+v, want none", got)
+	}
+
+	get()
+	got = billingUsage(t)[bucket]
+	if got.Reads != 1 || got.Writes != 0 || got.BytesSent != 10 {
+		t.Errorf("usage after reset and read = %+v, want 1 read and 10 bytes sent", got)
+	}
+}
+
+func TestBillingSnapshotHandlersMethodsAndDisabled(t *testing.T) {
+	withBillingSnapshot(t, stats_collect.NewBillingSnapshot())
+	w := httptest.NewRecorder()
+	billingResetHandler(w, httptest.NewRequest(http.MethodGet, billingResetPath, nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET reset status = %d, want 405", w.Code)
+	}
+	w = httptest.NewRecorder()
+	billingStatusHandler(w, httptest.NewRequest(http.MethodPost, billingStatusPath, nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want 405", w.Code)
+	}
+
+	withBillingSnapshot(t, nil)
+	w = httptest.NewRecorder()
+	billingResetHandler(w, httptest.NewRequest(http.MethodPost, billingResetPath, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("reset status without snapshot = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,52 @@
+package s3api
+
+import (
+	"net/http"
+	"net/netip"
+	"sync/atomic"
+
+	"go4.org/netipx"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+)
+
+// blockedSet holds the client networks whose requests are rejected before
+// they reach a handler. It is loaded from S3_BLOCKED_CIDRS, in the
+// S3_INTERNAL_CIDRS format, and swapped atomically by ReloadBlockedCIDRs.
+var blockedSet atomic.Pointer[netipx.IPSet]
+
+// blockedPrefixes are the configured S3_BLOCKED_CIDRS prefixes. They only
+// label blocked requests, so the label is the CIDR an operator listed.
+var blockedPrefixes atomic.Pointer[[]netip.Prefix]
+
+func init() {
+	ReloadBlockedCIDRs()
+}
+
+// ReloadBlockedCIDRs rebuilds the blocked set from S3_BLOCKED_CIDRS and
+// replaces it. It is registered as a SIGHUP reload hook.
+func ReloadBlockedCIDRs() {
+	prefixes, excluded := readIPSetEnv("S3_BLOCKED_CIDRS")
+	blockedPrefixes.Store(&prefixes)
+	blockedSet.Store(buildIPSet(prefixes, excluded))
+	glog.V(1).Infof("loaded %d blocked CIDRs for s3 requests", len(prefixes)+len(excluded))
+}
+
+// blockedClient reports whether the client of r is in the blocked set and
+// returns the configured prefix it matched. The client is resolved with
+// getClientIP, so forwarded addresses are only used from trusted proxies.
+func blockedClient(r *http.Request) (netip.Prefix, bool) {
+	if len(*blockedPrefixes.Load()) == 0 {
+		return netip.Prefix{}, false
+	}
+	set := blockedSet.Load()
+	client, _ := requestClientIP(r)
+	if !ipSetContains(set, client) {
+		return netip.Prefix{}, false
+	}
+	if prefix, ok := matchingPrefix(client, *blockedPrefixes.Load()); ok {
+		return prefix, true
+	}
+	// The prefixes were replaced by a concurrent reload.
+	return matchingPrefix(client, set.Prefixes())
+}
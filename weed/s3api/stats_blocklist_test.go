@@ -0,0 +1,72 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// withBlockedCIDRs loads cidrs as the blocked set for the duration of the test.
+func withBlockedCIDRs(t *testing.T, cidrs string) {
+	t.Helper()
+	t.Cleanup(ReloadBlockedCIDRs)
+	t.Setenv("S3_BLOCKED_CIDRS", cidrs)
+	ReloadBlockedCIDRs()
+}
+
+func TestTrackRejectsBlockedClients(t *testing.T) {
+	withBlockedCIDRs(t, "203.0.113.0/24,!203.0.113.7")
+	withTrustedProxies(t, 1, "10.0.0.0/8")
+	const bucket = "stats-blocked"
+	blocked := stats_collect.S3BlockedRequestCounter.WithLabelValues("203.0.113.0/24")
+	before := testutil.ToFloat64(blocked)
+
+	tests := []struct {
+		name, remoteAddr, xff string
+		blocked               bool
+	}{
+		{"blocked peer", "203.0.113.5:1234", "", true},
+		{"excluded peer", "203.0.113.7:1234", "", false},
+		{"allowed peer", "198.51.100.1:1234", "", false},
+		{"blocked client behind trusted proxy", "10.0.0.1:1234", "203.0.113.9", true},
+		{"forwarded address from untrusted peer", "198.51.100.1:1234", "203.0.113.9", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := func(w http.ResponseWriter, r *http.Request) { called = true }
+			r := newStatsRequest(http.MethodGet, bucket, "k", tt.remoteAddr)
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			w := httptest.NewRecorder()
+			track(handler, "GET")(w, r)
+			if called == tt.blocked {
+				t.Errorf("handler called = %v, want %v", called, !tt.blocked)
+			}
+			if tt.blocked && w.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want 403", w.Code)
+			}
+		})
+	}
+	if got := testutil.ToFloat64(blocked) - before; got != 2 {
+		t.Errorf("blocked requests = %v, want 2", got)
+	}
+}
+
+func TestReloadBlockedCIDRs(t *testing.T) {
+	withBlockedCIDRs(t, "")
+	r := newStatsRequest(http.MethodGet, "b", "k", "203.0.113.5:1234")
+	if _, blocked := blockedClient(r); blocked {
+		t.Fatal("client blocked by an empty set")
+	}
+	t.Setenv("S3_BLOCKED_CIDRS", "203.0.113.0/24")
+	ReloadBlockedCIDRs()
+	if prefix, blocked := blockedClient(r); !blocked || prefix.String() != "203.0.113.0/24" {
+		t.Errorf("blockedClient() = %v, %v after reload, want 203.0.113.0/24, true", prefix, blocked)
+	}
+}
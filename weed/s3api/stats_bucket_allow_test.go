@@ -0,0 +1,76 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// withBucketAllowCIDRs loads config as the bucket allow-lists for the
+// duration of the test.
+func withBucketAllowCIDRs(t *testing.T, config string) {
+	t.Helper()
+	t.Cleanup(ReloadBucketAllowCIDRs)
+	t.Setenv("S3_BUCKET_ALLOW_CIDRS", config)
+	ReloadBucketAllowCIDRs()
+}
+
+func TestParseBucketAllowCIDRs(t *testing.T) {
+	lists := parseBucketAllowCIDRs(" a=10.0.0.0/8, a=192.168.0.0/16;!192.168.7.0/24 ,b=bogus, =10.0.0.0/8, c")
+	if len(lists) != 2 {
+		t.Fatalf("restricted buckets = %d, want 2", len(lists))
+	}
+	for addr, allowed := range map[string]bool{"10.1.2.3": true, "192.168.1.1": true, "192.168.7.1": false, "203.0.113.5": false} {
+		if got := lists["a"].Contains(netip.MustParseAddr(addr)); got != allowed {
+			t.Errorf("a contains %s = %v, want %v", addr, got, allowed)
+		}
+	}
+	if got := len(lists["b"].Prefixes()); got != 0 {
+		t.Errorf("b prefixes = %d, want 0", got)
+	}
+}
+
+func TestTrackEnforcesBucketAllowLists(t *testing.T) {
+	withBucketAllowCIDRs(t, "stats-allow-secret=10.0.0.0/8,stats-allow-empty=bogus")
+	denied := stats_collect.S3BucketIPDeniedCounter.WithLabelValues("stats-allow-secret")
+	before := testutil.ToFloat64(denied)
+
+	tests := []struct {
+		name, bucket, remoteAddr string
+		allowed                  bool
+	}{
+		{"allowed", "stats-allow-secret", "10.1.2.3:1234", true},
+		{"denied", "stats-allow-secret", "203.0.113.5:1234", false},
+		{"unconfigured", "stats-allow-public", "203.0.113.5:1234", true},
+		{"only invalid CIDRs", "stats-allow-empty", "10.1.2.3:1234", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := func(w http.ResponseWriter, r *http.Request) { called = true }
+			w := httptest.NewRecorder()
+			track(handler, "GET")(w, newStatsRequest(http.MethodGet, tt.bucket, "k", tt.remoteAddr))
+			if called != tt.allowed {
+				t.Errorf("handler called = %v, want %v", called, tt.allowed)
+			}
+			if !tt.allowed && w.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want 403", w.Code)
+			}
+		})
+	}
+	if got := testutil.ToFloat64(denied) - before; got != 1 {
+		t.Errorf("denied requests = %v, want 1", got)
+	}
+
+	// Reloading lifts the restriction.
+	t.Setenv("S3_BUCKET_ALLOW_CIDRS", "")
+	ReloadBucketAllowCIDRs()
+	if bucketIPDenied(newStatsRequest(http.MethodGet, "stats-allow-secret", "k", "203.0.113.5:1234"), "stats-allow-secret") {
+		t.Error("bucket still restricted after reload")
+	}
+}
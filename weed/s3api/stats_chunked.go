@@ -0,0 +1,24 @@
+package s3api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// isChunkedUpload reports whether the body of r is in the aws-chunked
+// encoding of streaming uploads, which track counts separately because
+// decoding it, and verifying the signature of every chunk, costs more CPU
+// than a plain body.
+func isChunkedUpload(r *http.Request) bool {
+	if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return true
+	}
+	for _, encoding := range r.Header.Values("Content-Encoding") {
+		for _, part := range strings.Split(encoding, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), "aws-chunked") {
+				return true
+			}
+		}
+	}
+	return false
+}
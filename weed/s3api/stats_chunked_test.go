@@ -0,0 +1,45 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func TestTrackCountsChunkedUploads(t *testing.T) {
+	const bucket = "stats-chunked-upload"
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	tests := []struct {
+		name    string
+		headers map[string]string
+		chunked bool
+	}{
+		{"signed streaming", map[string]string{"X-Amz-Content-Sha256": streamingContentSHA256}, true},
+		{"signed streaming with trailer", map[string]string{"X-Amz-Content-Sha256": streamingContentSHA256Trailer}, true},
+		{"unsigned streaming", map[string]string{"X-Amz-Content-Sha256": streamingUnsignedPayload}, true},
+		{"content encoding", map[string]string{"Content-Encoding": "gzip, AWS-Chunked"}, true},
+		{"signed payload", map[string]string{"X-Amz-Content-Sha256": "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"}, false},
+		{"unsigned payload", map[string]string{"X-Amz-Content-Sha256": "UNSIGNED-PAYLOAD"}, false},
+		{"plain", nil, false},
+	}
+	for _, tt := range tests {
+		counter := stats_collect.S3ChunkedUploadCounter.WithLabelValues(bucket)
+		before := testutil.ToFloat64(counter)
+		r := newStatsRequest(http.MethodPut, bucket, "k", "203.0.113.5:1234")
+		for name, value := range tt.headers {
+			r.Header.Set(name, value)
+		}
+		track(ok, "PUT")(httptest.NewRecorder(), r)
+		want := 0.0
+		if tt.chunked {
+			want = 1
+		}
+		if got := testutil.ToFloat64(counter) - before; got != want {
+			t.Errorf("%s: chunked uploads = %v, want %v", tt.name, got, want)
+		}
+	}
+}
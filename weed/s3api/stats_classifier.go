@@ -0,0 +1,91 @@
+package s3api
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// RequestClass is the billing class of an S3 request, as returned by a
+// Classifier.
+type RequestClass = rwClass
+
+// The built-in request classes.
+const (
+	ClassOther = rwOther
+	ClassRead  = rwRead
+	ClassWrite = rwWrite
+	ClassList  = rwList
+	ClassHead  = rwHead
+	// ClassPreflight is a CORS preflight OPTIONS request.
+	ClassPreflight = rwPreflight
+	// ClassMetadata reads or changes bucket configuration or ACLs.
+	ClassMetadata = rwMetadata
+)
+
+// Classifier assigns the billing class of a request. s3Action is the
+// canonical S3 action of the request, such as s3:GetObject, resolved once by
+// track; it is empty for service-level requests such as ListBuckets, STS and
+// IAM.
+type Classifier func(s3Action string, r *http.Request) RequestClass
+
+var requestClassifier atomic.Pointer[Classifier]
+
+// RegisterClassifier replaces the classifier used by track. Exactly one
+// classifier is in effect: the last one registered wins, and it must handle
+// every request, typically by falling back to DefaultClassifier. Passing nil
+// restores DefaultClassifier. Register it at startup, before serving.
+func RegisterClassifier(c Classifier) {
+	if c == nil {
+		requestClassifier.Store(nil)
+		return
+	}
+	requestClassifier.Store(&c)
+}
+
+// DefaultClassifier is the built-in classifier.
+func DefaultClassifier(s3Action string, r *http.Request) RequestClass {
+	return classifyReadWrite(s3Action, r)
+}
+
+// classifyRequest classifies r, whose S3 action is s3Action, with the
+// registered classifier.
+func classifyRequest(s3Action string, r *http.Request) rwClass {
+	if c := requestClassifier.Load(); c != nil {
+		return (*c)(s3Action, r)
+	}
+	return classifyReadWrite(s3Action, r)
+}
+
+var (
+	customClassesLock sync.RWMutex
+	customClassNames  []string
+)
+
+// RegisterRequestClass returns a new request class named name, for
+// classifiers that bill some requests separately from the built-in classes.
+// Custom classes are counted in S3CustomClassCounter. Registering a name
+// twice returns the same class.
+func RegisterRequestClass(name string) RequestClass {
+	customClassesLock.Lock()
+	defer customClassesLock.Unlock()
+	for i, existing := range customClassNames {
+		if existing == name {
+			return rwMetadata + 1 + rwClass(i)
+		}
+	}
+	customClassNames = append(customClassNames, name)
+	return rwMetadata + rwClass(len(customClassNames))
+}
+
+// customClassName returns the name of a class returned by
+// RegisterRequestClass.
+func customClassName(c rwClass) (string, bool) {
+	i := int(c - rwMetadata - 1)
+	customClassesLock.RLock()
+	defer customClassesLock.RUnlock()
+	if i < 0 || i >= len(customClassNames) {
+		return "", false
+	}
+	return customClassNames[i], true
+}
@@ -0,0 +1,65 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/seaweedfs/seaweedfs/weed/s3api/s3_constants"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func TestRegisterClassifier(t *testing.T) {
+	const bucket = "stats-custom-classifier"
+	restore := RegisterRequestClass("restore")
+	if again := RegisterRequestClass("restore"); again != restore {
+		t.Fatalf("registering restore twice returned %v and %v", restore, again)
+	}
+	if restore.String() != "restore" {
+		t.Fatalf("custom class String() = %q, want restore", restore.String())
+	}
+	var actions []string
+	RegisterClassifier(func(s3Action string, r *http.Request) RequestClass {
+		actions = append(actions, s3Action)
+		if r.Method == http.MethodPost && r.URL.Query().Has("restore") {
+			return restore
+		}
+		return DefaultClassifier(s3Action, r)
+	})
+	t.Cleanup(func() { RegisterClassifier(nil) })
+
+	var inFlight []float64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		inFlight = append(inFlight, testutil.ToFloat64(stats_collect.S3InFlightByClass.WithLabelValues("restore")))
+	}
+	restores := stats_collect.S3CustomClassCounter.WithLabelValues(bucket, "restore")
+	writes := stats_collect.S3WriteCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier, defaultStorageClass)
+	restoresBefore, writesBefore := testutil.ToFloat64(restores), testutil.ToFloat64(writes)
+
+	restoreRequest := newStatsRequest(http.MethodPost, bucket, "k", "10.0.0.1:1234")
+	restoreRequest.URL.RawQuery = "restore"
+	track(handler, "POST")(httptest.NewRecorder(), restoreRequest)
+	track(handler, "PUT")(httptest.NewRecorder(), newStatsRequest(http.MethodPut, bucket, "k", "10.0.0.1:1234"))
+
+	if got := testutil.ToFloat64(restores) - restoresBefore; got != 1 {
+		t.Errorf("restore requests = %v, want 1", got)
+	}
+	if want := []string{s3_constants.S3_ACTION_PUT_OBJECT, s3_constants.S3_ACTION_PUT_OBJECT}; !slices.Equal(actions, want) {
+		t.Errorf("classified actions = %v, want %v", actions, want)
+	}
+	if got := testutil.ToFloat64(writes) - writesBefore; got != 1 {
+		t.Errorf("writes = %v, want the PUT classified by the default", got)
+	}
+	if len(inFlight) != 2 || inFlight[0] != 1 || inFlight[1] != 0 {
+		t.Errorf("restore requests in flight during the restore and the PUT = %v, want [1 0]", inFlight)
+	}
+
+	RegisterClassifier(nil)
+	track(handler, "POST")(httptest.NewRecorder(), restoreRequest)
+	if got := testutil.ToFloat64(restores) - restoresBefore; got != 1 {
+		t.Errorf("restore requests after restoring the default = %v, want 1", got)
+	}
+}
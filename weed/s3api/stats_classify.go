@@ -0,0 +1,230 @@
+package s3api
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/seaweedfs/seaweedfs/weed/s3api/s3_constants"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// billConditionalWriteAsRead makes a conditional write also count as a read,
+// since the server has to read the current object to evaluate the condition.
+var billConditionalWriteAsRead = envBool("S3_BILL_CONDITIONAL_WRITE_AS_READ", true)
+
+// rwClass is the billing class of an S3 request.
+type rwClass int
+
+const (
+	rwOther rwClass = iota
+	rwRead
+	rwWrite
+	rwList
+	rwHead
+	rwPreflight
+	rwMetadata
+)
+
+func (c rwClass) String() string {
+	switch c {
+	case rwRead:
+		return "read"
+	case rwWrite:
+		return "write"
+	case rwList:
+		return "list"
+	case rwHead:
+		return "head"
+	case rwPreflight:
+		return "preflight"
+	case rwMetadata:
+		return "metadata"
+	}
+	if name, ok := customClassName(c); ok {
+		return name
+	}
+	return "other"
+}
+
+// actionClasses maps every S3 action the gateway resolves to its billing class.
+// Actions missing here are classified by HTTP method, which never yields
+// rwList: listing is a GET and indistinguishable from a read by method alone.
+// Reading and changing bucket configuration and ACLs is rwMetadata, priced
+// apart from the object data operations.
+var actionClasses = map[string]rwClass{
+	s3_constants.S3_ACTION_GET_OBJECT:            rwRead,
+	s3_constants.S3_ACTION_GET_OBJECT_VERSION:    rwRead,
+	s3_constants.S3_ACTION_GET_OBJECT_ACL:        rwMetadata,
+	s3_constants.S3_ACTION_GET_OBJECT_TAGGING:    rwRead,
+	s3_constants.S3_ACTION_GET_OBJECT_RETENTION:  rwRead,
+	s3_constants.S3_ACTION_GET_OBJECT_LEGAL_HOLD: rwRead,
+	s3_constants.S3_ACTION_PUT_OBJECT:            rwWrite,
+	s3_constants.S3_ACTION_DELETE_OBJECT:         rwWrite,
+	s3_constants.S3_ACTION_DELETE_OBJECT_VERSION: rwWrite,
+	s3_constants.S3_ACTION_PUT_OBJECT_ACL:        rwMetadata,
+	s3_constants.S3_ACTION_PUT_OBJECT_TAGGING:    rwWrite,
+	s3_constants.S3_ACTION_DELETE_OBJECT_TAGGING: rwWrite,
+	s3_constants.S3_ACTION_PUT_OBJECT_RETENTION:  rwWrite,
+	s3_constants.S3_ACTION_PUT_OBJECT_LEGAL_HOLD: rwWrite,
+	s3_constants.S3_ACTION_BYPASS_GOVERNANCE:     rwOther,
+
+	s3_constants.S3_ACTION_CREATE_MULTIPART:   rwWrite,
+	s3_constants.S3_ACTION_UPLOAD_PART:        rwWrite,
+	s3_constants.S3_ACTION_COMPLETE_MULTIPART: rwWrite,
+	s3_constants.S3_ACTION_ABORT_MULTIPART:    rwWrite,
+	s3_constants.S3_ACTION_LIST_PARTS:         rwList,
+
+	s3_constants.S3_ACTION_CREATE_BUCKET:          rwWrite,
+	s3_constants.S3_ACTION_DELETE_BUCKET:          rwWrite,
+	s3_constants.S3_ACTION_LIST_BUCKET:            rwList,
+	s3_constants.S3_ACTION_LIST_BUCKET_VERSIONS:   rwList,
+	s3_constants.S3_ACTION_LIST_MULTIPART_UPLOADS: rwList,
+
+	s3_constants.S3_ACTION_GET_BUCKET_ACL:          rwMetadata,
+	s3_constants.S3_ACTION_PUT_BUCKET_ACL:          rwMetadata,
+	s3_constants.S3_ACTION_GET_BUCKET_POLICY:       rwMetadata,
+	s3_constants.S3_ACTION_PUT_BUCKET_POLICY:       rwMetadata,
+	s3_constants.S3_ACTION_DELETE_BUCKET_POLICY:    rwMetadata,
+	s3_constants.S3_ACTION_GET_BUCKET_TAGGING:      rwMetadata,
+	s3_constants.S3_ACTION_PUT_BUCKET_TAGGING:      rwMetadata,
+	s3_constants.S3_ACTION_DELETE_BUCKET_TAGGING:   rwMetadata,
+	s3_constants.S3_ACTION_GET_BUCKET_CORS:         rwMetadata,
+	s3_constants.S3_ACTION_PUT_BUCKET_CORS:         rwMetadata,
+	s3_constants.S3_ACTION_DELETE_BUCKET_CORS:      rwMetadata,
+	s3_constants.S3_ACTION_GET_BUCKET_LIFECYCLE:    rwMetadata,
+	s3_constants.S3_ACTION_PUT_BUCKET_LIFECYCLE:    rwMetadata,
+	s3_constants.S3_ACTION_GET_BUCKET_VERSIONING:   rwMetadata,
+	s3_constants.S3_ACTION_PUT_BUCKET_VERSIONING:   rwMetadata,
+	s3_constants.S3_ACTION_GET_BUCKET_LOCATION:     rwMetadata,
+	s3_constants.S3_ACTION_GET_BUCKET_NOTIFICATION: rwMetadata,
+	s3_constants.S3_ACTION_PUT_BUCKET_NOTIFICATION: rwMetadata,
+	s3_constants.S3_ACTION_GET_BUCKET_OBJECT_LOCK:  rwMetadata,
+	s3_constants.S3_ACTION_PUT_BUCKET_OBJECT_LOCK:  rwMetadata,
+
+	s3_constants.S3_ACTION_ALL: rwOther,
+}
+
+// classifyReadWrite returns the billing class of r. HEAD requests transfer no
+// body and are billed as rwHead, CORS preflight OPTIONS requests are
+// rwPreflight, and protocol upgrades, which hold a connection open instead of
+// serving a request, are rwOther. Other requests are classified by their
+// canonical S3 action, s3Action, in actionClasses; service-level requests
+// (ListBuckets, STS, IAM) and unknown actions fall back to the HTTP method.
+// Unknown actions are also counted in S3UnclassifiedActionCounter.
+func classifyReadWrite(s3Action string, r *http.Request) rwClass {
+	if r.Method == http.MethodHead {
+		return rwHead
+	}
+	if r.Method == http.MethodOptions {
+		return rwPreflight
+	}
+	if isUpgradeRequest(r) {
+		return rwOther
+	}
+	if class, ok := actionClasses[s3Action]; ok {
+		return class
+	}
+	if s3Action != "" {
+		recordUnclassifiedAction(s3Action)
+	}
+	return classifyByMethod(r.Method)
+}
+
+// maxUnclassifiedActions caps the distinct action labels of
+// S3UnclassifiedActionCounter; further actions are counted as "overflow".
+const maxUnclassifiedActions = 64
+
+var (
+	unclassifiedActionsLock sync.Mutex
+	unclassifiedActions     = make(map[string]struct{})
+)
+
+// recordUnclassifiedAction counts a resolved S3 action missing from
+// actionClasses, which means the map needs a new entry.
+func recordUnclassifiedAction(action string) {
+	unclassifiedActionsLock.Lock()
+	if _, seen := unclassifiedActions[action]; !seen {
+		if len(unclassifiedActions) < maxUnclassifiedActions {
+			unclassifiedActions[action] = struct{}{}
+		} else {
+			action = "overflow"
+		}
+	}
+	unclassifiedActionsLock.Unlock()
+	stats_collect.S3UnclassifiedActionCounter.WithLabelValues(action).Inc()
+}
+
+// requestS3Action resolves the canonical S3 action of a bucket or object
+// request, or "" for service-level requests.
+func requestS3Action(r *http.Request) string {
+	bucket, object := s3_constants.GetBucketAndObject(r)
+	if bucket == "" {
+		return ""
+	}
+	var baseAction string
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		baseAction = s3_constants.ACTION_READ
+	case http.MethodPut, http.MethodPost:
+		baseAction = s3_constants.ACTION_WRITE
+	case http.MethodDelete:
+		baseAction = s3_constants.ACTION_WRITE
+		if object == "" {
+			baseAction = s3_constants.ACTION_DELETE_BUCKET
+		}
+	default:
+		return ""
+	}
+	return ResolveS3Action(r, baseAction, bucket, object)
+}
+
+func classifyByMethod(method string) rwClass {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return rwRead
+	case http.MethodPut, http.MethodPost, http.MethodDelete, http.MethodPatch:
+		return rwWrite
+	default:
+		return rwOther
+	}
+}
+
+// isUpgradeRequest reports whether r asks to switch protocols, such as to a
+// WebSocket, with an Upgrade header or an "upgrade" Connection option.
+func isUpgradeRequest(r *http.Request) bool {
+	if r.Header.Get("Upgrade") != "" {
+		return true
+	}
+	for _, value := range r.Header.Values("Connection") {
+		for _, option := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(option), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isConditional reports whether r carries an HTTP precondition header.
+func isConditional(r *http.Request) bool {
+	return r.Header.Get(s3_constants.IfMatch) != "" ||
+		r.Header.Get(s3_constants.IfNoneMatch) != "" ||
+		r.Header.Get(s3_constants.IfModifiedSince) != "" ||
+		r.Header.Get(s3_constants.IfUnmodifiedSince) != ""
+}
+
+// trackConditionalRead counts conditional GET and HEAD requests and those of
+// them answered with 304 Not Modified, whose ratio is the hit ratio of the
+// clients' caches.
+func trackConditionalRead(r *http.Request, status int, bucket string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return
+	}
+	if isConditional(r) {
+		stats_collect.S3ConditionalReadCounter.WithLabelValues(bucket).Inc()
+	}
+	if status == http.StatusNotModified {
+		stats_collect.S3NotModifiedCounter.WithLabelValues(bucket).Inc()
+	}
+}
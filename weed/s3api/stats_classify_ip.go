@@ -0,0 +1,93 @@
+package s3api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/netip"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+)
+
+const classifyIPPath = "/status/s3/classify-ip"
+
+// ipClassification explains how the traffic metrics classify an address.
+type ipClassification struct {
+	// Peer is the address the request was received from.
+	Peer string `json:"peer"`
+	// TrustedProxy is whether Peer is a trusted proxy whose forwarding
+	// headers are used.
+	TrustedProxy bool `json:"trusted_proxy"`
+	// ClientIP is the client address resolved from Peer and the sample
+	// X-Forwarded-For header.
+	ClientIP string `json:"client_ip"`
+	// Internal is whether traffic from ClientIP is counted as internal.
+	Internal bool `json:"internal"`
+	// Network is the network class of ClientIP: "internal", "semi" or
+	// "external".
+	Network string `json:"network"`
+	// Match is the prefix of the loaded internal set containing ClientIP,
+	// or "private" when it is internal because of
+	// S3_TREAT_PRIVATE_AS_INTERNAL. Exclusions are already removed from the
+	// set, so Match may be narrower than the configured CIDR.
+	Match string `json:"match,omitempty"`
+	// Excluded is the '!' exclusion containing ClientIP, if any.
+	Excluded string `json:"excluded,omitempty"`
+	// Group is the S3_INTERNAL_CIDRS_GROUPED group of ClientIP, if any.
+	Group string `json:"group,omitempty"`
+}
+
+// classifyIP resolves the client of a request received from peer with the
+// given X-Forwarded-For header, and classifies it against the currently
+// loaded internal and trusted proxy sets, the same way the request metrics do.
+func classifyIP(peer netip.Addr, xff string) ipClassification {
+	r := &http.Request{Header: make(http.Header), RemoteAddr: netip.AddrPortFrom(peer, 0).String()}
+	if xff != "" {
+		r.Header.Set("X-Forwarded-For", xff)
+	}
+	peer = peer.Unmap()
+	client := getClientIP(r)
+	result := ipClassification{
+		Peer:         peer.String(),
+		TrustedProxy: isTrustedPeer(peer),
+		ClientIP:     client.String(),
+		Network:      classifyNetwork(client),
+	}
+	if group := clientGroup(client); group != noClientGroup {
+		result.Group = group
+	}
+	result.Internal = result.Network == networkInternal
+	if excluded := internalExcludedSet.Load(); ipSetContains(excluded, client) {
+		if prefix, ok := matchingPrefix(client, excluded.Prefixes()); ok {
+			result.Excluded = prefix.String()
+		}
+		return result
+	}
+	if set := internalSet.Load(); ipSetContains(set, client) {
+		if prefix, ok := matchingPrefix(client, set.Prefixes()); ok {
+			result.Match = prefix.String()
+		}
+	}
+	if result.Internal && result.Match == "" {
+		result.Match = "private"
+	}
+	return result
+}
+
+// classifyIPHandler serves classifyIP for the addr and xff query parameters,
+// so operators can check a CIDR configuration before relying on it.
+func classifyIPHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	addr, ok := parseForwardedAddr(query.Get("addr"))
+	if !ok {
+		http.Error(w, "addr must be an IP address", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(classifyIP(addr, query.Get("xff"))); err != nil {
+		glog.V(1).Infof("write ip classification: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package s3api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClassifyIP(t *testing.T) {
+	withPrivateAsInternal(t, true)
+	withInternalCIDRs(t, "198.51.100.0/24,!198.51.100.128/25,10.8.8.0/24 !10.8.8.8")
+	withSemiInternalCIDRs(t, "203.0.113.4/30")
+	withTrustedProxies(t, 1, "10.0.0.0/8")
+	tests := []struct {
+		peer, xff string
+		want      ipClassification
+	}{
+		{"198.51.100.7", "", ipClassification{Peer: "198.51.100.7", ClientIP: "198.51.100.7", Network: networkInternal, Internal: true, Match: "198.51.100.0/25"}},
+		{"198.51.100.200", "", ipClassification{Peer: "198.51.100.200", ClientIP: "198.51.100.200", Network: networkExternal, Excluded: "198.51.100.128/25"}},
+		{"203.0.113.5", "", ipClassification{Peer: "203.0.113.5", ClientIP: "203.0.113.5", Network: networkSemi}},
+		{"::ffff:203.0.113.5", "", ipClassification{Peer: "203.0.113.5", ClientIP: "203.0.113.5", Network: networkSemi}},
+		{"203.0.113.77", "", ipClassification{Peer: "203.0.113.77", ClientIP: "203.0.113.77", Network: networkExternal}},
+		{"192.168.1.1", "", ipClassification{Peer: "192.168.1.1", ClientIP: "192.168.1.1", Network: networkInternal, Internal: true, Match: "private"}},
+		{"10.8.8.8", "", ipClassification{Peer: "10.8.8.8", TrustedProxy: true, ClientIP: "10.8.8.8", Network: networkExternal, Excluded: "10.8.8.8/32"}},
+		{"10.0.0.1", "198.51.100.7", ipClassification{Peer: "10.0.0.1", TrustedProxy: true, ClientIP: "198.51.100.7", Network: networkInternal, Internal: true, Match: "198.51.100.0/25"}},
+		{"10.0.0.1", "203.0.113.5", ipClassification{Peer: "10.0.0.1", TrustedProxy: true, ClientIP: "203.0.113.5", Network: networkSemi}},
+		{"203.0.113.9", "198.51.100.7", ipClassification{Peer: "203.0.113.9", ClientIP: "203.0.113.9", Network: networkExternal}},
+	}
+	for _, tt := range tests {
+		got := classifyIP(netip.MustParseAddr(tt.peer), tt.xff)
+		if got != tt.want {
+			t.Errorf("classifyIP(%s, %q) = %+v, want %+v", tt.peer, tt.xff, got, tt.want)
+		}
+		if got.Internal != _isInternal(netip.MustParseAddr(got.ClientIP)) {
+			t.Errorf("classifyIP(%s, %q).Internal disagrees with _isInternal", tt.peer, tt.xff)
+		}
+	}
+}
+
+func TestClassifyIPHandler(t *testing.T) {
+	withPrivateAsInternal(t, false)
+	withInternalCIDRs(t, "10.0.0.0/8")
+	withTrustedProxies(t, 1, "10.0.0.0/8")
+
+	w := httptest.NewRecorder()
+	classifyIPHandler(w, httptest.NewRequest(http.MethodGet, classifyIPPath+"?addr=10.0.0.1&xff=10.1.2.3", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var got ipClassification
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode %s: %v", w.Body.String(), err)
+	}
+	want := ipClassification{Peer: "10.0.0.1", TrustedProxy: true, ClientIP: "10.1.2.3", Network: networkInternal, Internal: true, Match: "10.0.0.0/8"}
+	if got != want {
+		t.Errorf("classification = %+v, want %+v", got, want)
+	}
+
+	for _, target := range []string{classifyIPPath, classifyIPPath + "?addr=bogus"} {
+		w = httptest.NewRecorder()
+		classifyIPHandler(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", target, w.Code)
+		}
+	}
+	w = httptest.NewRecorder()
+	classifyIPHandler(w, httptest.NewRequest(http.MethodPost, classifyIPPath+"?addr=10.0.0.1", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status = %d, want 405", w.Code)
+	}
+}
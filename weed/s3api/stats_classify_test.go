@@ -0,0 +1,244 @@
+package s3api
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/seaweedfs/seaweedfs/weed/s3api/s3_constants"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// s3ActionConstants returns the values of the S3_ACTION_* string constants
+// declared in the s3_constants package, keyed by constant name.
+func s3ActionConstants(t *testing.T) map[string]string {
+	t.Helper()
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, "s3_constants", func(fi fs.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := make(map[string]string)
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.CONST {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					value := spec.(*ast.ValueSpec)
+					for i, name := range value.Names {
+						if !strings.HasPrefix(name.Name, "S3_ACTION_") {
+							continue
+						}
+						lit, ok := value.Values[i].(*ast.BasicLit)
+						if !ok || lit.Kind != token.STRING {
+							t.Fatalf("%s: %s is not a string literal", fset.Position(name.Pos()), name.Name)
+						}
+						actions[name.Name], err = strconv.Unquote(lit.Value)
+						if err != nil {
+							t.Fatalf("%s: %v", fset.Position(lit.Pos()), err)
+						}
+					}
+				}
+			}
+		}
+	}
+	if len(actions) == 0 {
+		t.Fatal("found no S3_ACTION_ constants")
+	}
+	return actions
+}
+
+func TestActionClassesCoverKnownActions(t *testing.T) {
+	// Every S3 action constant must have an explicit billing class.
+	for name, action := range s3ActionConstants(t) {
+		if _, ok := actionClasses[action]; !ok {
+			t.Errorf("s3_constants.%s (%s) has no billing class in actionClasses", name, action)
+		}
+	}
+
+	// The expected classes. Add new constants here together with their
+	// entry in actionClasses.
+	want := map[string]rwClass{
+		s3_constants.S3_ACTION_GET_OBJECT:            rwRead,
+		s3_constants.S3_ACTION_PUT_OBJECT:            rwWrite,
+		s3_constants.S3_ACTION_DELETE_OBJECT:         rwWrite,
+		s3_constants.S3_ACTION_DELETE_OBJECT_VERSION: rwWrite,
+		s3_constants.S3_ACTION_GET_OBJECT_VERSION:    rwRead,
+		s3_constants.S3_ACTION_GET_OBJECT_ACL:        rwMetadata,
+		s3_constants.S3_ACTION_PUT_OBJECT_ACL:        rwMetadata,
+		s3_constants.S3_ACTION_GET_OBJECT_TAGGING:    rwRead,
+		s3_constants.S3_ACTION_PUT_OBJECT_TAGGING:    rwWrite,
+		s3_constants.S3_ACTION_DELETE_OBJECT_TAGGING: rwWrite,
+		s3_constants.S3_ACTION_GET_OBJECT_RETENTION:  rwRead,
+		s3_constants.S3_ACTION_PUT_OBJECT_RETENTION:  rwWrite,
+		s3_constants.S3_ACTION_GET_OBJECT_LEGAL_HOLD: rwRead,
+		s3_constants.S3_ACTION_PUT_OBJECT_LEGAL_HOLD: rwWrite,
+		s3_constants.S3_ACTION_BYPASS_GOVERNANCE:     rwOther,
+
+		s3_constants.S3_ACTION_CREATE_MULTIPART:   rwWrite,
+		s3_constants.S3_ACTION_UPLOAD_PART:        rwWrite,
+		s3_constants.S3_ACTION_COMPLETE_MULTIPART: rwWrite,
+		s3_constants.S3_ACTION_ABORT_MULTIPART:    rwWrite,
+		s3_constants.S3_ACTION_LIST_PARTS:         rwList,
+
+		s3_constants.S3_ACTION_CREATE_BUCKET:          rwWrite,
+		s3_constants.S3_ACTION_DELETE_BUCKET:          rwWrite,
+		s3_constants.S3_ACTION_LIST_BUCKET:            rwList,
+		s3_constants.S3_ACTION_LIST_BUCKET_VERSIONS:   rwList,
+		s3_constants.S3_ACTION_LIST_MULTIPART_UPLOADS: rwList,
+
+		s3_constants.S3_ACTION_GET_BUCKET_ACL:          rwMetadata,
+		s3_constants.S3_ACTION_PUT_BUCKET_ACL:          rwMetadata,
+		s3_constants.S3_ACTION_GET_BUCKET_POLICY:       rwMetadata,
+		s3_constants.S3_ACTION_PUT_BUCKET_POLICY:       rwMetadata,
+		s3_constants.S3_ACTION_DELETE_BUCKET_POLICY:    rwMetadata,
+		s3_constants.S3_ACTION_GET_BUCKET_TAGGING:      rwMetadata,
+		s3_constants.S3_ACTION_PUT_BUCKET_TAGGING:      rwMetadata,
+		s3_constants.S3_ACTION_DELETE_BUCKET_TAGGING:   rwMetadata,
+		s3_constants.S3_ACTION_GET_BUCKET_CORS:         rwMetadata,
+		s3_constants.S3_ACTION_PUT_BUCKET_CORS:         rwMetadata,
+		s3_constants.S3_ACTION_DELETE_BUCKET_CORS:      rwMetadata,
+		s3_constants.S3_ACTION_GET_BUCKET_LIFECYCLE:    rwMetadata,
+		s3_constants.S3_ACTION_PUT_BUCKET_LIFECYCLE:    rwMetadata,
+		s3_constants.S3_ACTION_GET_BUCKET_VERSIONING:   rwMetadata,
+		s3_constants.S3_ACTION_PUT_BUCKET_VERSIONING:   rwMetadata,
+		s3_constants.S3_ACTION_GET_BUCKET_LOCATION:     rwMetadata,
+		s3_constants.S3_ACTION_GET_BUCKET_NOTIFICATION: rwMetadata,
+		s3_constants.S3_ACTION_PUT_BUCKET_NOTIFICATION: rwMetadata,
+		s3_constants.S3_ACTION_GET_BUCKET_OBJECT_LOCK:  rwMetadata,
+		s3_constants.S3_ACTION_PUT_BUCKET_OBJECT_LOCK:  rwMetadata,
+
+		s3_constants.S3_ACTION_ALL: rwOther,
+	}
+	for action, class := range want {
+		got, ok := actionClasses[action]
+		if !ok {
+			t.Errorf("%s has no billing class", action)
+			continue
+		}
+		if got != class {
+			t.Errorf("%s billed as %v, want %v", action, got, class)
+		}
+	}
+	for action := range actionClasses {
+		if _, ok := want[action]; !ok {
+			t.Errorf("%s is classified but missing from this test", action)
+		}
+	}
+}
+
+func TestClassifyReadWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		bucket string
+		object string
+		query  string
+		want   rwClass
+	}{
+		{"GetObject", http.MethodGet, "b", "k", "", rwRead},
+		{"HeadObject", http.MethodHead, "b", "k", "", rwHead},
+		{"HeadBucket", http.MethodHead, "b", "", "", rwHead},
+		{"PutObject", http.MethodPut, "b", "k", "", rwWrite},
+		{"DeleteObject", http.MethodDelete, "b", "k", "", rwWrite},
+		{"GetObjectAcl", http.MethodGet, "b", "k", "acl", rwMetadata},
+		{"PutObjectAcl", http.MethodPut, "b", "k", "acl", rwMetadata},
+		{"GetObjectTagging", http.MethodGet, "b", "k", "tagging", rwRead},
+		{"ListObjectsV1", http.MethodGet, "b", "", "", rwList},
+		{"ListObjectsV2", http.MethodGet, "b", "", "list-type=2", rwList},
+		{"ListMultipartUploads", http.MethodGet, "b", "", "uploads", rwList},
+		{"ListParts", http.MethodGet, "b", "k", "uploadId=1", rwList},
+		{"CreateMultipartUpload", http.MethodPost, "b", "k", "uploads", rwWrite},
+		{"CompleteMultipartUpload", http.MethodPost, "b", "k", "uploadId=1", rwWrite},
+		{"DeleteObjects", http.MethodPost, "b", "", "delete", rwWrite},
+		{"GetBucketLocation", http.MethodGet, "b", "", "location", rwMetadata},
+		{"GetBucketVersioning", http.MethodGet, "b", "", "versioning", rwMetadata},
+		{"PutBucketVersioning", http.MethodPut, "b", "", "versioning", rwMetadata},
+		{"GetBucketAcl", http.MethodGet, "b", "", "acl", rwMetadata},
+		{"PutBucketLifecycle", http.MethodPut, "b", "", "lifecycle", rwMetadata},
+		{"DeleteBucketCors", http.MethodDelete, "b", "", "cors", rwMetadata},
+		{"PutBucketPolicy", http.MethodPut, "b", "", "policy", rwMetadata},
+		{"DeleteBucket", http.MethodDelete, "b", "", "", rwWrite},
+		{"ListObjectVersions", http.MethodGet, "b", "", "versions", rwList},
+		{"ListBuckets", http.MethodGet, "", "", "", rwRead},
+		{"STS", http.MethodPost, "", "", "Action=AssumeRole", rwWrite},
+		{"Options", http.MethodOptions, "b", "k", "", rwPreflight},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/?"+tt.query, nil)
+			if tt.bucket != "" {
+				r = mux.SetURLVars(r, map[string]string{"bucket": tt.bucket, "object": tt.object})
+			}
+			if got := classifyReadWrite(requestS3Action(r), r); got != tt.want {
+				t.Errorf("classifyReadWrite() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// withoutActionClass removes action from actionClasses and forgets the
+// unclassified actions seen so far, for the duration of the test.
+func withoutActionClass(t *testing.T, action string) {
+	t.Helper()
+	oldClasses, oldSeen := actionClasses, unclassifiedActions
+	actionClasses = make(map[string]rwClass, len(oldClasses))
+	for a, class := range oldClasses {
+		if a != action {
+			actionClasses[a] = class
+		}
+	}
+	unclassifiedActions = make(map[string]struct{})
+	t.Cleanup(func() { actionClasses, unclassifiedActions = oldClasses, oldSeen })
+}
+
+func TestUnclassifiedActionCounter(t *testing.T) {
+	withoutActionClass(t, s3_constants.S3_ACTION_GET_BUCKET_LOCATION)
+	counter := stats_collect.S3UnclassifiedActionCounter.WithLabelValues(s3_constants.S3_ACTION_GET_BUCKET_LOCATION)
+	before := testutil.ToFloat64(counter)
+
+	r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/?location", nil), map[string]string{"bucket": "b"})
+	if got := classifyReadWrite(requestS3Action(r), r); got != rwRead {
+		t.Errorf("classifyReadWrite() = %v, want %v", got, rwRead)
+	}
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Errorf("unclassified %s = %v, want 1", s3_constants.S3_ACTION_GET_BUCKET_LOCATION, got)
+	}
+
+	// Mapped actions and service-level requests are not counted.
+	overflow := stats_collect.S3UnclassifiedActionCounter.WithLabelValues("overflow")
+	overflowBefore := testutil.ToFloat64(overflow)
+	object := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/", nil), map[string]string{"bucket": "b", "object": "k"})
+	classifyReadWrite(requestS3Action(object), object)
+	classifyReadWrite("", httptest.NewRequest(http.MethodGet, "/", nil))
+	if len(unclassifiedActions) != 1 {
+		t.Errorf("unclassified actions = %v, want only %s", unclassifiedActions, s3_constants.S3_ACTION_GET_BUCKET_LOCATION)
+	}
+
+	for i := len(unclassifiedActions); i < maxUnclassifiedActions; i++ {
+		recordUnclassifiedAction(fmt.Sprintf("s3:Test%d", i))
+	}
+	recordUnclassifiedAction("s3:OneTooMany")
+	recordUnclassifiedAction(s3_constants.S3_ACTION_GET_BUCKET_LOCATION)
+	if got := testutil.ToFloat64(overflow) - overflowBefore; got != 1 {
+		t.Errorf("overflow = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(counter) - before; got != 2 {
+		t.Errorf("unclassified %s = %v, want 2 after the cap", s3_constants.S3_ACTION_GET_BUCKET_LOCATION, got)
+	}
+}
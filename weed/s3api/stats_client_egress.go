@@ -0,0 +1,73 @@
+package s3api
+
+import (
+	"net/netip"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// Per-client egress is aggregated by network prefix rather than by address
+// to bound the number of series. S3_CLIENT_EGRESS_PREFIX_V4 and
+// S3_CLIENT_EGRESS_PREFIX_V6 set the prefix lengths, /24 and /48 by default.
+var (
+	perClientEgress          = envBool("S3_METRICS_PER_CLIENT_EGRESS", false)
+	clientEgressPrefixBitsV4 = envPrefixBits("S3_CLIENT_EGRESS_PREFIX_V4", 24, 32)
+	clientEgressPrefixBitsV6 = envPrefixBits("S3_CLIENT_EGRESS_PREFIX_V6", 48, 128)
+)
+
+// envPrefixBits reads a prefix length of at most maxBits from the environment.
+func envPrefixBits(name string, def, maxBits int) int {
+	bits := envInt(name, def)
+	if bits < 0 || bits > maxBits {
+		glog.Warningf("ignoring out of range %s=%d", name, bits)
+		return def
+	}
+	return bits
+}
+
+// recordClientEgress adds bytesTransferred to the egress of the client's
+// network prefix when per-client egress is enabled.
+func recordClientEgress(bytesTransferred int64, client netip.Addr) {
+	if !perClientEgress {
+		return
+	}
+	prefix, ok := clientEgressPrefix(client)
+	if !ok {
+		return
+	}
+	stats_collect.S3ClientEgressBytes.WithLabelValues(prefix.String()).Add(float64(bytesTransferred))
+}
+
+// clientEgressPrefix returns the aggregation prefix containing addr, which
+// is anonymized first since the prefix is used as a metric label.
+func clientEgressPrefix(addr netip.Addr) (netip.Prefix, bool) {
+	return clientNetwork(anonymizeIP(addr))
+}
+
+// clientNetworkLabel returns the metric label of a network returned by
+// clientNetwork, anonymized like clientEgressPrefix.
+func clientNetworkLabel(network netip.Prefix) string {
+	prefix, ok := clientEgressPrefix(network.Addr())
+	if !ok {
+		return ""
+	}
+	return prefix.String()
+}
+
+// clientNetwork returns the aggregation prefix containing addr without
+// anonymizing it, for uses that do not end up in a label.
+func clientNetwork(addr netip.Addr) (netip.Prefix, bool) {
+	if !addr.IsValid() {
+		return netip.Prefix{}, false
+	}
+	bits := clientEgressPrefixBitsV6
+	if addr.Is4() {
+		bits = clientEgressPrefixBitsV4
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	return prefix, true
+}
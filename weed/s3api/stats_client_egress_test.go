@@ -0,0 +1,61 @@
+package s3api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func TestClientEgressByPrefix(t *testing.T) {
+	oldEnabled, oldV4, oldV6 := perClientEgress, clientEgressPrefixBitsV4, clientEgressPrefixBitsV6
+	t.Cleanup(func() {
+		perClientEgress, clientEgressPrefixBitsV4, clientEgressPrefixBitsV6 = oldEnabled, oldV4, oldV6
+	})
+	perClientEgress, clientEgressPrefixBitsV4, clientEgressPrefixBitsV6 = true, 24, 48
+
+	tests := []struct {
+		remoteAddr string
+		bytes      int64
+		prefix     string
+	}{
+		{"198.51.100.7:1234", 100, "198.51.100.0/24"},
+		{"198.51.100.200:1234", 50, "198.51.100.0/24"},
+		{"[2001:db8:1234:5678::1]:1234", 70, "2001:db8:1234::/48"},
+		{"[2001:db8:1234:ffff::2]:1234", 30, "2001:db8:1234::/48"},
+	}
+	before := map[string]float64{}
+	for _, tt := range tests {
+		before[tt.prefix] = testutil.ToFloat64(stats_collect.S3ClientEgressBytes.WithLabelValues(tt.prefix))
+	}
+	for _, tt := range tests {
+		BucketTrafficSent(tt.bytes, newStatsRequest(http.MethodGet, "stats-client-egress", "k", tt.remoteAddr))
+	}
+	for prefix, want := range map[string]float64{"198.51.100.0/24": 150, "2001:db8:1234::/48": 100} {
+		if got := testutil.ToFloat64(stats_collect.S3ClientEgressBytes.WithLabelValues(prefix)) - before[prefix]; got != want {
+			t.Errorf("egress of %s = %v, want %v", prefix, got, want)
+		}
+	}
+
+	clientEgressPrefixBitsV4, clientEgressPrefixBitsV6 = 16, 32
+	BucketTrafficSent(10, newStatsRequest(http.MethodGet, "stats-client-egress", "k", "198.51.100.7:1234"))
+	BucketTrafficSent(10, newStatsRequest(http.MethodGet, "stats-client-egress", "k", "[2001:db8:1234:5678::1]:1234"))
+	for _, prefix := range []string{"198.51.0.0/16", "2001:db8::/32"} {
+		if got := testutil.ToFloat64(stats_collect.S3ClientEgressBytes.WithLabelValues(prefix)); got != 10 {
+			t.Errorf("egress of %s = %v, want 10", prefix, got)
+		}
+	}
+}
+
+func TestClientEgressDisabled(t *testing.T) {
+	old := perClientEgress
+	perClientEgress = false
+	t.Cleanup(func() { perClientEgress = old })
+
+	BucketTrafficSent(10, newStatsRequest(http.MethodGet, "stats-client-egress", "k", "192.0.2.7:1234"))
+	if got := testutil.ToFloat64(stats_collect.S3ClientEgressBytes.WithLabelValues("192.0.2.0/24")); got != 0 {
+		t.Errorf("egress with per-client egress disabled = %v, want 0", got)
+	}
+}
@@ -0,0 +1,103 @@
+package s3api
+
+import (
+	"net/netip"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"go4.org/netipx"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// noClientGroup labels clients outside every group of S3_INTERNAL_CIDRS_GROUPED.
+const noClientGroup = "-"
+
+// clientGroups names internal networks after the tenant they belong to, so
+// that a tenant's IPv4 and IPv6 prefixes are labeled alike. They are read from
+// S3_INTERNAL_CIDRS_GROUPED, e.g. "tenantA=10.1.0.0/16,2001:db8:a::/48,
+// tenantB=10.2.0.0/16": a CIDR without a name belongs to the group before it.
+// Grouped networks are internal. The groups are replaced atomically by
+// ReloadClientGroups and never modified.
+var clientGroups atomic.Pointer[[]clientGroupSet]
+
+type clientGroupSet struct {
+	name string
+	set  *netipx.IPSet
+}
+
+func init() {
+	ReloadClientGroups()
+}
+
+// ReloadClientGroups rebuilds the client groups from
+// S3_INTERNAL_CIDRS_GROUPED and replaces them. It is registered as a SIGHUP
+// reload hook.
+func ReloadClientGroups() {
+	groups := parseClientGroups(os.Getenv("S3_INTERNAL_CIDRS_GROUPED"))
+	clientGroups.Store(&groups)
+	glog.V(1).Infof("loaded %d s3 client groups", len(groups))
+}
+
+// parseClientGroups parses a comma separated list of group=CIDRs entries, in
+// the order the groups first appear. Invalid CIDRs are logged, counted in
+// S3CIDRParseErrors and skipped.
+func parseClientGroups(s string) []clientGroupSet {
+	var names []string
+	prefixes := make(map[string][]netip.Prefix)
+	excluded := make(map[string][]netip.Prefix)
+	group := ""
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		cidrs := entry
+		if name, rest, found := strings.Cut(entry, "="); found {
+			group, cidrs = strings.TrimSpace(name), rest
+		}
+		if group == "" || group == noClientGroup {
+			glog.Warningf("S3_INTERNAL_CIDRS_GROUPED: skipping entry %q without a group", entry)
+			continue
+		}
+		groupPrefixes, groupExcluded, invalid := parseIPSetList(cidrs)
+		for _, cidr := range invalid {
+			glog.Warningf("S3_INTERNAL_CIDRS_GROUPED: skipping invalid CIDR %q for group %s", cidr, group)
+			stats_collect.S3CIDRParseErrors.WithLabelValues("env").Inc()
+		}
+		if _, seen := prefixes[group]; !seen {
+			names = append(names, group)
+		}
+		prefixes[group] = append(prefixes[group], groupPrefixes...)
+		excluded[group] = append(excluded[group], groupExcluded...)
+	}
+	groups := make([]clientGroupSet, 0, len(names))
+	for _, name := range names {
+		groups = append(groups, clientGroupSet{name: name, set: buildIPSet(prefixes[name], excluded[name])})
+	}
+	return groups
+}
+
+// clientGroup returns the group of ip, the first one containing it, or
+// noClientGroup. The label values are bounded by the configured groups.
+func clientGroup(ip netip.Addr) string {
+	groups := clientGroups.Load()
+	if groups == nil {
+		return noClientGroup
+	}
+	ip = ip.Unmap()
+	for _, group := range *groups {
+		if ipSetContains(group.set, ip) {
+			return group.name
+		}
+	}
+	return noClientGroup
+}
+
+// hasClientGroups reports whether any client group is configured.
+func hasClientGroups() bool {
+	groups := clientGroups.Load()
+	return groups != nil && len(*groups) > 0
+}
@@ -0,0 +1,82 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// withClientGroups loads config as the client groups for the duration of the
+// test.
+func withClientGroups(t *testing.T, config string) {
+	t.Helper()
+	t.Cleanup(ReloadClientGroups)
+	t.Setenv("S3_INTERNAL_CIDRS_GROUPED", config)
+	ReloadClientGroups()
+}
+
+func TestParseClientGroups(t *testing.T) {
+	groups := parseClientGroups("orphan/8, a=10.1.0.0/16, 2001:db8:a::/48, b=10.2.0.0/16;!10.2.9.0/24, a=10.3.0.0/16, b=bogus, -=10.9.0.0/16")
+	if len(groups) != 2 || groups[0].name != "a" || groups[1].name != "b" {
+		t.Fatalf("groups = %v, want a and b", groups)
+	}
+	for addr, want := range map[string]string{"10.1.2.3": "a", "2001:db8:a::1": "a", "10.3.2.1": "a", "10.2.1.1": "b", "10.2.9.1": "", "10.9.1.1": ""} {
+		got := ""
+		for _, group := range groups {
+			if group.set.Contains(netip.MustParseAddr(addr)) {
+				got = group.name
+			}
+		}
+		if got != want {
+			t.Errorf("group of %s = %q, want %q", addr, got, want)
+		}
+	}
+}
+
+func TestClientGroupDualStack(t *testing.T) {
+	withPrivateAsInternal(t, false)
+	withInternalCIDRs(t, "")
+	withClientGroups(t, "tenantA=10.1.0.0/16,2001:db8:a::/48,tenantB=10.2.0.0/16,2001:db8:b::/48;!10.2.9.0/24")
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"10.1.2.3", "tenantA"},
+		{"::ffff:10.1.2.3", "tenantA"},
+		{"2001:db8:a::7", "tenantA"},
+		{"10.2.0.1", "tenantB"},
+		{"2001:db8:b:1::1", "tenantB"},
+		{"10.2.9.1", noClientGroup},
+		{"203.0.113.5", noClientGroup},
+		{"2001:db8:c::1", noClientGroup},
+	}
+	for _, tt := range tests {
+		addr := netip.MustParseAddr(tt.addr)
+		if got := clientGroup(addr); got != tt.want {
+			t.Errorf("clientGroup(%s) = %q, want %q", tt.addr, got, tt.want)
+		}
+		// Grouped networks are internal.
+		if internal := _isInternal(addr); internal != (tt.want != noClientGroup) {
+			t.Errorf("_isInternal(%s) = %v", tt.addr, internal)
+		}
+	}
+}
+
+func TestTrackCountsClientGroups(t *testing.T) {
+	const bucket = "stats-client-group"
+	withClientGroups(t, "tenantA=10.1.0.0/16,2001:db8:a::/48")
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	for _, remoteAddr := range []string{"10.1.2.3:1234", "[2001:db8:a::7]:1234", "203.0.113.5:1234"} {
+		track(ok, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", remoteAddr))
+	}
+	for group, want := range map[string]float64{"tenantA": 2, noClientGroup: 1} {
+		if got := testutil.ToFloat64(stats_collect.S3ClientGroupRequestCounter.WithLabelValues(bucket, group)); got != want {
+			t.Errorf("%s requests = %v, want %v", group, got, want)
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package s3api
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// Client IP resolution for the S3 request metrics.
+//
+// Without configuration a request is attributed to its direct peer. When the
+// gateway runs behind reverse proxies, S3_TRUSTED_PROXY_HOPS is the number of
+// proxies in front of it: X-Forwarded-For and Forwarded are walked from the
+// right, skipping that many hops, so entries prepended by the client cannot
+// shift the result.
+// S3_TRUSTED_PROXY_CIDRS lists the addresses that may act as those hops; it
+// is required, as a peer outside it is never trusted and with an empty list
+// the forwarding headers are ignored.
+//
+// Forwarding headers are consulted in the order given by S3_CLIENT_IP_HEADERS,
+// which defaults to "Forwarded,X-Forwarded-For,X-Real-IP": an RFC 7239
+// Forwarded header wins over X-Forwarded-For, X-Real-IP is the last resort,
+// and the direct peer is used when none of them yields an address. Any other
+// header in the list, such as CF-Connecting-IP or True-Client-IP, is read as
+// holding a single client address.
+var (
+	trustedProxyHops     = envInt("S3_TRUSTED_PROXY_HOPS", 0)
+	trustedProxyPrefixes = parseCIDRsFromEnv("S3_TRUSTED_PROXY_CIDRS")
+	clientIPHeaders      = parseClientIPHeaders(os.Getenv("S3_CLIENT_IP_HEADERS"))
+	// xffMaxEntries bounds how many X-Forwarded-For entries are parsed. It
+	// must be at least S3_TRUSTED_PROXY_HOPS for the client to be found.
+	xffMaxEntries = envInt("S3_XFF_MAX_LEN", 16)
+)
+
+// maxXFFEntryBytes is the length of the longest X-Forwarded-For entry that
+// is considered, a bracketed IPv6 address with a zone and a port.
+const maxXFFEntryBytes = 64
+
+const defaultClientIPHeaders = "Forwarded,X-Forwarded-For,X-Real-IP"
+
+// clientIPResolver extracts the client address from a forwarding header,
+// returning the zero Addr when the header is absent or must not be trusted.
+type clientIPResolver func(r *http.Request, peer netip.Addr) netip.Addr
+
+var clientIPResolvers = map[string]clientIPResolver{
+	"Forwarded":       forwardedAddr,
+	"X-Forwarded-For": xffAddr,
+	"X-Real-Ip":       xRealIPAddr,
+}
+
+// getClientIP returns the address of the client that originated r. IPv4
+// clients are always returned as IPv4 addresses, also when the gateway or a
+// proxy saw them as IPv4-mapped IPv6 addresses such as ::ffff:192.0.2.1.
+func getClientIP(r *http.Request) netip.Addr {
+	addr, _ := resolveClientIP(r)
+	return addr
+}
+
+// resolveClientIP is getClientIP that also returns the source the address
+// was taken from: "forwarded", "xff", "xrealip", the lower-cased name of a
+// custom header, or "peer".
+func resolveClientIP(r *http.Request) (netip.Addr, string) {
+	peer := remoteAddr(r)
+	for _, header := range clientIPHeaders {
+		var addr netip.Addr
+		if resolve, ok := clientIPResolvers[header]; ok {
+			addr = resolve(r, peer)
+		} else {
+			addr = singleAddrHeader(r, peer, header)
+		}
+		if addr.IsValid() {
+			return addr.Unmap(), clientIPSource(header)
+		}
+	}
+	return peer, "peer"
+}
+
+// clientIPSource names the source of a client address read from header.
+func clientIPSource(header string) string {
+	switch header {
+	case "Forwarded":
+		return "forwarded"
+	case "X-Forwarded-For":
+		return "xff"
+	case "X-Real-Ip":
+		return "xrealip"
+	default:
+		return strings.ToLower(header)
+	}
+}
+
+// parseClientIPHeaders parses the comma separated header precedence list into
+// canonical header names.
+func parseClientIPHeaders(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		s = defaultClientIPHeaders
+	}
+	var headers []string
+	for _, name := range strings.Split(s, ",") {
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		headers = append(headers, name)
+	}
+	return headers
+}
+
+// remoteAddr returns the address of the direct peer of r. Custom transports
+// may set RemoteAddr to a bare address without a port, which is accepted too.
+func remoteAddr(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, _ := netip.ParseAddr(host)
+	return addr.Unmap()
+}
+
+// xffAddr resolves the client from X-Forwarded-For by skipping
+// trustedProxyHops hops from the right. The direct peer counts as the first
+// hop, so with one trusted proxy the rightmost header entry is the client.
+// Every skipped hop must be a trusted proxy, otherwise the header is ignored.
+func xffAddr(r *http.Request, peer netip.Addr) netip.Addr {
+	if trustedProxyHops <= 0 {
+		return netip.Addr{}
+	}
+	if !isTrustedPeer(peer) {
+		return netip.Addr{}
+	}
+	return forwardingChainClient(xffEntries(r))
+}
+
+// forwardingChainClient returns the client of a forwarding chain, ordered
+// from the client to the last proxy, by skipping trustedProxyHops hops from
+// the right. Every skipped hop must be a trusted proxy, otherwise the chain is
+// ignored.
+func forwardingChainClient(entries []string) netip.Addr {
+	if len(entries) == 0 || len(entries) < trustedProxyHops {
+		return netip.Addr{}
+	}
+	clientIndex := len(entries) - trustedProxyHops
+	for i := len(entries) - 1; i > clientIndex; i-- {
+		hop, ok := parseForwardedAddr(entries[i])
+		if !ok || !isTrustedProxy(hop) {
+			return netip.Addr{}
+		}
+	}
+	addr, _ := parseForwardedAddr(entries[clientIndex])
+	return addr
+}
+
+// xffEntries returns the forwarding chain of r. Proxies may each add their
+// own X-Forwarded-For header line instead of appending to the existing one,
+// so all lines are joined in order before the chain is split. Empty entries,
+// as left by blank header lines, are dropped.
+//
+// Only the rightmost xffMaxEntries entries, and no more than
+// maxXFFEntryBytes bytes per entry, are looked at: entries are taken from the
+// right, where the trusted proxies append, and the rest of an oversized
+// header, which only the client could have added, is never split.
+func xffEntries(r *http.Request) []string {
+	lines := r.Header.Values("X-Forwarded-For")
+	limit := xffMaxEntries
+	if limit < 1 {
+		limit = 1
+	}
+	budget := limit * maxXFFEntryBytes
+	var entries []string
+	oversized := false
+	for i := len(lines) - 1; i >= 0 && !oversized; i-- {
+		line := lines[i]
+		if len(line) > budget {
+			// Drop the entry the cut went through along with the rest.
+			line = line[len(line)-budget:]
+			if j := strings.IndexByte(line, ','); j >= 0 {
+				line = line[j+1:]
+			} else {
+				line = ""
+			}
+			oversized = true
+		}
+		budget -= len(line)
+		for line != "" {
+			var entry string
+			if j := strings.LastIndexByte(line, ','); j >= 0 {
+				line, entry = line[:j], line[j+1:]
+			} else {
+				line, entry = "", line
+			}
+			if entry = strings.TrimSpace(entry); entry == "" {
+				continue
+			}
+			if len(entries) == limit {
+				oversized = true
+				break
+			}
+			entries = append(entries, entry)
+		}
+	}
+	if oversized {
+		stats_collect.S3OversizedForwardedHeaderCounter.Inc()
+	}
+	slices.Reverse(entries)
+	return entries
+}
+
+// forwardedAddr resolves the client from the RFC 7239 Forwarded header, when
+// the direct peer is a trusted proxy, by walking its elements from the right
+// the way xffAddr walks X-Forwarded-For.
+func forwardedAddr(r *http.Request, peer netip.Addr) netip.Addr {
+	if !isTrustedPeer(peer) {
+		return netip.Addr{}
+	}
+	return forwardingChainClient(forwardedEntries(r))
+}
+
+// xRealIPAddr honors the X-Real-IP header set by nginx only when the direct
+// peer is a trusted proxy.
+func xRealIPAddr(r *http.Request, peer netip.Addr) netip.Addr {
+	return singleAddrHeader(r, peer, "X-Real-IP")
+}
+
+// singleAddrHeader reads the client from a header holding a single address,
+// optionally with a port, when the direct peer is a trusted proxy.
+func singleAddrHeader(r *http.Request, peer netip.Addr, header string) netip.Addr {
+	if !isTrustedPeer(peer) {
+		return netip.Addr{}
+	}
+	addr, _ := parseForwardedAddr(r.Header.Get(header))
+	return addr
+}
+
+// forwardedEntries returns the for= parameter of every element of the
+// Forwarded header of r, e.g. "[2001:db8::1]:4711" for
+// for="[2001:db8::1]:4711", in order, and "" for an element without one.
+// Obfuscated identifiers such as _hidden and unknown are returned as they
+// are and never parse as an address. Like xffEntries, only the rightmost
+// xffMaxEntries elements are kept.
+func forwardedEntries(r *http.Request) []string {
+	var entries []string
+	for _, line := range r.Header.Values("Forwarded") {
+		for _, element := range strings.Split(line, ",") {
+			if strings.TrimSpace(element) == "" {
+				continue
+			}
+			entry := ""
+			for _, pair := range strings.Split(element, ";") {
+				key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if found && strings.EqualFold(key, "for") {
+					entry = strings.Trim(strings.TrimSpace(value), `"`)
+					break
+				}
+			}
+			entries = append(entries, entry)
+		}
+	}
+	limit := xffMaxEntries
+	if limit < 1 {
+		limit = 1
+	}
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries
+}
+
+// warnTrustedProxyConfig warns at startup when S3_TRUSTED_PROXY_HOPS is set
+// without S3_TRUSTED_PROXY_CIDRS, which leaves every forwarding header
+// ignored and attributes all requests to the proxies.
+func warnTrustedProxyConfig() {
+	if trustedProxyHops > 0 && len(trustedProxyPrefixes) == 0 {
+		glog.Warningf("S3_TRUSTED_PROXY_HOPS=%d has no effect: S3_TRUSTED_PROXY_CIDRS is empty, so no proxy is trusted and s3 requests are attributed to their direct peer", trustedProxyHops)
+	}
+}
+
+// isTrustedPeer reports whether the forwarding headers sent by the direct
+// peer may be honored.
+func isTrustedPeer(peer netip.Addr) bool {
+	return trustedProxyHops > 0 && isTrustedProxy(peer)
+}
+
+// hasUntrustedForwardingHeader reports whether r carries one of the client IP
+// headers although its direct peer is not a trusted proxy. Such headers are
+// ignored, but may be an attempt to manipulate billing classification. Without
+// trusted proxy hops no peer is trusted, so every such header is reported.
+func hasUntrustedForwardingHeader(r *http.Request) bool {
+	if isTrustedPeer(remoteAddr(r)) {
+		return false
+	}
+	for _, header := range clientIPHeaders {
+		if r.Header.Get(header) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// isTrustedProxy reports whether addr may act as a forwarding hop. Without
+// S3_TRUSTED_PROXY_CIDRS no address may.
+func isTrustedProxy(addr netip.Addr) bool {
+	return addr.IsValid() && addrInPrefixes(addr, trustedProxyPrefixes)
+}
+
+// parseForwardedAddr parses a single forwarding header entry, accepting an
+// optional port and brackets, e.g. "192.0.2.1:8080" or "[2001:db8::1]:443".
+// IPv4-mapped addresses are returned as IPv4.
+func parseForwardedAddr(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.Unmap(), true
+	}
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		if addr, err := netip.ParseAddr(s[1 : len(s)-1]); err == nil {
+			return addr.Unmap(), true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+// addrInPrefixes reports whether addr falls into any of the prefixes. An
+// IPv4-mapped addr matches the IPv4 prefixes containing it.
+func addrInPrefixes(addr netip.Addr, prefixes []netip.Prefix) bool {
+	_, ok := matchingPrefix(addr, prefixes)
+	return ok
+}
+
+// matchingPrefix returns the first of the prefixes containing addr.
+func matchingPrefix(addr netip.Addr, prefixes []netip.Prefix) (netip.Prefix, bool) {
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return prefix, true
+		}
+	}
+	return netip.Prefix{}, false
+}
+
+// parseCIDRs parses a comma, semicolon or whitespace separated list of CIDRs.
+// Bare addresses are accepted as single-host prefixes; invalid entries are skipped.
+func parseCIDRs(s string) []netip.Prefix {
+	prefixes, _ := parseCIDRList(s)
+	return prefixes
+}
+
+// parseCIDRsFromEnv parses the CIDR list in the named variable, logging and
+// counting every rejected entry.
+func parseCIDRsFromEnv(name string) []netip.Prefix {
+	prefixes, invalid := parseCIDRList(os.Getenv(name))
+	for _, entry := range invalid {
+		glog.Warningf("%s: skipping invalid CIDR %q", name, entry)
+		stats_collect.S3CIDRParseErrors.WithLabelValues("env").Inc()
+	}
+	return prefixes
+}
+
+// parseCIDRList is parseCIDRs that also returns the rejected entries.
+func parseCIDRList(s string) (prefixes []netip.Prefix, invalid []string) {
+	for _, entry := range splitCIDRList(s) {
+		if prefix, ok := parseCIDR(entry); ok {
+			prefixes = append(prefixes, prefix)
+		} else {
+			invalid = append(invalid, entry)
+		}
+	}
+	return prefixes, invalid
+}
+
+func splitCIDRList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+}
+
+// parseCIDR parses a CIDR or a bare address. IPv4-mapped entries, such as
+// ::ffff:10.0.0.0/104, are converted to their IPv4 form so that they match
+// the unmapped client addresses.
+func parseCIDR(entry string) (netip.Prefix, bool) {
+	if !strings.Contains(entry, "/") {
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return netip.Prefix{}, false
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), true
+	}
+	prefix, err := netip.ParsePrefix(entry)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	if addr := prefix.Addr(); addr.Is4In6() {
+		if prefix.Bits() < 96 {
+			return netip.Prefix{}, false
+		}
+		prefix = netip.PrefixFrom(addr.Unmap(), prefix.Bits()-96)
+	}
+	return prefix.Masked(), true
+}
@@ -0,0 +1,66 @@
+package s3api
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+)
+
+type clientIPKey struct{}
+
+// clientIPInfo is the client address of a request, resolved once.
+type clientIPInfo struct {
+	addr    netip.Addr
+	network string
+}
+
+// clientIPMiddleware resolves the client address of every request once and
+// stores it, with its network classification, in the request
+// context for the metrics and handlers downstream.
+func clientIPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, withClientIP(r))
+	})
+}
+
+// withClientIP returns r with its resolved client address in the context.
+func withClientIP(r *http.Request) *http.Request {
+	if _, ok := r.Context().Value(clientIPKey{}).(clientIPInfo); ok {
+		return r
+	}
+	addr := getClientIP(r)
+	info := clientIPInfo{addr: addr, network: classifyRequestNetwork(r, addr)}
+	return r.WithContext(context.WithValue(r.Context(), clientIPKey{}, info))
+}
+
+// ClientIPFromContext returns the client address resolved for the request
+// ctx belongs to, and whether it was resolved.
+func ClientIPFromContext(ctx context.Context) (netip.Addr, bool) {
+	info, ok := ctx.Value(clientIPKey{}).(clientIPInfo)
+	return info.addr, ok
+}
+
+// IsInternalFromContext reports whether the client of the request ctx
+// belongs to was classified as internal. It is false when no client address
+// was resolved.
+func IsInternalFromContext(ctx context.Context) bool {
+	info, _ := ctx.Value(clientIPKey{}).(clientIPInfo)
+	return info.network == networkInternal
+}
+
+// requestClientIP returns the client address of r and whether it is
+// internal, using the value resolved by clientIPMiddleware when present.
+func requestClientIP(r *http.Request) (netip.Addr, bool) {
+	addr, network := requestClientNetwork(r)
+	return addr, network == networkInternal
+}
+
+// requestClientNetwork returns the client address of r and its network
+// class, using the value resolved by clientIPMiddleware when present.
+func requestClientNetwork(r *http.Request) (netip.Addr, string) {
+	if info, ok := r.Context().Value(clientIPKey{}).(clientIPInfo); ok {
+		return info.addr, info.network
+	}
+	addr := getClientIP(r)
+	return addr, classifyRequestNetwork(r, addr)
+}
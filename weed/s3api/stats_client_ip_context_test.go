@@ -0,0 +1,71 @@
+package s3api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func TestClientIPMiddleware(t *testing.T) {
+	withInternalCIDRs(t, "10.0.0.0/8")
+	tests := []struct {
+		remoteAddr string
+		want       netip.Addr
+		internal   bool
+	}{
+		{"10.1.2.3:1234", netip.MustParseAddr("10.1.2.3"), true},
+		{"203.0.113.5:1234", netip.MustParseAddr("203.0.113.5"), false},
+	}
+	for _, tt := range tests {
+		var gotAddr netip.Addr
+		var gotOK, gotInternal bool
+		handler := clientIPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotAddr, gotOK = ClientIPFromContext(r.Context())
+			gotInternal = IsInternalFromContext(r.Context())
+		}))
+		r := httptest.NewRequest(http.MethodGet, "/b/k", nil)
+		r.RemoteAddr = tt.remoteAddr
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+
+		if !gotOK || gotAddr != tt.want {
+			t.Errorf("%s: ClientIPFromContext = %v, %v, want %v", tt.remoteAddr, gotAddr, gotOK, tt.want)
+		}
+		if gotInternal != tt.internal {
+			t.Errorf("%s: IsInternalFromContext = %v, want %v", tt.remoteAddr, gotInternal, tt.internal)
+		}
+	}
+}
+
+func TestClientIPFromContextMissing(t *testing.T) {
+	if addr, ok := ClientIPFromContext(context.Background()); ok || addr.IsValid() {
+		t.Errorf("ClientIPFromContext without middleware = %v, %v, want nothing", addr, ok)
+	}
+	if IsInternalFromContext(context.Background()) {
+		t.Error("IsInternalFromContext without middleware = true")
+	}
+}
+
+func TestBucketTrafficUsesResolvedClientIP(t *testing.T) {
+	withInternalCIDRs(t, "10.0.0.0/8")
+	const bucket = "stats-context-client-ip"
+	// The peer is internal, but the value resolved upstream says otherwise.
+	r := newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234")
+	info := clientIPInfo{addr: netip.MustParseAddr("203.0.113.5")}
+	r = r.WithContext(context.WithValue(r.Context(), clientIPKey{}, info))
+
+	BucketTrafficSent(10, r)
+	BucketTrafficReceived(20, r)
+
+	if got := testutil.ToFloat64(stats_collect.S3BucketExternalSentBytesCounter.WithLabelValues(bucket)); got != 10 {
+		t.Errorf("external sent bytes = %v, want 10", got)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3BucketExternalReceivedBytesCounter.WithLabelValues(bucket)); got != 20 {
+		t.Errorf("external received bytes = %v, want 20", got)
+	}
+}
@@ -0,0 +1,364 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func withTrustedProxies(t *testing.T, hops int, cidrs string) {
+	t.Helper()
+	oldHops, oldPrefixes := trustedProxyHops, trustedProxyPrefixes
+	trustedProxyHops, trustedProxyPrefixes = hops, parseCIDRs(cidrs)
+	t.Cleanup(func() {
+		trustedProxyHops, trustedProxyPrefixes = oldHops, oldPrefixes
+	})
+}
+
+func TestGetClientIPTrustedHops(t *testing.T) {
+	tests := []struct {
+		name       string
+		hops       int
+		cidrs      string
+		remoteAddr string
+		xff        string
+		want       string
+	}{
+		{"no proxies configured ignores header", 0, "", "10.0.0.1:1234", "203.0.113.5", "10.0.0.1"},
+		{"no header", 1, "", "10.0.0.1:1234", "", "10.0.0.1"},
+		{"single proxy", 1, "10.0.0.0/8", "10.0.0.1:1234", "203.0.113.5", "203.0.113.5"},
+		{"spoofed prepend is skipped", 1, "10.0.0.0/8", "10.0.0.1:1234", "198.51.100.66, 203.0.113.5", "203.0.113.5"},
+		{"two proxies", 2, "10.0.0.0/8", "10.0.0.1:1234", "198.51.100.66, 203.0.113.5, 10.1.2.3", "203.0.113.5"},
+		{"untrusted hop in chain", 2, "10.0.0.0/8", "10.0.0.1:1234", "203.0.113.5, 198.51.100.66", "10.0.0.1"},
+		{"untrusted peer", 1, "10.0.0.0/8", "192.0.2.9:1234", "203.0.113.5", "192.0.2.9"},
+		{"short header", 3, "10.0.0.0/8", "10.0.0.1:1234", "203.0.113.5, 10.1.2.3", "10.0.0.1"},
+		{"hops without cidrs trust nothing", 1, "", "192.0.2.9:1234", "198.51.100.66, 203.0.113.5", "192.0.2.9"},
+		{"ipv4 entry with port", 1, "10.0.0.0/8", "10.0.0.1:1234", "203.0.113.5:4711", "203.0.113.5"},
+		{"ipv6 entry with port", 1, "10.0.0.0/8", "10.0.0.1:1234", "[2001:db8::1]:4711", "2001:db8::1"},
+		{"bracketed ipv6 entry", 1, "10.0.0.0/8", "10.0.0.1:1234", "[2001:db8::1]", "2001:db8::1"},
+		{"trusted hop with port", 2, "10.0.0.0/8", "10.0.0.1:1234", "203.0.113.5, 10.1.2.3:8080", "203.0.113.5"},
+		{"garbage client entry", 1, "10.0.0.0/8", "10.0.0.1:1234", "not-an-ip", "10.0.0.1"},
+		{"ipv4-mapped peer", 0, "", "[::ffff:10.0.0.1]:1234", "", "10.0.0.1"},
+		{"ipv4-mapped entry", 1, "10.0.0.0/8", "10.0.0.1:1234", "::ffff:203.0.113.5", "203.0.113.5"},
+		{"ipv4-mapped trusted peer", 1, "10.0.0.0/8", "[::ffff:10.0.0.1]:1234", "203.0.113.5", "203.0.113.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withTrustedProxies(t, tt.hops, tt.cidrs)
+			r := httptest.NewRequest("GET", "/bucket/object", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if got := getClientIP(r); got != netip.MustParseAddr(tt.want) {
+				t.Errorf("getClientIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoteAddr(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		want       netip.Addr
+	}{
+		{"[2001:db8::1]:80", netip.MustParseAddr("2001:db8::1")},
+		{"2001:db8::1", netip.MustParseAddr("2001:db8::1")},
+		{"192.0.2.1:80", netip.MustParseAddr("192.0.2.1")},
+		{"192.0.2.1", netip.MustParseAddr("192.0.2.1")},
+		{"::ffff:192.0.2.1", netip.MustParseAddr("192.0.2.1")},
+		{"[2001:db8::1]", netip.Addr{}},
+		{"", netip.Addr{}},
+		{"not-an-address:80", netip.Addr{}},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/bucket/object", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if got := remoteAddr(r); got != tt.want {
+			t.Errorf("remoteAddr(%q) = %v, want %v", tt.remoteAddr, got, tt.want)
+		}
+	}
+}
+
+func TestGetClientIPMultipleXFFHeaders(t *testing.T) {
+	tests := []struct {
+		name  string
+		hops  int
+		lines []string
+		want  string
+	}{
+		{"lines are joined in order", 2, []string{"198.51.100.66, 203.0.113.5", "10.1.2.3"}, "203.0.113.5"},
+		{"client in the first line", 3, []string{"203.0.113.5", "10.1.2.3", "10.1.2.4"}, "203.0.113.5"},
+		{"blank lines are ignored", 2, []string{"203.0.113.5", "  ", "", "10.1.2.3"}, "203.0.113.5"},
+		{"empty entries are ignored", 2, []string{"203.0.113.5, ,10.1.2.3,"}, "203.0.113.5"},
+		{"only blank lines", 1, []string{" ", ""}, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withTrustedProxies(t, tt.hops, "10.0.0.0/8")
+			r := httptest.NewRequest("GET", "/bucket/object", nil)
+			r.RemoteAddr = "10.0.0.1:1234"
+			for _, line := range tt.lines {
+				r.Header.Add("X-Forwarded-For", line)
+			}
+			if got := getClientIP(r); got != netip.MustParseAddr(tt.want) {
+				t.Errorf("getClientIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOversizedXFFHeader(t *testing.T) {
+	withTrustedProxies(t, 2, "10.0.0.0/8")
+	tests := []struct {
+		name  string
+		lines []string
+	}{
+		{"many entries", []string{strings.Repeat("198.51.100.66, ", 100000) + "203.0.113.5, 10.1.2.3"}},
+		{"huge entry", []string{strings.Repeat("x", 1<<20), "203.0.113.5, 10.1.2.3"}},
+		{"huge line", []string{strings.Repeat("y", 1<<20) + ",203.0.113.5, 10.1.2.3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/bucket/object", nil)
+			r.RemoteAddr = "10.0.0.1:1234"
+			for _, line := range tt.lines {
+				r.Header.Add("X-Forwarded-For", line)
+			}
+			before := testutil.ToFloat64(stats_collect.S3OversizedForwardedHeaderCounter)
+			entries := xffEntries(r)
+			if len(entries) > xffMaxEntries {
+				t.Errorf("parsed %d entries, want at most %d", len(entries), xffMaxEntries)
+			}
+			if got := testutil.ToFloat64(stats_collect.S3OversizedForwardedHeaderCounter) - before; got != 1 {
+				t.Errorf("oversized headers = %v, want 1", got)
+			}
+			// The entries the trusted proxies appended are still used.
+			if got := getClientIP(r); got != netip.MustParseAddr("203.0.113.5") {
+				t.Errorf("getClientIP() = %v, want 203.0.113.5", got)
+			}
+		})
+	}
+
+	r := httptest.NewRequest("GET", "/bucket/object", nil)
+	r.Header.Set("X-Forwarded-For", "203.0.113.5, 10.1.2.3")
+	before := testutil.ToFloat64(stats_collect.S3OversizedForwardedHeaderCounter)
+	xffEntries(r)
+	if got := testutil.ToFloat64(stats_collect.S3OversizedForwardedHeaderCounter) - before; got != 0 {
+		t.Errorf("oversized headers = %v after a short header, want 0", got)
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	prefixes := parseCIDRs("10.0.0.0/8, 192.168.1.7;2001:db8::/32\tbogus 172.16.0.0/33")
+	want := []string{"10.0.0.0/8", "192.168.1.7/32", "2001:db8::/32"}
+	if len(prefixes) != len(want) {
+		t.Fatalf("parseCIDRs() = %v, want %v", prefixes, want)
+	}
+	for i, prefix := range prefixes {
+		if prefix.String() != want[i] {
+			t.Errorf("prefix %d = %v, want %v", i, prefix, want[i])
+		}
+	}
+	if !addrInPrefixes(netip.MustParseAddr("10.9.8.7"), prefixes) {
+		t.Error("expected 10.9.8.7 to be in prefixes")
+	}
+	if addrInPrefixes(netip.MustParseAddr("192.168.1.8"), prefixes) {
+		t.Error("expected 192.168.1.8 not to be in prefixes")
+	}
+}
+
+func TestParseIPv4MappedCIDRs(t *testing.T) {
+	prefixes := parseCIDRs("::ffff:10.0.0.0/104 ::ffff:192.168.1.7 ::ffff:0:0/95")
+	want := []string{"10.0.0.0/8", "192.168.1.7/32"}
+	if len(prefixes) != len(want) {
+		t.Fatalf("parseCIDRs() = %v, want %v", prefixes, want)
+	}
+	for i, prefix := range prefixes {
+		if prefix.String() != want[i] {
+			t.Errorf("prefix %d = %v, want %v", i, prefix, want[i])
+		}
+	}
+	for _, addr := range []string{"10.9.8.7", "::ffff:10.9.8.7"} {
+		if !addrInPrefixes(netip.MustParseAddr(addr), prefixes) {
+			t.Errorf("expected %s to be in prefixes", addr)
+		}
+	}
+}
+
+func TestForwardedEntries(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{"for=192.0.2.60;proto=http;by=203.0.113.43", []string{"192.0.2.60"}},
+		{`for="[2001:db8::1]:4711"`, []string{"[2001:db8::1]:4711"}},
+		{`For="192.0.2.60:8080"`, []string{"192.0.2.60:8080"}},
+		{"proto=https;for=198.51.100.17, for=192.0.2.43", []string{"198.51.100.17", "192.0.2.43"}},
+		{"proto=https, for=192.0.2.43", []string{"", "192.0.2.43"}},
+		{"for=_hidden, for=198.51.100.17", []string{"_hidden", "198.51.100.17"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/bucket", nil)
+		if tt.header != "" {
+			r.Header.Set("Forwarded", tt.header)
+		}
+		if got := forwardedEntries(r); !slices.Equal(got, tt.want) {
+			t.Errorf("forwardedEntries(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestGetClientIPForwardedTrustedHops(t *testing.T) {
+	tests := []struct {
+		name       string
+		hops       int
+		cidrs      string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"single proxy", 1, "10.0.0.0/8", "10.0.0.1:1234", []string{"for=203.0.113.5"}, "203.0.113.5"},
+		{"spoofed prepend is skipped", 1, "10.0.0.0/8", "10.0.0.1:1234", []string{"for=198.51.100.66, for=203.0.113.5"}, "203.0.113.5"},
+		{"spoofed prepend in its own line is skipped", 1, "10.0.0.0/8", "10.0.0.1:1234", []string{"for=198.51.100.66", "for=203.0.113.5;proto=https"}, "203.0.113.5"},
+		{"two proxies", 2, "10.0.0.0/8", "10.0.0.1:1234", []string{"for=198.51.100.66, for=203.0.113.5, for=10.0.0.2"}, "203.0.113.5"},
+		{"untrusted hop ignores header", 2, "10.0.0.0/8", "10.0.0.1:1234", []string{"for=198.51.100.66, for=203.0.113.5, for=192.0.2.9"}, "10.0.0.1"},
+		{"obfuscated hop ignores header", 2, "10.0.0.0/8", "10.0.0.1:1234", []string{"for=203.0.113.5, for=_proxy"}, "10.0.0.1"},
+		{"too few elements", 2, "10.0.0.0/8", "10.0.0.1:1234", []string{"for=203.0.113.5"}, "10.0.0.1"},
+		{"obfuscated client", 1, "10.0.0.0/8", "10.0.0.1:1234", []string{"for=203.0.113.5, for=_hidden"}, "10.0.0.1"},
+		{"untrusted peer", 1, "10.0.0.0/8", "192.0.2.9:1234", []string{"for=203.0.113.5"}, "192.0.2.9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withTrustedProxies(t, tt.hops, tt.cidrs)
+			r := httptest.NewRequest("GET", "/bucket", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, line := range tt.forwarded {
+				r.Header.Add("Forwarded", line)
+			}
+			if got := getClientIP(r); got != netip.MustParseAddr(tt.want) {
+				t.Errorf("getClientIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetClientIPHeaderPrecedence(t *testing.T) {
+	withTrustedProxies(t, 1, "10.0.0.0/8")
+	newRequest := func(forwarded, xff string) *http.Request {
+		r := httptest.NewRequest("GET", "/bucket", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		if forwarded != "" {
+			r.Header.Set("Forwarded", forwarded)
+		}
+		if xff != "" {
+			r.Header.Set("X-Forwarded-For", xff)
+		}
+		return r
+	}
+	tests := []struct {
+		name      string
+		headers   string
+		forwarded string
+		xff       string
+		want      string
+	}{
+		{"forwarded wins by default", "", "for=192.0.2.60", "203.0.113.5", "192.0.2.60"},
+		{"obfuscated forwarded falls through to xff", "", "for=_hidden", "203.0.113.5", "203.0.113.5"},
+		{"unknown forwarded falls through to peer", "", "for=unknown", "", "10.0.0.1"},
+		{"xff first when configured", "X-Forwarded-For,Forwarded", "for=192.0.2.60", "203.0.113.5", "203.0.113.5"},
+		{"forwarded only", "forwarded", "", "203.0.113.5", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := clientIPHeaders
+			clientIPHeaders = parseClientIPHeaders(tt.headers)
+			defer func() { clientIPHeaders = old }()
+			if got := getClientIP(newRequest(tt.forwarded, tt.xff)); got != netip.MustParseAddr(tt.want) {
+				t.Errorf("getClientIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForwardedHeaderFromUntrustedPeer(t *testing.T) {
+	withTrustedProxies(t, 1, "10.0.0.0/8")
+	r := httptest.NewRequest("GET", "/bucket", nil)
+	r.RemoteAddr = "192.0.2.9:1234"
+	r.Header.Set("Forwarded", "for=198.51.100.17")
+	if got := getClientIP(r); got != netip.MustParseAddr("192.0.2.9") {
+		t.Errorf("getClientIP() = %v, want direct peer", got)
+	}
+}
+
+func TestGetClientIPXRealIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		xRealIP    string
+		want       string
+	}{
+		{"trusted proxy", "10.0.0.1:1234", "", "203.0.113.5", "203.0.113.5"},
+		{"port is stripped", "10.0.0.1:1234", "", "203.0.113.5:4711", "203.0.113.5"},
+		{"ipv6 with port", "10.0.0.1:1234", "", "[2001:db8::1]:4711", "2001:db8::1"},
+		{"xff wins", "10.0.0.1:1234", "198.51.100.17", "203.0.113.5", "198.51.100.17"},
+		{"untrusted peer", "192.0.2.9:1234", "", "203.0.113.5", "192.0.2.9"},
+		{"garbage falls back to peer", "10.0.0.1:1234", "", "not-an-ip", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withTrustedProxies(t, 1, "10.0.0.0/8")
+			r := httptest.NewRequest("GET", "/bucket", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			r.Header.Set("X-Real-IP", tt.xRealIP)
+			if got := getClientIP(r); got != netip.MustParseAddr(tt.want) {
+				t.Errorf("getClientIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetClientIPCustomHeaders(t *testing.T) {
+	withTrustedProxies(t, 1, "10.0.0.0/8")
+	old := clientIPHeaders
+	clientIPHeaders = parseClientIPHeaders(" cf-connecting-ip, True-Client-IP ,X-Forwarded-For")
+	t.Cleanup(func() { clientIPHeaders = old })
+
+	newRequest := func(headers map[string]string) *http.Request {
+		r := httptest.NewRequest("GET", "/bucket", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+		return r
+	}
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"first header wins", map[string]string{"CF-Connecting-IP": "203.0.113.5", "True-Client-IP": "198.51.100.17", "X-Forwarded-For": "192.0.2.60"}, "203.0.113.5"},
+		{"invalid entry falls through", map[string]string{"CF-Connecting-IP": "garbage", "True-Client-IP": "198.51.100.17"}, "198.51.100.17"},
+		{"xff last", map[string]string{"X-Forwarded-For": "192.0.2.60"}, "192.0.2.60"},
+		{"unlisted header ignored", map[string]string{"X-Real-IP": "192.0.2.61"}, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getClientIP(newRequest(tt.headers)); got != netip.MustParseAddr(tt.want) {
+				t.Errorf("getClientIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
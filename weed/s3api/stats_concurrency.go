@@ -0,0 +1,73 @@
+package s3api
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+)
+
+// bucketConcurrencyLimits caps the requests in flight for individual buckets.
+// It is read from S3_BUCKET_CONCURRENCY_LIMITS, e.g. "bucketA=10,bucketB=50";
+// buckets that are not listed are unlimited. A request over the limit waits up
+// to S3_BUCKET_CONCURRENCY_MAX_WAIT for a slot before it is rejected.
+var (
+	bucketConcurrencyLimits  = parseBucketConcurrencyLimits(os.Getenv("S3_BUCKET_CONCURRENCY_LIMITS"))
+	bucketConcurrencyMaxWait = envDuration("S3_BUCKET_CONCURRENCY_MAX_WAIT", time.Second)
+)
+
+// bucketConcurrencyLimiter holds one semaphore per limited bucket. The map is
+// built once and never modified.
+type bucketConcurrencyLimiter struct {
+	slots map[string]chan struct{}
+}
+
+// parseBucketConcurrencyLimits parses a comma separated list of bucket=limit
+// pairs.
+func parseBucketConcurrencyLimits(s string) *bucketConcurrencyLimiter {
+	l := &bucketConcurrencyLimiter{slots: make(map[string]chan struct{})}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		bucket, value, found := strings.Cut(entry, "=")
+		bucket = strings.TrimSpace(bucket)
+		limit, err := strconv.Atoi(strings.TrimSpace(value))
+		if !found || bucket == "" || err != nil || limit <= 0 {
+			glog.Warningf("S3_BUCKET_CONCURRENCY_LIMITS: skipping invalid entry %q", entry)
+			continue
+		}
+		l.slots[bucket] = make(chan struct{}, limit)
+	}
+	return l
+}
+
+// acquire takes a slot of bucket, waiting at most maxWait and no longer than
+// ctx lives. It returns the function that gives the slot back, or false when
+// no slot became free in time. Unlimited buckets always succeed.
+func (l *bucketConcurrencyLimiter) acquire(ctx context.Context, bucket string, maxWait time.Duration) (release func(), ok bool) {
+	slots, limited := l.slots[bucket]
+	if !limited {
+		return func() {}, true
+	}
+	release = func() { <-slots }
+	select {
+	case slots <- struct{}{}:
+		return release, true
+	default:
+	}
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return release, true
+	case <-timer.C:
+		return nil, false
+	case <-ctx.Done():
+		return nil, false
+	}
+}
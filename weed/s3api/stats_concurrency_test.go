@@ -0,0 +1,138 @@
+package s3api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// withBucketConcurrencyLimits sets the per-bucket concurrency limits for the
+// duration of the test.
+func withBucketConcurrencyLimits(t *testing.T, config string, maxWait time.Duration) {
+	t.Helper()
+	oldLimits, oldWait := bucketConcurrencyLimits, bucketConcurrencyMaxWait
+	bucketConcurrencyLimits, bucketConcurrencyMaxWait = parseBucketConcurrencyLimits(config), maxWait
+	t.Cleanup(func() { bucketConcurrencyLimits, bucketConcurrencyMaxWait = oldLimits, oldWait })
+}
+
+func TestParseBucketConcurrencyLimits(t *testing.T) {
+	l := parseBucketConcurrencyLimits(" a=10, b = 2 ,bogus, c=-1, =5, d=1.5")
+	if len(l.slots) != 2 {
+		t.Fatalf("limited buckets = %d, want 2", len(l.slots))
+	}
+	if got := cap(l.slots["b"]); got != 2 {
+		t.Errorf("b limit = %d, want 2", got)
+	}
+}
+
+func TestBucketConcurrencyLimiterWaits(t *testing.T) {
+	l := parseBucketConcurrencyLimits("limited=1")
+	release, ok := l.acquire(context.Background(), "limited", 0)
+	if !ok {
+		t.Fatal("first request was rejected")
+	}
+	if _, ok := l.acquire(context.Background(), "limited", 10*time.Millisecond); ok {
+		t.Fatal("request over the limit was admitted")
+	}
+	time.AfterFunc(10*time.Millisecond, release)
+	release, ok = l.acquire(context.Background(), "limited", 5*time.Second)
+	if !ok {
+		t.Fatal("waiting request was not admitted after a slot was released")
+	}
+	release()
+
+	if _, ok := l.acquire(context.Background(), "unlimited", 0); !ok {
+		t.Error("unlimited bucket was rejected")
+	}
+}
+
+func TestTrackEnforcesBucketConcurrencyLimit(t *testing.T) {
+	const bucket = "stats-concurrency"
+	withBucketConcurrencyLimits(t, bucket+"=1", 20*time.Millisecond)
+	rejected := stats_collect.S3ConcurrencyRejectedCounter.WithLabelValues(bucket)
+	before := testutil.ToFloat64(rejected)
+
+	entered, unblock := make(chan struct{}), make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		blocking := func(w http.ResponseWriter, r *http.Request) {
+			close(entered)
+			<-unblock
+		}
+		track(authDisabled(blocking), "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	}()
+	<-entered
+
+	w := httptest.NewRecorder()
+	track(authDisabled(func(w http.ResponseWriter, r *http.Request) {}), "GET")(w, newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", w.Code)
+	}
+	if got := testutil.ToFloat64(rejected) - before; got != 1 {
+		t.Errorf("rejected requests = %v, want 1", got)
+	}
+	close(unblock)
+	<-done
+
+	w = httptest.NewRecorder()
+	track(authDisabled(func(w http.ResponseWriter, r *http.Request) {}), "GET")(w, newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	if w.Code != http.StatusOK {
+		t.Errorf("status after the slot was released = %d, want 200", w.Code)
+	}
+}
+
+func TestTrackReleasesConcurrencySlotOnPanic(t *testing.T) {
+	const bucket = "stats-concurrency-panic"
+	withBucketConcurrencyLimits(t, bucket+"=1", 0)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("handler panic was swallowed")
+			}
+		}()
+		panicking := func(w http.ResponseWriter, r *http.Request) { panic("handler failure") }
+		track(authDisabled(panicking), "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	}()
+
+	release, ok := bucketConcurrencyLimits.acquire(context.Background(), bucket, 0)
+	if !ok {
+		t.Fatal("slot of the panicking request was not released")
+	}
+	release()
+}
+
+func TestTrackObservesQueueWait(t *testing.T) {
+	const bucket = "stats-queue-wait"
+	withBucketConcurrencyLimits(t, bucket+"=1", 5*time.Second)
+	wait := stats_collect.S3QueueWaitHistogram.WithLabelValues(bucket)
+
+	// Hold the only slot so that the tracked request has to queue for it.
+	release, ok := bucketConcurrencyLimits.acquire(context.Background(), bucket, 0)
+	if !ok {
+		t.Fatal("could not take the slot")
+	}
+	time.AfterFunc(50*time.Millisecond, release)
+	track(authDisabled(func(w http.ResponseWriter, r *http.Request) {}), "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+
+	count, sum := observedHistogram(t, wait)
+	if count != 1 {
+		t.Fatalf("queue wait observations = %d, want 1", count)
+	}
+	if sum < 0.05 {
+		t.Errorf("queue wait = %vs, want at least 0.05s", sum)
+	}
+
+	// An unlimited request barely waits.
+	track(authDisabled(func(w http.ResponseWriter, r *http.Request) {}), "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, "stats-queue-wait-unlimited", "k", "10.0.0.1:1234"))
+	if _, sum := observedHistogram(t, stats_collect.S3QueueWaitHistogram.WithLabelValues("stats-queue-wait-unlimited")); sum >= 0.05 {
+		t.Errorf("unlimited queue wait = %vs, want less than 0.05s", sum)
+	}
+}
@@ -0,0 +1,24 @@
+package s3api
+
+import "net/http"
+
+// debugClientIP makes track echo the resolved client address, its network
+// class and the source it was resolved from in a response header, so
+// operators can see why a client is billed as internal or external. It is
+// off by default since it reveals the proxy setup to clients.
+var debugClientIP = envBool("S3_DEBUG_CLIENT_IP", false)
+
+const debugClientIPHeader = "X-SeaweedFS-Client-IP"
+
+// setDebugClientIPHeader sets debugClientIPHeader on w, e.g.
+// "203.0.113.5; class=external; source=xff". The class is the one the
+// request is billed with, which an internal header token can make internal.
+func setDebugClientIPHeader(w http.ResponseWriter, r *http.Request) {
+	_, source := resolveClientIP(r)
+	addr, network := requestClientNetwork(r)
+	value := "unknown"
+	if addr.IsValid() {
+		value = addr.String()
+	}
+	w.Header().Set(debugClientIPHeader, value+"; class="+network+"; source="+source)
+}
@@ -0,0 +1,53 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDebugClientIPHeader(t *testing.T) {
+	withPrivateAsInternal(t, false)
+	withInternalCIDRs(t, "10.0.0.0/8")
+	withTrustedProxies(t, 1, "10.0.0.0/8")
+	withInternalHeaderPeers(t, "203.0.113.0/24")
+	withInternalHeaderSecret(t, "mesh-secret")
+	old := debugClientIP
+	t.Cleanup(func() { debugClientIP = old })
+
+	tests := []struct {
+		name, remoteAddr string
+		headers          map[string]string
+		want             string
+	}{
+		{"internal peer", "10.1.2.3:1234", nil, "10.1.2.3; class=internal; source=peer"},
+		{"external peer", "203.0.113.5:1234", nil, "203.0.113.5; class=external; source=peer"},
+		{"xff", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.5"}, "203.0.113.5; class=external; source=xff"},
+		{"forwarded", "10.0.0.1:1234", map[string]string{"Forwarded": "for=10.9.9.9"}, "10.9.9.9; class=internal; source=forwarded"},
+		{"x-real-ip", "10.0.0.1:1234", map[string]string{"X-Real-IP": "203.0.113.5"}, "203.0.113.5; class=external; source=xrealip"},
+		{"internal header", "203.0.113.5:1234", map[string]string{"X-Internal-Request": internalHeaderToken([]byte("mesh-secret"), time.Now().Unix())}, "203.0.113.5; class=internal; source=peer"},
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newStatsRequest(http.MethodGet, "stats-debug-ip", "k", tt.remoteAddr)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			debugClientIP = true
+			w := httptest.NewRecorder()
+			track(ok, "GET")(w, r)
+			if got := w.Header().Get(debugClientIPHeader); got != tt.want {
+				t.Errorf("%s = %q, want %q", debugClientIPHeader, got, tt.want)
+			}
+
+			debugClientIP = false
+			w = httptest.NewRecorder()
+			track(ok, "GET")(w, r)
+			if got := w.Header().Get(debugClientIPHeader); got != "" {
+				t.Errorf("%s = %q with S3_DEBUG_CLIENT_IP disabled", debugClientIPHeader, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package s3api
+
+import (
+	"sync"
+	"time"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+const (
+	// egressRateWindow is the number of one-second slots S3BucketEgressRateGauge
+	// averages over.
+	egressRateWindow = 10
+	// egressRateIdleTimeout is how long a bucket without egress keeps its
+	// gauge, at zero, before it is pruned.
+	egressRateIdleTimeout = 5 * time.Minute
+	// maxEgressRateBuckets bounds the number of buckets with a rate gauge;
+	// egress of further buckets is only counted in the byte totals.
+	maxEgressRateBuckets = 10000
+)
+
+// bucketEgressRates maintains S3BucketEgressRateGauge, the egress of every
+// bucket in bytes per second over the last egressRateWindow seconds, for
+// tools that cannot compute rates from S3BucketTrafficSentBytesCounter.
+var bucketEgressRates = newEgressRates(time.Now)
+
+func init() {
+	go bucketEgressRates.updateEvery(time.Second)
+}
+
+type egressRates struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*egressRing
+}
+
+// egressRing holds the bytes sent in each of the last egressRateWindow
+// seconds, indexed by the Unix second modulo the window.
+type egressRing struct {
+	seconds  [egressRateWindow]int64
+	bytes    [egressRateWindow]int64
+	lastSent time.Time
+}
+
+func newEgressRates(now func() time.Time) *egressRates {
+	return &egressRates{now: now, buckets: make(map[string]*egressRing)}
+}
+
+// add records n bytes sent from bucket.
+func (e *egressRates) add(bucket string, n int64) {
+	now := e.now()
+	second := now.Unix()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ring, ok := e.buckets[bucket]
+	if !ok {
+		if len(e.buckets) >= maxEgressRateBuckets {
+			return
+		}
+		ring = &egressRing{}
+		e.buckets[bucket] = ring
+	}
+	i := second % egressRateWindow
+	if ring.seconds[i] != second {
+		ring.seconds[i], ring.bytes[i] = second, 0
+	}
+	ring.bytes[i] += n
+	ring.lastSent = now
+}
+
+// update sets the rate gauge of every bucket, letting it decay as seconds
+// with egress leave the window, and prunes the buckets idle for longer than
+// egressRateIdleTimeout.
+func (e *egressRates) update() {
+	now := e.now()
+	second := now.Unix()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for bucket, ring := range e.buckets {
+		if now.Sub(ring.lastSent) > egressRateIdleTimeout {
+			delete(e.buckets, bucket)
+			stats_collect.S3BucketEgressRateGauge.DeleteLabelValues(bucket)
+			continue
+		}
+		var sent int64
+		for i, s := range ring.seconds {
+			if second-s < egressRateWindow {
+				sent += ring.bytes[i]
+			}
+		}
+		stats_collect.S3BucketEgressRateGauge.WithLabelValues(bucket).Set(float64(sent) / egressRateWindow)
+	}
+}
+
+func (e *egressRates) updateEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		e.update()
+	}
+}
@@ -0,0 +1,46 @@
+package s3api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func TestBucketEgressRateBurstAndDecay(t *testing.T) {
+	const bucket = "stats-egress-rate"
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	e := newEgressRates(clock.now)
+	rate := func() float64 {
+		e.update()
+		return testutil.ToFloat64(stats_collect.S3BucketEgressRateGauge.WithLabelValues(bucket))
+	}
+
+	// A burst of 3000 bytes over three seconds.
+	for i := 0; i < 3; i++ {
+		e.add(bucket, 1000)
+		clock.advance(time.Second)
+	}
+	if got := rate(); got != 300 {
+		t.Errorf("rate after the burst = %v, want 300", got)
+	}
+
+	// The rate decays as the burst leaves the window.
+	clock.advance(8 * time.Second)
+	if got := rate(); got != 100 {
+		t.Errorf("rate 10s after the burst started = %v, want 100", got)
+	}
+	clock.advance(2 * time.Second)
+	if got := rate(); got != 0 {
+		t.Errorf("rate after the window = %v, want 0", got)
+	}
+
+	// Idle buckets are pruned.
+	clock.advance(egressRateIdleTimeout)
+	e.update()
+	if len(e.buckets) != 0 {
+		t.Errorf("tracked buckets = %d after the idle timeout, want 0", len(e.buckets))
+	}
+}
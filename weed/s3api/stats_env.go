@@ -0,0 +1,80 @@
+package s3api
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+)
+
+// envInt reads an integer setting for the S3 request metrics from the
+// environment, returning def when the variable is unset or malformed.
+func envInt(name string, def int) int {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		glog.Warningf("ignoring invalid %s=%q: %v", name, value, err)
+		return def
+	}
+	return n
+}
+
+// envString reads a string setting for the S3 request metrics from the
+// environment, returning def when the variable is unset or blank.
+func envString(name, def string) string {
+	if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+		return value
+	}
+	return def
+}
+
+// envBool reads a boolean setting for the S3 request metrics from the
+// environment, returning def when the variable is unset or malformed.
+func envBool(name string, def bool) bool {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		glog.Warningf("ignoring invalid %s=%q: %v", name, value, err)
+		return def
+	}
+	return b
+}
+
+// envFloat reads a floating point setting for the S3 request metrics from the
+// environment, returning def when the variable is unset or malformed.
+func envFloat(name string, def float64) float64 {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		glog.Warningf("ignoring invalid %s=%q: %v", name, value, err)
+		return def
+	}
+	return f
+}
+
+// envDuration reads a duration setting such as "500ms" for the S3 request
+// metrics from the environment, returning def when the variable is unset or
+// malformed.
+func envDuration(name string, def time.Duration) time.Duration {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		glog.Warningf("ignoring invalid %s=%q: %v", name, value, err)
+		return def
+	}
+	return d
+}
@@ -0,0 +1,191 @@
+package s3api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// bucketErrorBreakers stops sending requests to a bucket whose backends keep
+// failing. When at least S3_ERROR_BREAKER_MIN_REQUESTS requests to a bucket
+// were made within S3_ERROR_BREAKER_WINDOW and the share of 5xx responses
+// among them reaches S3_ERROR_BREAKER_THRESHOLD, e.g. 0.5, the breaker of the
+// bucket opens and its requests are rejected with 503 ServiceUnavailable.
+// After S3_ERROR_BREAKER_COOLDOWN it is half-open and lets
+// S3_ERROR_BREAKER_PROBES requests at a time through: the first probe to
+// succeed closes it, a failing probe opens it again. It is nil, and no
+// breaker ever opens, when the threshold is unset.
+var bucketErrorBreakers = newErrorBreakers(errorBreakerConfig{
+	threshold:   envFloat("S3_ERROR_BREAKER_THRESHOLD", 0),
+	window:      envDuration("S3_ERROR_BREAKER_WINDOW", 30*time.Second),
+	minRequests: envInt("S3_ERROR_BREAKER_MIN_REQUESTS", 20),
+	cooldown:    envDuration("S3_ERROR_BREAKER_COOLDOWN", 10*time.Second),
+	probes:      envInt("S3_ERROR_BREAKER_PROBES", 1),
+}, time.Now)
+
+// The S3CircuitBreakerState values.
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breakerSlots is the number of slots the rolling window is divided into.
+const breakerSlots = 10
+
+// maxErrorBreakers bounds the number of buckets with a breaker; requests to
+// further buckets are never rejected.
+const maxErrorBreakers = 10000
+
+type errorBreakerConfig struct {
+	threshold   float64
+	window      time.Duration
+	minRequests int
+	cooldown    time.Duration
+	probes      int
+}
+
+// errorBreakers holds the breakers of the buckets that have seen requests.
+type errorBreakers struct {
+	config errorBreakerConfig
+	now    func() time.Time
+
+	mu       sync.Mutex
+	breakers map[string]*errorBreaker
+}
+
+type errorBreaker struct {
+	state    breakerState
+	slots    [breakerSlots]breakerSlot
+	openedAt time.Time
+	probing  int
+}
+
+// breakerSlot counts the requests of one slot of the rolling window.
+type breakerSlot struct {
+	id             int64
+	total, errored int
+}
+
+func newErrorBreakers(config errorBreakerConfig, now func() time.Time) *errorBreakers {
+	if config.threshold <= 0 || config.window <= 0 {
+		return nil
+	}
+	if config.probes < 1 {
+		config.probes = 1
+	}
+	if config.minRequests < 1 {
+		config.minRequests = 1
+	}
+	return &errorBreakers{config: config, now: now, breakers: make(map[string]*errorBreaker)}
+}
+
+// allow reports whether a request to bucket may proceed and whether it is a
+// half-open probe. Every admitted request must be reported to done.
+func (b *errorBreakers) allow(bucket string) (probe, ok bool) {
+	if b == nil {
+		return false, true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	breaker, found := b.breakers[bucket]
+	if !found {
+		return false, true
+	}
+	switch breaker.state {
+	case breakerOpen:
+		if b.now().Sub(breaker.openedAt) < b.config.cooldown {
+			return false, false
+		}
+		b.setState(bucket, breaker, breakerHalfOpen)
+		fallthrough
+	case breakerHalfOpen:
+		if breaker.probing >= b.config.probes {
+			return false, false
+		}
+		breaker.probing++
+		return true, true
+	default:
+		return false, true
+	}
+}
+
+// cancel gives back the probe of a request admitted by allow that was
+// rejected before reaching the backend, without recording an outcome.
+func (b *errorBreakers) cancel(bucket string, probe bool) {
+	if b == nil || !probe {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if breaker, found := b.breakers[bucket]; found && breaker.probing > 0 {
+		breaker.probing--
+	}
+}
+
+// done records the outcome of a request admitted by allow.
+func (b *errorBreakers) done(bucket string, probe bool, status int) {
+	if b == nil {
+		return
+	}
+	failed := status >= http.StatusInternalServerError
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	breaker, found := b.breakers[bucket]
+	if !found {
+		if !failed || len(b.breakers) >= maxErrorBreakers {
+			return
+		}
+		breaker = &errorBreaker{}
+		b.breakers[bucket] = breaker
+	}
+	now := b.now()
+	if probe {
+		breaker.probing--
+		if failed {
+			breaker.openedAt = now
+			b.setState(bucket, breaker, breakerOpen)
+		} else {
+			breaker.slots = [breakerSlots]breakerSlot{}
+			b.setState(bucket, breaker, breakerClosed)
+		}
+		return
+	}
+	if breaker.state != breakerClosed {
+		// Admitted before the breaker opened.
+		return
+	}
+	slotLength := b.config.window / breakerSlots
+	if slotLength <= 0 {
+		slotLength = 1
+	}
+	id := now.UnixNano() / int64(slotLength)
+	slot := &breaker.slots[id%breakerSlots]
+	if slot.id != id {
+		*slot = breakerSlot{id: id}
+	}
+	slot.total++
+	if failed {
+		slot.errored++
+	}
+	var total, errored int
+	for _, s := range breaker.slots {
+		if id-s.id < breakerSlots {
+			total += s.total
+			errored += s.errored
+		}
+	}
+	if total >= b.config.minRequests && float64(errored) >= b.config.threshold*float64(total) {
+		breaker.openedAt = now
+		b.setState(bucket, breaker, breakerOpen)
+	}
+}
+
+func (b *errorBreakers) setState(bucket string, breaker *errorBreaker, state breakerState) {
+	breaker.state = state
+	stats_collect.S3CircuitBreakerState.WithLabelValues(bucket).Set(float64(state))
+}
@@ -0,0 +1,204 @@
+package s3api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// fakeClock is a settable time source for the breaker tests.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestErrorBreakers(clock *fakeClock) *errorBreakers {
+	return newErrorBreakers(errorBreakerConfig{
+		threshold:   0.5,
+		window:      10 * time.Second,
+		minRequests: 4,
+		cooldown:    5 * time.Second,
+		probes:      1,
+	}, clock.now)
+}
+
+// withErrorBreakers sets the bucket error breakers for the duration of the test.
+func withErrorBreakers(t *testing.T, b *errorBreakers) {
+	t.Helper()
+	old := bucketErrorBreakers
+	bucketErrorBreakers = b
+	t.Cleanup(func() { bucketErrorBreakers = old })
+}
+
+func TestErrorBreakerDisabled(t *testing.T) {
+	if b := newErrorBreakers(errorBreakerConfig{window: time.Second}, time.Now); b != nil {
+		t.Fatal("breakers without a threshold should be disabled")
+	}
+	var b *errorBreakers
+	b.done("bucket", false, http.StatusInternalServerError)
+	if _, ok := b.allow("bucket"); !ok {
+		t.Error("disabled breaker rejected a request")
+	}
+}
+
+func TestErrorBreakerOpensAndCloses(t *testing.T) {
+	const bucket = "stats-breaker"
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	b := newTestErrorBreakers(clock)
+	state := stats_collect.S3CircuitBreakerState.WithLabelValues(bucket)
+
+	// The error ratio stays below the threshold.
+	for _, status := range []int{200, 200, 200, 200, 500, 500, 500} {
+		if _, ok := b.allow(bucket); !ok {
+			t.Fatalf("request rejected at %d", status)
+		}
+		b.done(bucket, false, status)
+	}
+	// 4 of 8 requests failed.
+	b.done(bucket, false, http.StatusServiceUnavailable)
+	if _, ok := b.allow(bucket); ok {
+		t.Fatal("breaker did not open at the threshold")
+	}
+	if got := testutil.ToFloat64(state); got != float64(breakerOpen) {
+		t.Errorf("state = %v, want open", got)
+	}
+
+	// Half-open after the cooldown: one probe at a time.
+	clock.advance(5 * time.Second)
+	probe, ok := b.allow(bucket)
+	if !ok || !probe {
+		t.Fatalf("allow() = %v, %v after the cooldown, want a probe", probe, ok)
+	}
+	if got := testutil.ToFloat64(state); got != float64(breakerHalfOpen) {
+		t.Errorf("state = %v, want half-open", got)
+	}
+	if _, ok := b.allow(bucket); ok {
+		t.Error("second concurrent probe was admitted")
+	}
+
+	// A failing probe opens the breaker again.
+	b.done(bucket, true, http.StatusInternalServerError)
+	if _, ok := b.allow(bucket); ok {
+		t.Fatal("breaker did not reopen after a failed probe")
+	}
+
+	clock.advance(5 * time.Second)
+	probe, ok = b.allow(bucket)
+	if !ok || !probe {
+		t.Fatalf("allow() = %v, %v after the second cooldown, want a probe", probe, ok)
+	}
+	b.done(bucket, true, http.StatusOK)
+	if got := testutil.ToFloat64(state); got != float64(breakerClosed) {
+		t.Errorf("state = %v, want closed", got)
+	}
+	// The errors from before the breaker opened are forgotten.
+	if probe, ok := b.allow(bucket); !ok || probe {
+		t.Errorf("allow() = %v, %v after closing, want a regular request", probe, ok)
+	}
+	b.done(bucket, false, http.StatusInternalServerError)
+	if _, ok := b.allow(bucket); !ok {
+		t.Error("a single error reopened the breaker")
+	}
+}
+
+func TestErrorBreakerWindowExpires(t *testing.T) {
+	const bucket = "stats-breaker-window"
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	b := newTestErrorBreakers(clock)
+
+	// Too few requests to judge.
+	for i := 0; i < 3; i++ {
+		b.done(bucket, false, http.StatusInternalServerError)
+	}
+	if _, ok := b.allow(bucket); !ok {
+		t.Fatal("breaker opened below the minimum number of requests")
+	}
+	// The earlier errors have left the window by now.
+	clock.advance(11 * time.Second)
+	b.done(bucket, false, http.StatusInternalServerError)
+	if _, ok := b.allow(bucket); !ok {
+		t.Error("errors outside the window opened the breaker")
+	}
+}
+
+func TestTrackRejectsWhileBreakerOpen(t *testing.T) {
+	const bucket = "stats-breaker-track"
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	withErrorBreakers(t, newTestErrorBreakers(clock))
+
+	failing := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) }
+	for i := 0; i < 4; i++ {
+		track(authDisabled(failing), "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	}
+
+	called := false
+	handler := func(w http.ResponseWriter, r *http.Request) { called = true }
+	w := httptest.NewRecorder()
+	track(authDisabled(handler), "GET")(w, newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	if w.Code != http.StatusServiceUnavailable || called {
+		t.Fatalf("status = %d, handler called %v, want 503 without calling the handler", w.Code, called)
+	}
+
+	clock.advance(5 * time.Second)
+	w = httptest.NewRecorder()
+	track(authDisabled(handler), "GET")(w, newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	if w.Code != http.StatusOK || !called {
+		t.Fatalf("probe status = %d, handler called %v, want 200", w.Code, called)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3CircuitBreakerState.WithLabelValues(bucket)); got != float64(breakerClosed) {
+		t.Errorf("state = %v, want closed after a successful probe", got)
+	}
+}
+
+func TestConcurrencyRejectionsDoNotTripBreaker(t *testing.T) {
+	const bucket = "stats-breaker-concurrency"
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	withErrorBreakers(t, newTestErrorBreakers(clock))
+	withBucketConcurrencyLimits(t, bucket+"=1", 0)
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	request := func() int {
+		w := httptest.NewRecorder()
+		track(authDisabled(ok), "GET")(w, newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+		return w.Code
+	}
+
+	// Saturate the limit and keep it saturated past minRequests.
+	release, _ := bucketConcurrencyLimits.acquire(context.Background(), bucket, 0)
+	for i := 0; i < 8; i++ {
+		if code := request(); code != http.StatusServiceUnavailable {
+			t.Fatalf("saturated request %d: status = %d, want 503", i, code)
+		}
+	}
+	release()
+	if got := testutil.ToFloat64(stats_collect.S3CircuitBreakerState.WithLabelValues(bucket)); got != float64(breakerClosed) {
+		t.Errorf("state = %v, want closed after concurrency rejections", got)
+	}
+	if code := request(); code != http.StatusOK {
+		t.Fatalf("status = %d after releasing the slot, want 200", code)
+	}
+
+	// A half-open probe rejected by the limiter gives its probe back.
+	failing := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) }
+	for i := 0; i < 4; i++ {
+		track(authDisabled(failing), "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	}
+	clock.advance(5 * time.Second)
+	release, _ = bucketConcurrencyLimits.acquire(context.Background(), bucket, 0)
+	if code := request(); code != http.StatusServiceUnavailable {
+		t.Fatalf("probe over the limit: status = %d, want 503", code)
+	}
+	release()
+	if code := request(); code != http.StatusOK {
+		t.Fatalf("probe: status = %d, want 200", code)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3CircuitBreakerState.WithLabelValues(bucket)); got != float64(breakerClosed) {
+		t.Errorf("state = %v, want closed after a successful probe", got)
+	}
+}
@@ -0,0 +1,109 @@
+package s3api
+
+import (
+	"net/netip"
+	"os"
+	"sync"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+const (
+	// unknownCountry labels clients the GeoIP database has no country for.
+	unknownCountry = "unknown"
+	// maxGeoIPCacheEntries bounds the per-prefix lookup cache; it is cleared
+	// when full.
+	maxGeoIPCacheEntries = 1 << 16
+)
+
+// geoIP resolves external clients to countries for S3ExternalEgressByCountry.
+// It is loaded from the MaxMind database named by S3_GEOIP_DB, and nil, which
+// skips the enrichment, when none is configured or it cannot be opened.
+var geoIP = openGeoIPFromEnv()
+
+func openGeoIPFromEnv() *geoIPCountries {
+	path := os.Getenv("S3_GEOIP_DB")
+	if path == "" {
+		return nil
+	}
+	g, err := openGeoIP(path)
+	if err != nil {
+		glog.Errorf("open S3_GEOIP_DB: %v", err)
+		return nil
+	}
+	glog.V(1).Infof("loaded GeoIP database %s for s3 egress metrics", path)
+	return g
+}
+
+// geoIPCountries looks up country codes in a MaxMind database, caching the
+// result per /24 IPv4 or /48 IPv6 prefix so that most requests skip the
+// database lookup.
+type geoIPCountries struct {
+	reader *maxminddb.Reader
+
+	mu    sync.RWMutex
+	cache map[netip.Prefix]string
+}
+
+func openGeoIP(path string) (*geoIPCountries, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &geoIPCountries{reader: reader, cache: make(map[netip.Prefix]string)}, nil
+}
+
+// country returns the ISO country code of addr, or unknownCountry.
+func (g *geoIPCountries) country(addr netip.Addr) string {
+	addr = addr.Unmap()
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	key, err := addr.Prefix(bits)
+	if err != nil {
+		return unknownCountry
+	}
+	g.mu.RLock()
+	country, ok := g.cache[key]
+	g.mu.RUnlock()
+	if ok {
+		return country
+	}
+
+	result := g.reader.Lookup(addr)
+	country = unknownCountry
+	var code string
+	if result.Found() && result.DecodePath(&code, "country", "iso_code") == nil && isCountryCode(code) {
+		country = code
+	}
+	// Networks smaller than the cache prefix may differ from their
+	// neighbours, so only whole prefixes are cached.
+	if result.Err() == nil && result.Prefix().Bits() <= bits {
+		g.mu.Lock()
+		if len(g.cache) >= maxGeoIPCacheEntries {
+			g.cache = make(map[netip.Prefix]string)
+		}
+		g.cache[key] = country
+		g.mu.Unlock()
+	}
+	return country
+}
+
+// isCountryCode reports whether code is an ISO 3166-1 alpha-2 style code,
+// which keeps the country label bounded whatever the database holds.
+func isCountryCode(code string) bool {
+	return len(code) == 2 && 'A' <= code[0] && code[0] <= 'Z' && 'A' <= code[1] && code[1] <= 'Z'
+}
+
+// recordExternalEgressCountry adds bytes sent to an external client to the
+// counter of the client's country.
+func recordExternalEgressCountry(bytes int64, clientIP netip.Addr) {
+	if geoIP == nil || !clientIP.IsValid() {
+		return
+	}
+	stats_collect.S3ExternalEgressByCountry.WithLabelValues(geoIP.country(clientIP)).Add(float64(bytes))
+}
@@ -0,0 +1,97 @@
+package s3api
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// geoipFixture maps 203.0.113.0/24 to NL, 198.51.100.0/25 to JP,
+// 198.51.100.128/25 to the invalid code "not-a-country" and 2001:db8:1::/48
+// to DE.
+const geoipFixture = "testdata/geoip-country-test.mmdb"
+
+func withGeoIP(t *testing.T, g *geoIPCountries) {
+	t.Helper()
+	old := geoIP
+	geoIP = g
+	t.Cleanup(func() { geoIP = old })
+}
+
+func TestGeoIPCountry(t *testing.T) {
+	g, err := openGeoIP(geoipFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"203.0.113.5", "NL"},
+		{"::ffff:203.0.113.6", "NL"},
+		{"198.51.100.7", "JP"},
+		{"198.51.100.200", unknownCountry},
+		{"198.51.100.8", "JP"},
+		{"2001:db8:1::5", "DE"},
+		{"192.0.2.1", unknownCountry},
+		{"2001:db8:2::1", unknownCountry},
+	}
+	// Twice, to read the cached results too.
+	for i := 0; i < 2; i++ {
+		for _, tt := range tests {
+			if got := g.country(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("country(%s) = %q, want %q", tt.addr, got, tt.want)
+			}
+		}
+	}
+	// 198.51.100.0/24 is split into networks of different countries and
+	// must not be cached as a whole.
+	if _, ok := g.cache[netip.MustParsePrefix("198.51.100.0/24")]; ok {
+		t.Error("cached a /24 that spans several networks")
+	}
+	if g.cache[netip.MustParsePrefix("203.0.113.0/24")] != "NL" {
+		t.Error("expected 203.0.113.0/24 to be cached")
+	}
+}
+
+func TestExternalEgressByCountry(t *testing.T) {
+	withInternalCIDRs(t, "10.0.0.0/8")
+	g, err := openGeoIP(geoipFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withGeoIP(t, g)
+	nl := stats_collect.S3ExternalEgressByCountry.WithLabelValues("NL")
+	unknown := stats_collect.S3ExternalEgressByCountry.WithLabelValues(unknownCountry)
+	nlBefore, unknownBefore := testutil.ToFloat64(nl), testutil.ToFloat64(unknown)
+
+	const bucket = "stats-egress-country"
+	BucketTrafficSent(100, newStatsRequest(http.MethodGet, bucket, "k", "203.0.113.5:1234"))
+	BucketTrafficSent(7, newStatsRequest(http.MethodGet, bucket, "k", "192.0.2.1:1234"))
+	// Internal clients are not enriched.
+	BucketTrafficSent(1000, newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+
+	if got := testutil.ToFloat64(nl) - nlBefore; got != 100 {
+		t.Errorf("NL egress = %v, want 100", got)
+	}
+	if got := testutil.ToFloat64(unknown) - unknownBefore; got != 7 {
+		t.Errorf("unknown egress = %v, want 7", got)
+	}
+
+	// Without a database nothing is recorded.
+	withGeoIP(t, nil)
+	BucketTrafficSent(100, newStatsRequest(http.MethodGet, bucket, "k", "203.0.113.5:1234"))
+	if got := testutil.ToFloat64(nl) - nlBefore; got != 100 {
+		t.Errorf("NL egress without a database = %v, want 100", got)
+	}
+}
+
+func TestOpenGeoIPMissingFile(t *testing.T) {
+	if _, err := openGeoIP("testdata/missing.mmdb"); err == nil {
+		t.Error("expected an error for a missing database")
+	}
+}
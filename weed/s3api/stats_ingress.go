@@ -0,0 +1,42 @@
+package s3api
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// countingBody counts the bytes read from a request body.
+type countingBody struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
+
+// bytesRead returns the number of bytes read so far. It is zero for a nil body.
+func (b *countingBody) bytesRead() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.n.Load()
+}
+
+// countRequestBody wraps the body of r to count the bytes the handler consumes,
+// whether it reads Content-Length bytes or streams until EOF. Requests without
+// a body are left alone, so that handlers can still compare it to http.NoBody.
+// admitAuthenticated installs it once r is authenticated, so the signature is
+// verified against the raw body; the chunk signatures of a streaming upload
+// are verified by the handler, reading through the wrapper.
+func countRequestBody(r *http.Request) *countingBody {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	body := &countingBody{ReadCloser: r.Body}
+	r.Body = body
+	return body
+}
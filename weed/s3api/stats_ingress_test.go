@@ -0,0 +1,118 @@
+package s3api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/seaweedfs/seaweedfs/weed/s3api/s3_constants"
+	"github.com/seaweedfs/seaweedfs/weed/s3api/s3err"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// streamingBody hides the length of a reader, as a chunked upload does.
+type streamingBody struct {
+	io.Reader
+}
+
+func (streamingBody) Close() error { return nil }
+
+func TestTrackCountsRequestBytes(t *testing.T) {
+	withInternalCIDRs(t, "10.0.0.0/8")
+	const bucket = "stats-track-request-bytes"
+	received := stats_collect.S3BucketTrafficReceivedBytesCounter.WithLabelValues(bucket, noAccount)
+	external := stats_collect.S3BucketExternalReceivedBytesCounter.WithLabelValues(bucket)
+
+	upload := func(body io.ReadCloser, contentLength int64, remoteAddr string, handler http.HandlerFunc) {
+		r := newStatsRequest(http.MethodPut, bucket, "k", remoteAddr)
+		r.Body, r.ContentLength = body, contentLength
+		track(authDisabled(handler), "PUT")(httptest.NewRecorder(), r)
+	}
+	readAll := func(w http.ResponseWriter, r *http.Request) { io.Copy(io.Discard, r.Body) }
+	readLength := func(w http.ResponseWriter, r *http.Request) { io.CopyN(io.Discard, r.Body, r.ContentLength) }
+	readSome := func(w http.ResponseWriter, r *http.Request) { io.CopyN(io.Discard, r.Body, 10) }
+
+	// A streamed upload of unknown length counts everything read until EOF.
+	upload(streamingBody{strings.NewReader(strings.Repeat("x", 5000))}, -1, "203.0.113.5:1234", readAll)
+	upload(io.NopCloser(strings.NewReader(strings.Repeat("x", 300))), 300, "10.0.0.1:1234", readLength)
+	// Only the bytes the handler consumed are counted.
+	upload(io.NopCloser(strings.NewReader(strings.Repeat("x", 300))), 300, "10.0.0.1:1234", readSome)
+	// Denied requests are not counted.
+	upload(io.NopCloser(strings.NewReader(strings.Repeat("x", 300))), 300, "10.0.0.1:1234", func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		s3err.WriteErrorResponse(w, r, s3err.ErrAccessDenied)
+	})
+
+	if got := testutil.ToFloat64(received); got != 5310 {
+		t.Errorf("received bytes = %v, want 5310", got)
+	}
+	if got := testutil.ToFloat64(external); got != 5000 {
+		t.Errorf("external received bytes = %v, want 5000", got)
+	}
+}
+
+func TestCountRequestBodyKeepsNoBody(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/bucket", nil)
+	if body := countRequestBody(r); body != nil || r.Body != http.NoBody {
+		t.Errorf("request without a body was wrapped: %T", r.Body)
+	}
+	if got := (*countingBody)(nil).bytesRead(); got != 0 {
+		t.Errorf("bytesRead() of nil body = %d", got)
+	}
+}
+
+func TestTrackCountsSignedStreamingUpload(t *testing.T) {
+	iam := setupIam()
+	iam.isAuthEnabled = true
+	iam.identities[0].Account = &AccountAdmin
+	r, want := createTrailerStreamingRequest(t, true)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r = mux.SetURLVars(r, map[string]string{"bucket": "test-bucket", "object": "test-object"})
+	wire := r.ContentLength
+	received := stats_collect.S3BucketTrafficReceivedBytesCounter.WithLabelValues("test-bucket", noAccount)
+	before := testutil.ToFloat64(received)
+
+	var got string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		reader, errCode := iam.newChunkedReader(r)
+		if errCode != s3err.ErrNone {
+			s3err.WriteErrorResponse(w, r, errCode)
+			return
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			s3err.WriteErrorResponse(w, r, s3err.ErrSignatureDoesNotMatch)
+			return
+		}
+		got = string(data)
+	}
+	w := httptest.NewRecorder()
+	track(iam.Auth(handler, s3_constants.ACTION_WRITE), "PUT")(w, r)
+
+	if w.Code != http.StatusOK || got != want {
+		t.Fatalf("status %d, payload %q, want the verified payload %q", w.Code, got, want)
+	}
+	if got := testutil.ToFloat64(received) - before; got != float64(wire) {
+		t.Errorf("received bytes = %v, want the %d bytes on the wire", got, wire)
+	}
+}
+
+func TestTrackDoesNotCountUnauthenticatedBodies(t *testing.T) {
+	const bucket = "stats-track-unauthenticated-body"
+	iam := &IdentityAccessManagement{isAuthEnabled: true}
+	received := stats_collect.S3RequestBytesHistogram.WithLabelValues(bucket)
+
+	r := newStatsRequest(http.MethodPut, bucket, "k", "10.0.0.1:1234")
+	r.Body, r.ContentLength = io.NopCloser(strings.NewReader("payload")), 7
+	track(iam.Auth(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler called without authentication")
+	}, s3_constants.ACTION_WRITE), "PUT")(httptest.NewRecorder(), r)
+	if count, _ := observedHistogram(t, received); count != 0 {
+		t.Errorf("request sizes observed = %d, want 0", count)
+	}
+}
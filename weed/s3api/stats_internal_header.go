@@ -0,0 +1,87 @@
+package s3api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+)
+
+// A service mesh whose traffic may reach the gateway through NAT can mark
+// its requests as internal instead of relying on CIDRs: with
+// S3_INTERNAL_HEADER_SECRET set, a request carrying a valid token in the
+// S3_INTERNAL_HEADER header, X-Internal-Request by default, is internal
+// whatever its client address. The token is "<unix seconds>.<signature>",
+// the signature being the hex HMAC-SHA256 of the decimal seconds under the
+// secret, and is accepted for S3_INTERNAL_HEADER_MAX_SKEW around its time.
+// The header is only honored from the peers in
+// S3_INTERNAL_HEADER_TRUSTED_CIDRS, such as the mesh gateways or the NAT in
+// front of them, so that external clients cannot replay a token they got hold
+// of; from anyone else, and from everyone while the list is empty, it is
+// ignored. The list is independent of the trusted proxies.
+var (
+	internalHeaderSecret       = []byte(os.Getenv("S3_INTERNAL_HEADER_SECRET"))
+	internalHeaderName         = envString("S3_INTERNAL_HEADER", "X-Internal-Request")
+	internalHeaderMaxSkew      = envDuration("S3_INTERNAL_HEADER_MAX_SKEW", 5*time.Minute)
+	internalHeaderPeerPrefixes = parseCIDRsFromEnv("S3_INTERNAL_HEADER_TRUSTED_CIDRS")
+)
+
+// warnInternalHeaderConfig warns at startup when S3_INTERNAL_HEADER_SECRET is
+// set without S3_INTERNAL_HEADER_TRUSTED_CIDRS, which leaves every internal
+// header token ignored.
+func warnInternalHeaderConfig() {
+	if len(internalHeaderSecret) > 0 && len(internalHeaderPeerPrefixes) == 0 {
+		glog.Warningf("S3_INTERNAL_HEADER_SECRET has no effect: S3_INTERNAL_HEADER_TRUSTED_CIDRS is empty, so %s is ignored from every peer", internalHeaderName)
+	}
+}
+
+// classifyRequestNetwork returns the network class of r, whose client
+// address is addr: internal when r carries a valid internal header token,
+// the class of addr otherwise.
+func classifyRequestNetwork(r *http.Request, addr netip.Addr) string {
+	if hasValidInternalHeader(r, time.Now()) {
+		return networkInternal
+	}
+	return classifyNetwork(addr)
+}
+
+// hasValidInternalHeader reports whether r, received from a peer in
+// internalHeaderPeerPrefixes, carries an internal header token that is valid
+// at now.
+func hasValidInternalHeader(r *http.Request, now time.Time) bool {
+	if len(internalHeaderSecret) == 0 {
+		return false
+	}
+	token := r.Header.Get(internalHeaderName)
+	if token == "" || !addrInPrefixes(remoteAddr(r), internalHeaderPeerPrefixes) {
+		return false
+	}
+	seconds, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	unix, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return false
+	}
+	if skew := now.Sub(time.Unix(unix, 0)); skew > internalHeaderMaxSkew || skew < -internalHeaderMaxSkew {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(internalHeaderToken(internalHeaderSecret, unix)))
+}
+
+// internalHeaderToken returns the internal header token for the Unix time
+// unix under secret.
+func internalHeaderToken(secret []byte, unix int64) string {
+	seconds := strconv.FormatInt(unix, 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(seconds))
+	return seconds + "." + hex.EncodeToString(mac.Sum(nil))
+}
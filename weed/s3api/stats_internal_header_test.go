@@ -0,0 +1,110 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// withInternalHeaderSecret sets internalHeaderSecret for the duration of the
+// test.
+func withInternalHeaderSecret(t *testing.T, secret string) {
+	t.Helper()
+	old := internalHeaderSecret
+	internalHeaderSecret = []byte(secret)
+	t.Cleanup(func() { internalHeaderSecret = old })
+}
+
+// withInternalHeaderPeers sets internalHeaderPeerPrefixes for the duration
+// of the test.
+func withInternalHeaderPeers(t *testing.T, cidrs string) {
+	t.Helper()
+	old := internalHeaderPeerPrefixes
+	internalHeaderPeerPrefixes = parseCIDRs(cidrs)
+	t.Cleanup(func() { internalHeaderPeerPrefixes = old })
+}
+
+func TestInternalHeader(t *testing.T) {
+	withPrivateAsInternal(t, false)
+	withInternalCIDRs(t, "")
+	// No proxy hops: the header peers are trusted on their own.
+	withTrustedProxies(t, 0, "")
+	withInternalHeaderPeers(t, "192.0.2.0/24")
+	withInternalHeaderSecret(t, "mesh-secret")
+	now := time.Now()
+	valid := internalHeaderToken([]byte("mesh-secret"), now.Unix())
+	tests := []struct {
+		name       string
+		remoteAddr string
+		token      string
+		want       string
+	}{
+		{"valid token", "192.0.2.10:1234", valid, networkInternal},
+		{"missing token", "192.0.2.10:1234", "", networkExternal},
+		{"wrong secret", "192.0.2.10:1234", internalHeaderToken([]byte("other-secret"), now.Unix()), networkExternal},
+		{"tampered time", "192.0.2.10:1234", strconv.FormatInt(now.Unix()+1, 10) + valid[len(strconv.FormatInt(now.Unix(), 10)):], networkExternal},
+		{"expired token", "192.0.2.10:1234", internalHeaderToken([]byte("mesh-secret"), now.Add(-10*time.Minute).Unix()), networkExternal},
+		{"malformed token", "192.0.2.10:1234", "not-a-token", networkExternal},
+		{"untrusted peer", "203.0.113.5:1234", valid, networkExternal},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/bucket/key", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if tt.token != "" {
+			r.Header.Set("X-Internal-Request", tt.token)
+		}
+		if _, got := requestClientNetwork(r); got != tt.want {
+			t.Errorf("%s: network = %q, want %q", tt.name, got, tt.want)
+		}
+		if got := IsInternalFromContext(withClientIP(r).Context()); got != (tt.want == networkInternal) {
+			t.Errorf("%s: IsInternalFromContext() = %v", tt.name, got)
+		}
+	}
+}
+
+func TestInternalHeaderDisabled(t *testing.T) {
+	withPrivateAsInternal(t, false)
+	withInternalCIDRs(t, "")
+	withInternalHeaderPeers(t, "192.0.2.0/24")
+	withInternalHeaderSecret(t, "")
+	r := httptest.NewRequest(http.MethodGet, "/bucket/key", nil)
+	r.RemoteAddr = "192.0.2.10:1234"
+	r.Header.Set("X-Internal-Request", internalHeaderToken(nil, time.Now().Unix()))
+	if _, internal := requestClientIP(r); internal {
+		t.Error("honored the internal header without a secret")
+	}
+}
+
+func TestInternalHeaderIgnoresTrustedProxies(t *testing.T) {
+	withPrivateAsInternal(t, false)
+	withInternalCIDRs(t, "")
+	withInternalHeaderSecret(t, "mesh-secret")
+	valid := internalHeaderToken([]byte("mesh-secret"), time.Now().Unix())
+	r := httptest.NewRequest(http.MethodGet, "/bucket/key", nil)
+	r.RemoteAddr = "192.0.2.10:1234"
+	r.Header.Set("X-Internal-Request", valid)
+
+	// A trusted proxy is not a trusted header peer.
+	withTrustedProxies(t, 1, "192.0.2.0/24")
+	withInternalHeaderPeers(t, "")
+	if _, internal := requestClientIP(r); internal {
+		t.Error("honored the internal header from a trusted proxy outside S3_INTERNAL_HEADER_TRUSTED_CIDRS")
+	}
+	withInternalHeaderPeers(t, "198.51.100.0/24")
+	if _, internal := requestClientIP(r); internal {
+		t.Error("honored the internal header from an untrusted peer")
+	}
+}
+
+func TestInternalHeaderKeepsCIDRMatching(t *testing.T) {
+	withPrivateAsInternal(t, false)
+	withInternalCIDRs(t, "10.0.0.0/8")
+	withInternalHeaderSecret(t, "mesh-secret")
+	r := httptest.NewRequest(http.MethodGet, "/bucket/key", nil)
+	r.RemoteAddr = "10.1.2.3:1234"
+	if _, internal := requestClientIP(r); !internal {
+		t.Error("internal CIDR client without a token is not internal")
+	}
+}
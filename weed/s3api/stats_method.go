@@ -0,0 +1,10 @@
+package s3api
+
+import "net/http"
+
+// isDisallowedMethod reports whether method is one an S3 gateway never
+// serves: TRACE, which would echo credentials back, and CONNECT, which would
+// turn it into a proxy. track rejects them before they reach a handler.
+func isDisallowedMethod(method string) bool {
+	return method == http.MethodTrace || method == http.MethodConnect
+}
@@ -0,0 +1,37 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func TestTrackRejectsDisallowedMethods(t *testing.T) {
+	const bucket = "stats-disallowed-method"
+	for _, method := range []string{http.MethodTrace, http.MethodConnect, http.MethodGet} {
+		counter := stats_collect.S3DisallowedMethodCounter.WithLabelValues(method)
+		before := testutil.ToFloat64(counter)
+		called := false
+		w := httptest.NewRecorder()
+		track(func(w http.ResponseWriter, r *http.Request) { called = true }, method)(w, newStatsRequest(method, bucket, "k", "203.0.113.5:1234"))
+
+		disallowed := method != http.MethodGet
+		if disallowed && w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s: status = %d, want 405", method, w.Code)
+		}
+		if called == disallowed {
+			t.Errorf("%s: handler called = %v", method, called)
+		}
+		want := 0.0
+		if disallowed {
+			want = 1
+		}
+		if got := testutil.ToFloat64(counter) - before; got != want {
+			t.Errorf("%s: disallowed requests = %v, want %v", method, got, want)
+		}
+	}
+}
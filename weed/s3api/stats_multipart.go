@@ -0,0 +1,137 @@
+package s3api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/seaweedfs/seaweedfs/weed/s3api/s3_constants"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// activeMultipartUploads counts the multipart uploads per bucket that were
+// created but not yet completed or aborted. The count is kept here rather
+// than derived from the gauge so that it never drops below zero for uploads
+// created before the gateway started. The gauge is deliberately not removed
+// when a bucket becomes idle: leaked uploads are exactly what it is for.
+var activeMultipartUploads = struct {
+	sync.Mutex
+	counts map[string]int64
+}{counts: make(map[string]int64)}
+
+// trackMultipartUpload updates the active multipart upload gauge after a
+// CreateMultipartUpload, CompleteMultipartUpload or AbortMultipartUpload
+// request, whose S3 action is s3Action, finished with status.
+func trackMultipartUpload(s3Action string, r *http.Request, status int, bucket string) {
+	if status/100 != 2 || bucket == "" {
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		return
+	}
+	var delta int64
+	switch s3Action {
+	case s3_constants.S3_ACTION_CREATE_MULTIPART:
+		delta = 1
+	case s3_constants.S3_ACTION_COMPLETE_MULTIPART:
+		delta = -1
+		multipartLifetimes.finish(bucket, r.URL.Query().Get("uploadId"), multipartCompleted)
+	case s3_constants.S3_ACTION_ABORT_MULTIPART:
+		delta = -1
+		multipartLifetimes.finish(bucket, r.URL.Query().Get("uploadId"), multipartAborted)
+	default:
+		return
+	}
+
+	activeMultipartUploads.Lock()
+	defer activeMultipartUploads.Unlock()
+	count := activeMultipartUploads.counts[bucket] + delta
+	if count < 0 {
+		count = 0
+	}
+	activeMultipartUploads.counts[bucket] = count
+	stats_collect.S3ActiveMultipartUploads.WithLabelValues(bucket).Set(float64(count))
+}
+
+// The S3MultipartLifetimeHistogram outcomes.
+const (
+	multipartCompleted = "completed"
+	multipartAborted   = "aborted"
+)
+
+const (
+	// maxMultipartLifetimes bounds the number of open uploads whose creation
+	// time is remembered; the lifetime of further uploads is not observed.
+	maxMultipartLifetimes = 10000
+	// multipartLifetimeSweepInterval is how often uploads older than the
+	// maximum age are evicted.
+	multipartLifetimeSweepInterval = time.Minute
+)
+
+// multipartLifetimes remembers when the multipart uploads open on this
+// gateway were created, so that S3MultipartLifetimeHistogram can observe how
+// long each stayed open. Uploads that neither complete nor abort within
+// S3_MULTIPART_LIFETIME_MAX_AGE are abandoned: they are evicted and never
+// observed.
+var multipartLifetimes = newMultipartLifetimeTracker(envDuration("S3_MULTIPART_LIFETIME_MAX_AGE", 7*24*time.Hour), time.Now)
+
+type multipartLifetimeTracker struct {
+	maxAge time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	created   map[string]time.Time
+	lastSweep time.Time
+}
+
+func newMultipartLifetimeTracker(maxAge time.Duration, now func() time.Time) *multipartLifetimeTracker {
+	return &multipartLifetimeTracker{maxAge: maxAge, now: now, created: make(map[string]time.Time)}
+}
+
+// MultipartUploadCreated records that the multipart upload uploadID was
+// created.
+func MultipartUploadCreated(uploadID string) {
+	multipartLifetimes.add(uploadID)
+}
+
+// add remembers that uploadID was created now.
+func (m *multipartLifetimeTracker) add(uploadID string) {
+	if uploadID == "" {
+		return
+	}
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.lastSweep) >= multipartLifetimeSweepInterval || len(m.created) >= maxMultipartLifetimes {
+		m.evict(now)
+	}
+	if len(m.created) >= maxMultipartLifetimes {
+		return
+	}
+	m.created[uploadID] = now
+}
+
+// evict forgets the uploads older than the maximum age. The caller holds
+// m.mu.
+func (m *multipartLifetimeTracker) evict(now time.Time) {
+	m.lastSweep = now
+	for uploadID, created := range m.created {
+		if now.Sub(created) > m.maxAge {
+			delete(m.created, uploadID)
+		}
+	}
+}
+
+// finish observes the lifetime of uploadID in bucket, which ended with
+// outcome, if its creation was recorded.
+func (m *multipartLifetimeTracker) finish(bucket, uploadID, outcome string) {
+	now := m.now()
+	m.mu.Lock()
+	created, ok := m.created[uploadID]
+	delete(m.created, uploadID)
+	m.mu.Unlock()
+	if !ok || now.Sub(created) > m.maxAge {
+		return
+	}
+	stats_collect.S3MultipartLifetimeHistogram.WithLabelValues(bucket, outcome).Observe(now.Sub(created).Seconds())
+}
@@ -0,0 +1,102 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/seaweedfs/seaweedfs/weed/s3api/s3err"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func TestTrackActiveMultipartUploads(t *testing.T) {
+	const bucket = "stats-multipart"
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	missing := func(w http.ResponseWriter, r *http.Request) { s3err.WriteErrorResponse(w, r, s3err.ErrNoSuchUpload) }
+	request := func(method, query string) *http.Request {
+		r := newStatsRequest(method, bucket, "k", "10.0.0.1:1234")
+		r.URL.RawQuery = query
+		return r
+	}
+	gauge := func() float64 {
+		return testutil.ToFloat64(stats_collect.S3ActiveMultipartUploads.WithLabelValues(bucket))
+	}
+
+	steps := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		query   string
+		want    float64
+	}{
+		{"create", ok, http.MethodPost, "uploads", 1},
+		{"create another", ok, http.MethodPost, "uploads", 2},
+		{"complete", ok, http.MethodPost, "uploadId=1", 1},
+		{"upload part", ok, http.MethodPut, "partNumber=1&uploadId=2", 1},
+		{"failed abort", missing, http.MethodDelete, "uploadId=3", 1},
+		{"abort", ok, http.MethodDelete, "uploadId=2", 0},
+		{"abort of an uncounted upload", ok, http.MethodDelete, "uploadId=4", 0},
+		{"create after clamping", ok, http.MethodPost, "uploads", 1},
+	}
+	for _, step := range steps {
+		track(step.handler, step.method)(httptest.NewRecorder(), request(step.method, step.query))
+		if got := gauge(); got != step.want {
+			t.Errorf("after %s: active uploads = %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+// withMultipartLifetimes replaces multipartLifetimes, with the given maximum
+// age and clock, for the duration of the test.
+func withMultipartLifetimes(t *testing.T, maxAge time.Duration, clock *fakeClock) {
+	t.Helper()
+	old := multipartLifetimes
+	multipartLifetimes = newMultipartLifetimeTracker(maxAge, clock.now)
+	t.Cleanup(func() { multipartLifetimes = old })
+}
+
+func TestTrackMultipartLifetime(t *testing.T) {
+	const bucket = "stats-multipart-lifetime"
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	withMultipartLifetimes(t, time.Hour, clock)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	finish := func(method, uploadID string) {
+		r := newStatsRequest(method, bucket, "k", "10.0.0.1:1234")
+		r.URL.RawQuery = "uploadId=" + uploadID
+		track(ok, method)(httptest.NewRecorder(), r)
+	}
+	completed := stats_collect.S3MultipartLifetimeHistogram.WithLabelValues(bucket, multipartCompleted)
+	aborted := stats_collect.S3MultipartLifetimeHistogram.WithLabelValues(bucket, multipartAborted)
+
+	MultipartUploadCreated("completed-upload")
+	clock.advance(90 * time.Second)
+	finish(http.MethodPost, "completed-upload")
+	if count, sum := observedHistogram(t, completed); count != 1 || sum != 90 {
+		t.Errorf("completed lifetimes = %d observations summing to %v, want 1 of 90s", count, sum)
+	}
+
+	// An abandoned upload is evicted by the next sweep after it gets too
+	// old, and a late abort is not observed.
+	MultipartUploadCreated("abandoned-upload")
+	clock.advance(2 * time.Hour)
+	MultipartUploadCreated("new-upload")
+	if _, ok := multipartLifetimes.created["abandoned-upload"]; ok {
+		t.Error("abandoned upload was not evicted")
+	}
+	finish(http.MethodDelete, "abandoned-upload")
+	if count, _ := observedHistogram(t, aborted); count != 0 {
+		t.Errorf("aborted lifetimes = %d observations, want none for an evicted upload", count)
+	}
+
+	clock.advance(time.Minute)
+	finish(http.MethodDelete, "new-upload")
+	if count, sum := observedHistogram(t, aborted); count != 1 || sum != 60 {
+		t.Errorf("aborted lifetimes = %d observations summing to %v, want 1 of 60s", count, sum)
+	}
+	if n := len(multipartLifetimes.created); n != 0 {
+		t.Errorf("%d uploads still remembered, want 0", n)
+	}
+}
@@ -0,0 +1,251 @@
+package s3api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"go4.org/netipx"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// internalSet holds the networks whose traffic is not billed as external
+// egress. It is loaded from the file named by S3_INTERNAL_CIDRS_FILE when set,
+// otherwise from S3_INTERNAL_CIDRS. Entries prefixed with '!' carve ranges out
+// of the set, e.g. "10.0.0.0/8,!10.8.8.0/24". The set is swapped atomically by
+// ReloadInternalCIDRs so in-flight requests never observe a partial set.
+var internalSet atomic.Pointer[netipx.IPSet]
+
+// internalExcludedSet holds the '!' exclusions of the internal CIDRs. They
+// are already removed from internalSet; classifyNetwork also lets them
+// override treatPrivateAsInternal and the client groups.
+var internalExcludedSet atomic.Pointer[netipx.IPSet]
+
+// semiInternalSet holds the networks, such as a CDN edge, whose traffic is
+// neither internal nor fully external. It is loaded from
+// S3_SEMI_INTERNAL_CIDRS with the internal set; internal networks take
+// precedence over it.
+var semiInternalSet atomic.Pointer[netipx.IPSet]
+
+// Network classes of client addresses.
+const (
+	networkInternal = "internal"
+	networkSemi     = "semi"
+	networkExternal = "external"
+)
+
+var internalCIDRsFile = os.Getenv("S3_INTERNAL_CIDRS_FILE")
+
+func init() {
+	ReloadInternalCIDRs()
+}
+
+// buildIPSet returns the set of the prefixes minus the excluded prefixes.
+func buildIPSet(prefixes, excluded []netip.Prefix) *netipx.IPSet {
+	var builder netipx.IPSetBuilder
+	for _, prefix := range prefixes {
+		builder.AddPrefix(prefix)
+	}
+	for _, prefix := range excluded {
+		builder.RemovePrefix(prefix)
+	}
+	set, err := builder.IPSet()
+	if err != nil {
+		glog.Warningf("build CIDR set: %v", err)
+	}
+	return set
+}
+
+// ipSetContains reports whether set contains addr. IPv4-mapped addresses
+// match the IPv4 ranges containing them. A nil set is empty.
+func ipSetContains(set *netipx.IPSet, addr netip.Addr) bool {
+	return set != nil && addr.IsValid() && set.Contains(addr.Unmap())
+}
+
+// parseIPSetList parses a CIDR list in the S3_INTERNAL_CIDRS format. Entries
+// starting with '!' are exclusions: buildIPSet removes them with
+// IPSetBuilder.RemovePrefix after all other entries have been added, so an
+// exclusion always wins over a broader range no matter where either appears
+// in the list.
+func parseIPSetList(s string) (prefixes, excluded []netip.Prefix, invalid []string) {
+	for _, entry := range splitCIDRList(s) {
+		negated := strings.HasPrefix(entry, "!")
+		prefix, ok := parseCIDR(strings.TrimPrefix(entry, "!"))
+		switch {
+		case !ok:
+			invalid = append(invalid, entry)
+		case negated:
+			excluded = append(excluded, prefix)
+		default:
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes, excluded, invalid
+}
+
+// readIPSetEnv reads the CIDR list in the named variable. Invalid entries are
+// logged, counted in S3CIDRParseErrors and skipped.
+func readIPSetEnv(name string) (prefixes, excluded []netip.Prefix) {
+	prefixes, excluded, invalid := parseIPSetList(os.Getenv(name))
+	for _, entry := range invalid {
+		glog.Warningf("%s: skipping invalid CIDR %q", name, entry)
+		stats_collect.S3CIDRParseErrors.WithLabelValues("env").Inc()
+	}
+	return prefixes, excluded
+}
+
+// readIPSetFile reads a file in the S3_INTERNAL_CIDRS format. Text after '#'
+// on a line is a comment. Invalid entries are logged, counted in
+// S3CIDRParseErrors and skipped.
+func readIPSetFile(path string) (prefixes, excluded []netip.Prefix, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		linePrefixes, lineExcluded, invalid := parseIPSetList(line)
+		prefixes = append(prefixes, linePrefixes...)
+		excluded = append(excluded, lineExcluded...)
+		for _, entry := range invalid {
+			glog.Warningf("%s: skipping invalid CIDR %q", path, entry)
+			stats_collect.S3CIDRParseErrors.WithLabelValues("file").Inc()
+		}
+	}
+	return prefixes, excluded, nil
+}
+
+// buildIPSetFromEnv builds a set from the CIDR list in the named variable.
+func buildIPSetFromEnv(name string) *netipx.IPSet {
+	return buildIPSet(readIPSetEnv(name))
+}
+
+// buildIPSetFromFile builds a set from a file in the S3_INTERNAL_CIDRS format.
+func buildIPSetFromFile(path string) (*netipx.IPSet, error) {
+	prefixes, excluded, err := readIPSetFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return buildIPSet(prefixes, excluded), nil
+}
+
+// ReloadInternalCIDRs rebuilds the internal set and replaces it. It is
+// registered as a SIGHUP reload hook and runs whenever the CIDR file changes.
+// If the file cannot be read the current set is kept.
+func ReloadInternalCIDRs() {
+	var prefixes, excluded []netip.Prefix
+	loaded := false
+	if internalCIDRsFile != "" {
+		var err error
+		prefixes, excluded, err = readIPSetFile(internalCIDRsFile)
+		if err == nil {
+			loaded = true
+		} else if internalSet.Load() != nil {
+			glog.Errorf("keeping current internal CIDRs: %v", err)
+			return
+		} else {
+			glog.Errorf("load internal CIDRs, falling back to S3_INTERNAL_CIDRS: %v", err)
+		}
+	}
+	if !loaded {
+		prefixes, excluded = readIPSetEnv("S3_INTERNAL_CIDRS")
+	}
+	set := buildIPSet(prefixes, excluded)
+	internalExcludedSet.Store(buildIPSet(excluded, nil))
+	internalSet.Store(set)
+	// The loaded prefixes, after merging and carving out the exclusions.
+	count := len(set.Prefixes())
+	stats_collect.S3InternalCIDRCount.Set(float64(count))
+	semiSet := buildIPSetFromEnv("S3_SEMI_INTERNAL_CIDRS")
+	semiInternalSet.Store(semiSet)
+	glog.V(1).Infof("loaded %d internal and %d semi-internal CIDRs for s3 traffic metrics", count, len(semiSet.Prefixes()))
+}
+
+// WatchInternalCIDRsFile reloads the internal set whenever the file named by
+// S3_INTERNAL_CIDRS_FILE changes. It does nothing when no file is configured.
+func WatchInternalCIDRsFile() {
+	if internalCIDRsFile == "" {
+		return
+	}
+	if _, err := watchFile(internalCIDRsFile, ReloadInternalCIDRs); err != nil {
+		glog.Errorf("watch internal CIDRs file: %v", err)
+	}
+}
+
+// watchFile calls onChange after every change to path. The parent directory
+// is watched so that atomic replacements, such as Kubernetes ConfigMap
+// updates which swap a symlink, are noticed too.
+func watchFile(path string, onChange func()) (io.Closer, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("watch %s: %w", path, err)
+	}
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) || event.Has(fsnotify.Rename) || event.Has(fsnotify.Remove) {
+					onChange()
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				glog.Warningf("watch %s: %v", path, err)
+			}
+		}
+	}()
+	return watcher, nil
+}
+
+// treatPrivateAsInternal counts loopback, RFC 1918 / RFC 4193 private and
+// link-local addresses as internal even when they are not listed in the
+// internal CIDRs, so a misconfigured proxy cannot bill them as external.
+var treatPrivateAsInternal = envBool("S3_TREAT_PRIVATE_AS_INTERNAL", true)
+
+// _isInternal reports whether ip belongs to an internal network.
+func _isInternal(ip netip.Addr) bool {
+	return classifyNetwork(ip) == networkInternal
+}
+
+// classifyNetwork returns networkInternal, networkSemi or networkExternal for
+// ip. IPv4-mapped addresses are classified like their IPv4 form. The client
+// groups are internal too. An exclusion in the internal set also overrides
+// treatPrivateAsInternal and the groups.
+func classifyNetwork(ip netip.Addr) string {
+	ip = ip.Unmap()
+	if !ipSetContains(internalExcludedSet.Load(), ip) {
+		if treatPrivateAsInternal && (ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast()) {
+			return networkInternal
+		}
+		if ipSetContains(internalSet.Load(), ip) || clientGroup(ip) != noClientGroup {
+			return networkInternal
+		}
+	}
+	if ipSetContains(semiInternalSet.Load(), ip) {
+		return networkSemi
+	}
+	return networkExternal
+}
+
+// clientOrigin labels a request "internal", "semi" or "external" by its
+// client IP.
+func clientOrigin(r *http.Request) string {
+	_, network := requestClientNetwork(r)
+	return network
+}
@@ -0,0 +1,314 @@
+package s3api
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// withInternalCIDRs loads cidrs as the internal set for the duration of the test.
+func withInternalCIDRs(t *testing.T, cidrs string) {
+	t.Helper()
+	// Registered first so it runs after the environment has been restored.
+	t.Cleanup(ReloadInternalCIDRs)
+	t.Setenv("S3_INTERNAL_CIDRS", cidrs)
+	ReloadInternalCIDRs()
+}
+
+// withInternalCIDRsFile loads the internal set from path for the duration of the test.
+func withInternalCIDRsFile(t *testing.T, path string) {
+	t.Helper()
+	t.Cleanup(ReloadInternalCIDRs)
+	oldFile := internalCIDRsFile
+	internalCIDRsFile = path
+	t.Cleanup(func() { internalCIDRsFile = oldFile })
+	ReloadInternalCIDRs()
+}
+
+// withSemiInternalCIDRs loads cidrs as the semi-internal set for the duration
+// of the test.
+func withSemiInternalCIDRs(t *testing.T, cidrs string) {
+	t.Helper()
+	t.Cleanup(ReloadInternalCIDRs)
+	t.Setenv("S3_SEMI_INTERNAL_CIDRS", cidrs)
+	ReloadInternalCIDRs()
+}
+
+// withPrivateAsInternal sets treatPrivateAsInternal for the duration of the
+// test. The CIDR set tests below use private ranges and disable it.
+func withPrivateAsInternal(t *testing.T, enabled bool) {
+	t.Helper()
+	old := treatPrivateAsInternal
+	treatPrivateAsInternal = enabled
+	t.Cleanup(func() { treatPrivateAsInternal = old })
+}
+
+func TestReloadInternalCIDRs(t *testing.T) {
+	withPrivateAsInternal(t, false)
+	withInternalCIDRs(t, "10.0.0.0/8")
+	oldNet, newNet := netip.MustParseAddr("10.1.2.3"), netip.MustParseAddr("192.168.1.1")
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				// A loaded set is either the old or the new one, never a mix.
+				set := internalSet.Load()
+				if set.Contains(oldNet) == set.Contains(newNet) {
+					t.Error("observed a partially swapped internal set")
+					return
+				}
+			}
+		}()
+	}
+
+	if !_isInternal(oldNet) || _isInternal(newNet) {
+		t.Fatalf("before reload: got %v/%v, want true/false", _isInternal(oldNet), _isInternal(newNet))
+	}
+	t.Setenv("S3_INTERNAL_CIDRS", "192.168.0.0/16")
+	ReloadInternalCIDRs()
+	if _isInternal(oldNet) || !_isInternal(newNet) {
+		t.Fatalf("after reload: got %v/%v, want false/true", _isInternal(oldNet), _isInternal(newNet))
+	}
+
+	close(stop)
+	wg.Wait()
+}
+
+func TestIPv4MappedAddressesAreInternal(t *testing.T) {
+	withPrivateAsInternal(t, false)
+	withInternalCIDRs(t, "10.0.0.0/8")
+	for _, addr := range []string{"10.1.2.3", "::ffff:10.1.2.3"} {
+		if !_isInternal(netip.MustParseAddr(addr)) {
+			t.Errorf("expected %s to be internal", addr)
+		}
+	}
+	if _isInternal(netip.MustParseAddr("::ffff:203.0.113.5")) {
+		t.Error("expected ::ffff:203.0.113.5 to be external")
+	}
+}
+
+func TestIsInternalEmptySet(t *testing.T) {
+	withPrivateAsInternal(t, false)
+	withInternalCIDRs(t, "")
+	if _isInternal(netip.MustParseAddr("10.1.2.3")) {
+		t.Error("empty internal set classified address as internal")
+	}
+	if _isInternal(netip.Addr{}) {
+		t.Error("invalid address classified as internal")
+	}
+}
+
+func TestExcludedCIDRs(t *testing.T) {
+	tests := []struct {
+		addr     string
+		internal bool
+	}{
+		{"10.1.2.3", true},
+		{"10.8.8.1", false},
+		{"::ffff:10.8.8.1", false},
+		{"10.8.9.1", true},
+		{"203.0.113.5", false},
+	}
+	// The exclusion applies wherever it appears in the list.
+	for _, cidrs := range []string{"10.0.0.0/8,!10.8.8.0/24", "!10.8.8.0/24 10.0.0.0/8"} {
+		withInternalCIDRs(t, cidrs)
+		for _, privateAsInternal := range []bool{false, true} {
+			withPrivateAsInternal(t, privateAsInternal)
+			for _, tt := range tests {
+				if got := _isInternal(netip.MustParseAddr(tt.addr)); got != tt.internal {
+					t.Errorf("%q, private as internal %v: _isInternal(%s) = %v, want %v", cidrs, privateAsInternal, tt.addr, got, tt.internal)
+				}
+			}
+		}
+	}
+}
+
+func TestInvalidExcludedCIDR(t *testing.T) {
+	prefixes, excluded, invalid := parseIPSetList("10.0.0.0/8 !bogus ! !10.8.8.0/24")
+	if len(prefixes) != 1 || len(excluded) != 1 || excluded[0].String() != "10.8.8.0/24" {
+		t.Errorf("parseIPSetList() = %v, %v", prefixes, excluded)
+	}
+	if len(invalid) != 2 {
+		t.Errorf("invalid = %q, want 2 entries", invalid)
+	}
+}
+
+func TestClassifyNetwork(t *testing.T) {
+	withPrivateAsInternal(t, false)
+	withInternalCIDRs(t, "10.0.0.0/8,!10.8.8.0/24")
+	withSemiInternalCIDRs(t, "198.51.100.0/24,10.9.0.0/16,10.8.8.0/24")
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"10.1.2.3", networkInternal},
+		// Internal takes precedence over semi-internal.
+		{"10.9.1.1", networkInternal},
+		// An internal exclusion can still be semi-internal.
+		{"10.8.8.1", networkSemi},
+		{"198.51.100.7", networkSemi},
+		{"::ffff:198.51.100.7", networkSemi},
+		{"203.0.113.5", networkExternal},
+	}
+	for _, tt := range tests {
+		if got := classifyNetwork(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("classifyNetwork(%s) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+	if _isInternal(netip.MustParseAddr("198.51.100.7")) {
+		t.Error("semi-internal address classified as internal")
+	}
+}
+
+func TestPrivateAddressesAreInternal(t *testing.T) {
+	withInternalCIDRs(t, "")
+	tests := []struct {
+		addr     string
+		internal bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.1.2.3", true},
+		{"172.16.5.4", true},
+		{"192.168.1.1", true},
+		{"fd00::1", true},
+		{"169.254.1.1", true},
+		{"fe80::1", true},
+		{"203.0.113.5", false},
+		{"2001:db8::1", false},
+	}
+	for _, tt := range tests {
+		addr := netip.MustParseAddr(tt.addr)
+		withPrivateAsInternal(t, true)
+		if got := _isInternal(addr); got != tt.internal {
+			t.Errorf("_isInternal(%s) = %v, want %v", tt.addr, got, tt.internal)
+		}
+		withPrivateAsInternal(t, false)
+		if _isInternal(addr) {
+			t.Errorf("_isInternal(%s) = true with S3_TREAT_PRIVATE_AS_INTERNAL=false and no CIDRs", tt.addr)
+		}
+	}
+}
+
+func TestBuildIPSetFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "internal-cidrs")
+	content := "# internal networks\n10.0.0.0/8, 172.16.0.0/12\n192.168.0.0/16; 999.1.1.1/8 # bogus\nnot-a-cidr\n2001:db8::/32\n!2001:db8:1::/48 # proxy\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	errorsBefore := testutil.ToFloat64(stats_collect.S3CIDRParseErrors.WithLabelValues("file"))
+
+	set, err := buildIPSetFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range []string{"10.1.2.3", "172.16.5.4", "192.168.1.1", "2001:db8::7"} {
+		if !set.Contains(netip.MustParseAddr(addr)) {
+			t.Errorf("file set does not contain %s", addr)
+		}
+	}
+	for _, addr := range []string{"8.8.8.8", "2001:db8:1::7"} {
+		if set.Contains(netip.MustParseAddr(addr)) {
+			t.Errorf("file set contains %s", addr)
+		}
+	}
+	if got := testutil.ToFloat64(stats_collect.S3CIDRParseErrors.WithLabelValues("file")) - errorsBefore; got != 2 {
+		t.Errorf("parse errors = %v, want 2", got)
+	}
+
+	if _, err := buildIPSetFromFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected error for a missing file")
+	}
+}
+
+func TestInternalCIDRsFileTakesPrecedence(t *testing.T) {
+	withPrivateAsInternal(t, false)
+	path := filepath.Join(t.TempDir(), "internal-cidrs")
+	if err := os.WriteFile(path, []byte("192.168.0.0/16\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("S3_INTERNAL_CIDRS", "10.0.0.0/8")
+	withInternalCIDRsFile(t, path)
+
+	if _isInternal(netip.MustParseAddr("10.1.2.3")) || !_isInternal(netip.MustParseAddr("192.168.1.1")) {
+		t.Error("file CIDRs should take precedence over S3_INTERNAL_CIDRS")
+	}
+
+	// A file that disappears keeps the last good set.
+	os.Remove(path)
+	ReloadInternalCIDRs()
+	if !_isInternal(netip.MustParseAddr("192.168.1.1")) {
+		t.Error("missing file should keep the current set")
+	}
+}
+
+func TestWatchInternalCIDRsFile(t *testing.T) {
+	withPrivateAsInternal(t, false)
+	path := filepath.Join(t.TempDir(), "internal-cidrs")
+	if err := os.WriteFile(path, []byte("10.0.0.0/8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	withInternalCIDRsFile(t, path)
+
+	watcher, err := watchFile(path, ReloadInternalCIDRs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+
+	if err := os.WriteFile(path, []byte("192.168.0.0/16\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !_isInternal(netip.MustParseAddr("192.168.1.1")) {
+		if time.Now().After(deadline) {
+			t.Fatal("internal set was not reloaded after the file changed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _isInternal(netip.MustParseAddr("10.1.2.3")) {
+		t.Error("old CIDRs still internal after reload")
+	}
+}
+
+func TestInternalCIDRMetrics(t *testing.T) {
+	errorsBefore := testutil.ToFloat64(stats_collect.S3CIDRParseErrors.WithLabelValues("env"))
+
+	withInternalCIDRs(t, "10.0.0.0/8,10.0.0.0/33,192.168.0.0/16,typo")
+	if got := testutil.ToFloat64(stats_collect.S3CIDRParseErrors.WithLabelValues("env")) - errorsBefore; got != 2 {
+		t.Errorf("env parse errors = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3InternalCIDRCount); got != 2 {
+		t.Errorf("internal CIDR count = %v, want 2", got)
+	}
+
+	// The count is of the loaded set: 10.0.0.0/8 minus 10.0.0.0/9 is
+	// 10.128.0.0/9, and the nested 10.1.0.0/16 adds nothing.
+	withInternalCIDRs(t, "10.0.0.0/8,10.1.0.0/16,!10.0.0.0/9")
+	if got := testutil.ToFloat64(stats_collect.S3InternalCIDRCount); got != 1 {
+		t.Errorf("internal CIDR count with exclusion = %v, want 1", got)
+	}
+
+	// An accidentally emptied config is visible as a zero gauge.
+	t.Setenv("S3_INTERNAL_CIDRS", "")
+	ReloadInternalCIDRs()
+	if got := testutil.ToFloat64(stats_collect.S3InternalCIDRCount); got != 0 {
+		t.Errorf("internal CIDR count = %v, want 0", got)
+	}
+}
@@ -0,0 +1,87 @@
+package s3api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+	"github.com/seaweedfs/seaweedfs/weed/s3api/s3_constants"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+	"github.com/seaweedfs/seaweedfs/weed/util/grace"
+)
+
+// otelEnabled wraps every S3 request in an OpenTelemetry span. Spans are
+// exported over OTLP/gRPC, configured by the standard OTEL_EXPORTER_OTLP_*
+// and OTEL_SERVICE_NAME variables. The check happens when routes are built,
+// so disabled tracing adds nothing to the request path.
+var otelEnabled = envBool("S3_OTEL_ENABLED", false)
+
+const otelScope = "github.com/seaweedfs/seaweedfs/weed/s3api"
+
+var (
+	s3Tracer = otel.Tracer(otelScope)
+	// s3Propagator links spans to upstream traces through the W3C
+	// traceparent and tracestate headers.
+	s3Propagator propagation.TextMapPropagator = propagation.TraceContext{}
+
+	startOtelTracingOnce sync.Once
+)
+
+// startOtelTracing installs the OTLP span exporter if tracing is enabled.
+func startOtelTracing() {
+	if !otelEnabled {
+		return
+	}
+	startOtelTracingOnce.Do(func() {
+		exporter, err := otlptracegrpc.New(context.Background())
+		if err != nil {
+			glog.Errorf("S3_OTEL_ENABLED: create otlp exporter: %v", err)
+			return
+		}
+		provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(s3Propagator)
+		grace.OnInterrupt(func() {
+			if err := provider.Shutdown(context.Background()); err != nil {
+				glog.Warningf("shutdown otel tracer provider: %v", err)
+			}
+		})
+	})
+}
+
+// traceRequest runs f inside a server span named by the action, continuing
+// the trace propagated by the caller, if any.
+func traceRequest(f http.HandlerFunc, action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := s3Propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := s3Tracer.Start(ctx, action, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+
+		recorder := stats_collect.NewStatusResponseWriter(w)
+		f(recorder, r.WithContext(ctx))
+
+		bucket, _ := s3_constants.GetBucketAndObject(r)
+		span.SetAttributes(
+			attribute.String("s3.bucket", bucket),
+			attribute.String("s3.client_class", clientOrigin(r)),
+			attribute.String("http.request.method", r.Method),
+			attribute.Int("http.response.status_code", recorder.Status),
+			attribute.Int64("http.response.body.size", recorder.BytesWritten),
+		)
+		if r.ContentLength >= 0 {
+			span.SetAttributes(attribute.Int64("http.request.body.size", r.ContentLength))
+		}
+		if recorder.Status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.Status))
+		}
+	}
+}
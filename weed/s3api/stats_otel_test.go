@@ -0,0 +1,103 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func withSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	previousEnabled, previousTracer := otelEnabled, s3Tracer
+	recorder := tracetest.NewSpanRecorder()
+	otelEnabled = true
+	s3Tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer(otelScope)
+	t.Cleanup(func() { otelEnabled, s3Tracer = previousEnabled, previousTracer })
+	return recorder
+}
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestTrackExportsSpan(t *testing.T) {
+	withInternalCIDRs(t, "10.0.0.0/8")
+	spans := withSpanRecorder(t)
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if got := trace.SpanContextFromContext(r.Context()).TraceID().String(); got != traceID {
+			t.Errorf("handler trace id = %s, want %s", got, traceID)
+		}
+		w.Write([]byte("hello"))
+	}
+
+	r := newStatsRequest(http.MethodGet, "stats-otel", "k", "203.0.113.5:1234")
+	r.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	track(handler, "GET")(httptest.NewRecorder(), r)
+
+	ended := spans.Ended()
+	if len(ended) != 1 {
+		t.Fatalf("got %d spans, want 1", len(ended))
+	}
+	span := ended[0]
+	if span.Name() != "GET" || span.SpanKind() != trace.SpanKindServer {
+		t.Errorf("span = %q kind %v, want GET server span", span.Name(), span.SpanKind())
+	}
+	if got := span.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("parent span id = %s, want the propagated one", got)
+	}
+	attrs := spanAttributes(span)
+	if got := attrs["s3.bucket"].AsString(); got != "stats-otel" {
+		t.Errorf("s3.bucket = %q", got)
+	}
+	if got := attrs["s3.client_class"].AsString(); got != "external" {
+		t.Errorf("s3.client_class = %q, want external", got)
+	}
+	if got := attrs["http.response.status_code"].AsInt64(); got != http.StatusOK {
+		t.Errorf("http.response.status_code = %d", got)
+	}
+	if got := attrs["http.response.body.size"].AsInt64(); got != 5 {
+		t.Errorf("http.response.body.size = %d, want 5", got)
+	}
+	if span.Status().Code != codes.Unset {
+		t.Errorf("span status = %v, want unset", span.Status())
+	}
+}
+
+func TestTrackSpanStatusReflectsServerErrors(t *testing.T) {
+	spans := withSpanRecorder(t)
+	for _, status := range []int{http.StatusNotFound, http.StatusServiceUnavailable} {
+		handler := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(status) }
+		track(handler, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, "stats-otel-status", "k", "10.0.0.1:1234"))
+	}
+
+	ended := spans.Ended()
+	if len(ended) != 2 {
+		t.Fatalf("got %d spans, want 2", len(ended))
+	}
+	if got := ended[0].Status().Code; got != codes.Unset {
+		t.Errorf("404 span status = %v, want unset", got)
+	}
+	if got := ended[1].Status().Code; got != codes.Error {
+		t.Errorf("503 span status = %v, want error", got)
+	}
+}
+
+func TestTrackWithoutOtel(t *testing.T) {
+	spans := withSpanRecorder(t)
+	otelEnabled = false
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	track(ok, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, "stats-otel-off", "k", "10.0.0.1:1234"))
+	if got := len(spans.Ended()); got != 0 {
+		t.Errorf("got %d spans with tracing disabled, want 0", got)
+	}
+}
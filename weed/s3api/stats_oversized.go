@@ -0,0 +1,14 @@
+package s3api
+
+import "net/http"
+
+// maxObjectSize is the largest Content-Length track admits, S3_MAX_OBJECT_SIZE
+// bytes. Zero or less disables the check.
+var maxObjectSize = int64(envInt("S3_MAX_OBJECT_SIZE", 0))
+
+// oversizedRequest reports whether r declares a body larger than
+// maxObjectSize. A request of unknown length, such as a chunked upload, is
+// never rejected up front.
+func oversizedRequest(r *http.Request) bool {
+	return maxObjectSize > 0 && r.ContentLength > maxObjectSize
+}
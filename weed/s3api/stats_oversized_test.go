@@ -0,0 +1,72 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// withMaxObjectSize sets maxObjectSize for the duration of the test.
+func withMaxObjectSize(t *testing.T, size int64) {
+	t.Helper()
+	old := maxObjectSize
+	maxObjectSize = size
+	t.Cleanup(func() { maxObjectSize = old })
+}
+
+func TestTrackRejectsOversizedRequests(t *testing.T) {
+	const bucket = "stats-oversized"
+	withMaxObjectSize(t, 1024)
+	tests := []struct {
+		name          string
+		contentLength int64
+		want          int
+	}{
+		{"over limit", 1025, http.StatusRequestEntityTooLarge},
+		{"at limit", 1024, http.StatusOK},
+		{"under limit", 10, http.StatusOK},
+		{"unknown length", -1, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := testutil.ToFloat64(stats_collect.S3OversizedRequestCounter.WithLabelValues(bucket))
+			called := false
+			handler := track(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.WriteHeader(http.StatusOK)
+			}, "PUT")
+			r := newStatsRequest(http.MethodPut, bucket, "k", "203.0.113.5:1234")
+			r.ContentLength = tt.contentLength
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			rejected := tt.want == http.StatusRequestEntityTooLarge
+			if called == rejected {
+				t.Errorf("handler called = %v", called)
+			}
+			want := 0.0
+			if rejected {
+				want = 1
+			}
+			if got := testutil.ToFloat64(stats_collect.S3OversizedRequestCounter.WithLabelValues(bucket)) - before; got != want {
+				t.Errorf("oversized requests = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestOversizedRequestDisabled(t *testing.T) {
+	withMaxObjectSize(t, 0)
+	r := httptest.NewRequest(http.MethodPut, "/bucket/key", nil)
+	r.ContentLength = 1 << 40
+	if oversizedRequest(r) {
+		t.Error("rejected a request with S3_MAX_OBJECT_SIZE unset")
+	}
+}
@@ -0,0 +1,16 @@
+package s3api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// isPresigned reports whether r is signed in its query string, as presigned
+// URLs are, rather than in its Authorization header.
+func isPresigned(r *http.Request) bool {
+	if !strings.Contains(r.URL.RawQuery, "X-Amz-") && !strings.Contains(r.URL.RawQuery, "AWSAccessKeyId") {
+		return false
+	}
+	query := r.URL.Query()
+	return query.Has("X-Amz-Signature") || query.Has("X-Amz-Algorithm") || isRequestPresignedSignatureV2(r)
+}
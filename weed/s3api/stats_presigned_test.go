@@ -0,0 +1,62 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func TestIsPresigned(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		authorization string
+		want          bool
+	}{
+		{"presigned v4", "X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Credential=AKID%2F20250101%2Fus-east-1%2Fs3%2Faws4_request&X-Amz-Signature=abc", "", true},
+		{"signature only", "X-Amz-Signature=abc", "", true},
+		{"presigned v2", "AWSAccessKeyId=AKID&Expires=1700000000&Signature=abc", "", true},
+		{"header signed v4", "", "AWS4-HMAC-SHA256 Credential=AKID/20250101/us-east-1/s3/aws4_request, SignedHeaders=host, Signature=abc", false},
+		{"header signed v4 with query", "prefix=X-Amz-Signature", "AWS4-HMAC-SHA256 Credential=AKID/20250101/us-east-1/s3/aws4_request, SignedHeaders=host, Signature=abc", false},
+		{"header signed v2", "", "AWS AKID:abc", false},
+		{"other amz parameter", "X-Amz-Date=20250101T000000Z", "", false},
+		{"anonymous", "", "", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/bucket/object?"+tt.query, nil)
+		if tt.authorization != "" {
+			r.Header.Set("Authorization", tt.authorization)
+		}
+		if got := isPresigned(r); got != tt.want {
+			t.Errorf("%s: isPresigned() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTrackCountsPresignedRequests(t *testing.T) {
+	const bucket = "stats-track-presigned"
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	request := func(method, query, authorization string) *http.Request {
+		r := newStatsRequest(method, bucket, "k", "203.0.113.5:1234")
+		r.URL.RawQuery = query
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		return r
+	}
+	track(ok, "GET")(httptest.NewRecorder(), request(http.MethodGet, "X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Signature=abc", ""))
+	track(ok, "GET")(httptest.NewRecorder(), request(http.MethodGet, "AWSAccessKeyId=AKID&Signature=abc", ""))
+	track(ok, "PUT")(httptest.NewRecorder(), request(http.MethodPut, "X-Amz-Signature=abc", ""))
+	track(ok, "GET")(httptest.NewRecorder(), request(http.MethodGet, "", "AWS4-HMAC-SHA256 Credential=AKID/20250101/us-east-1/s3/aws4_request, SignedHeaders=host, Signature=abc"))
+
+	if got := testutil.ToFloat64(stats_collect.S3PresignedCounter.WithLabelValues(bucket, http.MethodGet)); got != 2 {
+		t.Errorf("presigned GETs = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3PresignedCounter.WithLabelValues(bucket, http.MethodPut)); got != 1 {
+		t.Errorf("presigned PUTs = %v, want 1", got)
+	}
+}
@@ -0,0 +1,21 @@
+package s3api
+
+import "net/http"
+
+// protocolLabel returns the S3ProtocolCounter label of the HTTP version r was
+// received with. Versions other than the known few are "other", so that
+// clients cannot add labels.
+func protocolLabel(r *http.Request) string {
+	switch {
+	case r.ProtoMajor == 1 && r.ProtoMinor == 0:
+		return "HTTP/1.0"
+	case r.ProtoMajor == 1 && r.ProtoMinor == 1:
+		return "HTTP/1.1"
+	case r.ProtoMajor == 2 && r.ProtoMinor == 0:
+		return "HTTP/2.0"
+	case r.ProtoMajor == 3 && r.ProtoMinor == 0:
+		return "HTTP/3.0"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,40 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func TestTrackCountsProtocols(t *testing.T) {
+	const bucket = "stats-track-protocol"
+	tests := []struct {
+		major, minor int
+		want         string
+	}{
+		{1, 0, "HTTP/1.0"},
+		{1, 1, "HTTP/1.1"},
+		{2, 0, "HTTP/2.0"},
+		{3, 0, "HTTP/3.0"},
+		{0, 9, "other"},
+		{4, 2, "other"},
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	for _, tt := range tests {
+		r := newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234")
+		r.ProtoMajor, r.ProtoMinor = tt.major, tt.minor
+		if got := protocolLabel(r); got != tt.want {
+			t.Errorf("protocolLabel(%d.%d) = %q, want %q", tt.major, tt.minor, got, tt.want)
+		}
+		counter := stats_collect.S3ProtocolCounter.WithLabelValues(bucket, tt.want)
+		before := testutil.ToFloat64(counter)
+		track(ok, "GET")(httptest.NewRecorder(), r)
+		if got := testutil.ToFloat64(counter) - before; got != 1 {
+			t.Errorf("HTTP %d.%d counted %v times as %s, want 1", tt.major, tt.minor, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package s3api
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+	"github.com/seaweedfs/seaweedfs/weed/s3api/s3err"
+)
+
+// bucketQuotas enforces soft traffic quotas per bucket. Once a bucket has
+// sent S3_BUCKET_EGRESS_QUOTA or received S3_BUCKET_INGRESS_QUOTA bytes in
+// the current S3_BUCKET_QUOTA_PERIOD, its further requests are rejected with
+// 503 SlowDown, or with 403 AccessDenied when S3_BUCKET_QUOTA_MODE=deny,
+// until the next period starts. Periods are aligned to multiples of the
+// period since the Unix epoch, so a daily quota resets at midnight UTC. The
+// quota is soft: the request that crosses it, and those already in flight,
+// complete. It is nil when neither quota is set.
+var bucketQuotas = newQuotas(quotaConfig{
+	egress:  int64(envInt("S3_BUCKET_EGRESS_QUOTA", 0)),
+	ingress: int64(envInt("S3_BUCKET_INGRESS_QUOTA", 0)),
+	period:  envDuration("S3_BUCKET_QUOTA_PERIOD", 24*time.Hour),
+	deny:    quotaDenyFromEnv(),
+}, time.Now)
+
+// The S3QuotaExceededCounter directions.
+const (
+	quotaEgress  = "egress"
+	quotaIngress = "ingress"
+)
+
+// maxQuotaBuckets bounds the number of buckets whose usage is tracked;
+// further buckets are not subject to the quota.
+const maxQuotaBuckets = 10000
+
+type quotaConfig struct {
+	egress  int64
+	ingress int64
+	period  time.Duration
+	// deny rejects requests over quota with AccessDenied instead of
+	// SlowDown.
+	deny bool
+}
+
+func quotaDenyFromEnv() bool {
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv("S3_BUCKET_QUOTA_MODE"))); mode {
+	case "", "slowdown":
+		return false
+	case "deny":
+		return true
+	default:
+		glog.Warningf("ignoring invalid S3_BUCKET_QUOTA_MODE=%q, using slowdown", mode)
+		return false
+	}
+}
+
+// quotas holds the usage of the buckets in the current period.
+type quotas struct {
+	config quotaConfig
+	now    func() time.Time
+
+	mu          sync.Mutex
+	periodStart time.Time
+	usage       map[string]*quotaUsage
+}
+
+type quotaUsage struct {
+	sent, received int64
+}
+
+func newQuotas(config quotaConfig, now func() time.Time) *quotas {
+	if config.egress <= 0 && config.ingress <= 0 {
+		return nil
+	}
+	if config.period <= 0 {
+		glog.Warningf("ignoring invalid S3_BUCKET_QUOTA_PERIOD=%v, using 24h", config.period)
+		config.period = 24 * time.Hour
+	}
+	return &quotas{config: config, now: now, usage: make(map[string]*quotaUsage)}
+}
+
+// rotate starts a new period, forgetting all usage, when now is past the
+// current one. The caller holds q.mu.
+func (q *quotas) rotate(now time.Time) {
+	if start := q.periodOf(now); !start.Equal(q.periodStart) {
+		q.periodStart = start
+		clear(q.usage)
+	}
+}
+
+// usageOf returns the usage of bucket, or nil when it is not tracked. The
+// caller holds q.mu.
+func (q *quotas) usageOf(bucket string) *quotaUsage {
+	u, ok := q.usage[bucket]
+	if !ok && len(q.usage) < maxQuotaBuckets {
+		u = &quotaUsage{}
+		q.usage[bucket] = u
+	}
+	return u
+}
+
+// addSent records n bytes sent from bucket.
+func (q *quotas) addSent(bucket string, n int64) {
+	if q == nil || bucket == "" || q.config.egress <= 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rotate(q.now())
+	if u := q.usageOf(bucket); u != nil {
+		u.sent += n
+	}
+}
+
+// addReceived records n bytes received for bucket.
+func (q *quotas) addReceived(bucket string, n int64) {
+	if q == nil || bucket == "" || q.config.ingress <= 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rotate(q.now())
+	if u := q.usageOf(bucket); u != nil {
+		u.received += n
+	}
+}
+
+// exceeded reports whether bucket has used up a quota in the current period,
+// and which one.
+func (q *quotas) exceeded(bucket string) (direction string, ok bool) {
+	if q == nil || bucket == "" {
+		return "", false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rotate(q.now())
+	u, tracked := q.usage[bucket]
+	switch {
+	case !tracked:
+		return "", false
+	case q.config.egress > 0 && u.sent >= q.config.egress:
+		return quotaEgress, true
+	case q.config.ingress > 0 && u.received >= q.config.ingress:
+		return quotaIngress, true
+	}
+	return "", false
+}
+
+// untilReset returns how long until the quotas reset at the start of the
+// next period.
+func (q *quotas) untilReset(now time.Time) time.Duration {
+	return q.periodOf(now).Add(q.config.period).Sub(now)
+}
+
+// periodOf returns the start of the period now falls in. Unlike
+// time.Truncate, which counts from the zero time, it counts whole periods
+// since the Unix epoch.
+func (q *quotas) periodOf(now time.Time) time.Time {
+	epoch := time.Unix(0, 0)
+	return epoch.Add(now.Sub(epoch) / q.config.period * q.config.period)
+}
+
+// errorCode returns the error requests over quota are rejected with.
+func (q *quotas) errorCode() s3err.ErrorCode {
+	if q.config.deny {
+		return s3err.ErrAccessDenied
+	}
+	return s3err.ErrSlowDown
+}
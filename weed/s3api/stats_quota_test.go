@@ -0,0 +1,123 @@
+package s3api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// withBucketQuotas replaces bucketQuotas for the duration of the test.
+func withBucketQuotas(t *testing.T, q *quotas) {
+	t.Helper()
+	old := bucketQuotas
+	bucketQuotas = q
+	t.Cleanup(func() { bucketQuotas = old })
+}
+
+func TestTrackEnforcesEgressQuota(t *testing.T) {
+	const bucket = "stats-egress-quota"
+	clock := &fakeClock{t: time.Unix(1700000000, 0).Truncate(time.Hour)}
+	withBucketQuotas(t, newQuotas(quotaConfig{egress: 1000, period: time.Hour}, clock.now))
+	exceeded := stats_collect.S3QuotaExceededCounter.WithLabelValues(bucket, quotaEgress)
+	before := testutil.ToFloat64(exceeded)
+	handler := track(authDisabled(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte("x"), 600))
+	}), "GET")
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, newStatsRequest(http.MethodGet, bucket, "k", "203.0.113.5:1234"))
+		return w
+	}
+
+	// The request crossing the quota completes.
+	for i := 0; i < 2; i++ {
+		if w := get(); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i, w.Code)
+		}
+	}
+	w := get()
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("over quota: status = %d, want 503", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("over quota: no Retry-After")
+	}
+	if got := testutil.ToFloat64(exceeded) - before; got != 1 {
+		t.Errorf("quota exceeded = %v, want 1", got)
+	}
+	// Other buckets are not affected.
+	other := httptest.NewRecorder()
+	handler(other, newStatsRequest(http.MethodGet, bucket+"-other", "k", "203.0.113.5:1234"))
+	if other.Code != http.StatusOK {
+		t.Errorf("other bucket: status = %d, want 200", other.Code)
+	}
+
+	clock.advance(59 * time.Minute)
+	if w := get(); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("same period: status = %d, want 503", w.Code)
+	}
+	clock.advance(time.Minute)
+	if w := get(); w.Code != http.StatusOK {
+		t.Errorf("next period: status = %d, want 200", w.Code)
+	}
+}
+
+func TestTrackDeniesOverQuota(t *testing.T) {
+	const bucket = "stats-deny-quota"
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	q := newQuotas(quotaConfig{ingress: 100, period: time.Hour, deny: true}, clock.now)
+	withBucketQuotas(t, q)
+	q.addReceived(bucket, 100)
+
+	w := httptest.NewRecorder()
+	track(authDisabled(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler called over quota")
+	}), "PUT")(w, newStatsRequest(http.MethodPut, bucket, "k", "203.0.113.5:1234"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", w.Code)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3QuotaExceededCounter.WithLabelValues(bucket, quotaIngress)); got != 1 {
+		t.Errorf("quota exceeded = %v, want 1", got)
+	}
+}
+
+func TestQuotas(t *testing.T) {
+	if newQuotas(quotaConfig{period: time.Hour}, time.Now) != nil {
+		t.Error("quotas enabled without a quota")
+	}
+	clock := &fakeClock{t: time.Unix(1700000000, 0).Truncate(time.Hour).Add(15 * time.Minute)}
+	q := newQuotas(quotaConfig{egress: 10, period: time.Hour}, clock.now)
+	// Ingress is not limited, so it is not tracked either.
+	q.addReceived("b", 1000)
+	if _, ok := q.exceeded("b"); ok {
+		t.Error("exceeded without an ingress quota")
+	}
+	q.addSent("b", 9)
+	if _, ok := q.exceeded("b"); ok {
+		t.Error("exceeded below the quota")
+	}
+	q.addSent("b", 1)
+	if direction, ok := q.exceeded("b"); !ok || direction != quotaEgress {
+		t.Errorf("exceeded = %q, %v, want egress", direction, ok)
+	}
+	if got := q.untilReset(clock.now()); got != 45*time.Minute {
+		t.Errorf("untilReset = %v, want 45m", got)
+	}
+}
+
+func TestQuotaPeriodsAlignToUnixEpoch(t *testing.T) {
+	// 7h does not divide the time between the zero time and the Unix epoch,
+	// so periods counted from either differ.
+	const period = 7 * time.Hour
+	clock := &fakeClock{t: time.Unix(0, 0).Add(1000*period + time.Minute)}
+	q := newQuotas(quotaConfig{egress: 10, period: period}, clock.now)
+	if got := q.untilReset(clock.now()); got != period-time.Minute {
+		t.Errorf("untilReset = %v, want %v", got, period-time.Minute)
+	}
+}
@@ -0,0 +1,36 @@
+package s3api
+
+import (
+	"net/http"
+
+	"github.com/seaweedfs/seaweedfs/weed/s3api/s3_constants"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// isRangeRequest reports whether r asks for part of an object only.
+func isRangeRequest(r *http.Request) bool {
+	return r.Header.Get("Range") != ""
+}
+
+// trackObjectRead counts a successful GetObject, whose S3 action is s3Action,
+// as a full or ranged read, and observes the bytes sent in the object size
+// histogram.
+func trackObjectRead(s3Action string, r *http.Request, status int, bucket string, bytesSent int64) {
+	if r.Method != http.MethodGet || status/100 != 2 {
+		return
+	}
+	switch s3Action {
+	case s3_constants.S3_ACTION_GET_OBJECT, s3_constants.S3_ACTION_GET_OBJECT_VERSION:
+	default:
+		return
+	}
+	kind := "full"
+	if isRangeRequest(r) {
+		kind = "range"
+		stats_collect.S3RangeRequestCounter.WithLabelValues(bucket).Inc()
+	}
+	stats_collect.S3ObjectReadCounter.WithLabelValues(bucket, kind).Inc()
+	if bytesSent > 0 {
+		stats_collect.S3ObjectSizeHistogram.WithLabelValues(bucket, "read").Observe(float64(bytesSent))
+	}
+}
@@ -0,0 +1,60 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func TestIsRangeRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/b/k", nil)
+	if isRangeRequest(r) {
+		t.Error("request without Range header is a range request")
+	}
+	r.Header.Set("Range", "bytes=0-1023")
+	if !isRangeRequest(r) {
+		t.Error("request with Range header is not a range request")
+	}
+}
+
+func TestTrackCountsRangeReads(t *testing.T) {
+	const bucket = "stats-track-range"
+	respond := func(status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(status) }
+	}
+	full := stats_collect.S3ObjectReadCounter.WithLabelValues(bucket, "full")
+	ranged := stats_collect.S3ObjectReadCounter.WithLabelValues(bucket, "range")
+	rangeRequests := stats_collect.S3RangeRequestCounter.WithLabelValues(bucket)
+	fullBefore, rangedBefore, rangeRequestsBefore := testutil.ToFloat64(full), testutil.ToFloat64(ranged), testutil.ToFloat64(rangeRequests)
+
+	get := func(rangeHeader string, status int) {
+		r := newStatsRequest(http.MethodGet, bucket, "video.mp4", "10.0.0.1:1234")
+		if rangeHeader != "" {
+			r.Header.Set("Range", rangeHeader)
+		}
+		track(respond(status), "GET")(httptest.NewRecorder(), r)
+	}
+	get("", http.StatusOK)
+	get("bytes=0-1023", http.StatusPartialContent)
+	get("bytes=1024-", http.StatusPartialContent)
+	// Failed reads and non-object GETs are not counted.
+	get("bytes=0-1", http.StatusRequestedRangeNotSatisfiable)
+	get("", http.StatusNotFound)
+	list := newStatsRequest(http.MethodGet, bucket, "", "10.0.0.1:1234")
+	list.Header.Set("Range", "bytes=0-1")
+	track(respond(http.StatusOK), "LIST")(httptest.NewRecorder(), list)
+
+	if got := testutil.ToFloat64(full) - fullBefore; got != 1 {
+		t.Errorf("full reads = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(ranged) - rangedBefore; got != 2 {
+		t.Errorf("range reads = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(rangeRequests) - rangeRequestsBefore; got != 2 {
+		t.Errorf("range requests = %v, want 2", got)
+	}
+}
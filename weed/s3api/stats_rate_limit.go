@@ -0,0 +1,201 @@
+package s3api
+
+import (
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+)
+
+// bucketRateLimits caps the request rate of individual buckets. It is read
+// from S3_BUCKET_RATE_LIMITS, e.g. "bucketA=100,bucketB=500" requests per
+// second; buckets that are not listed are unlimited.
+var bucketRateLimits = parseBucketRateLimits(os.Getenv("S3_BUCKET_RATE_LIMITS"))
+
+// clientRateLimits caps the request rate of each external client network, as
+// aggregated for the per-client egress metrics, to S3_CLIENT_RATE_LIMIT
+// requests per second. It is nil, and clients are unlimited, when unset.
+var clientRateLimits = newClientRateLimiter(envInt("S3_CLIENT_RATE_LIMIT", 0))
+
+// rateLimitMinRetryAfter is the least Retry-After sent with rate limited
+// responses, for operators who want clients to back off longer than it takes
+// the token bucket to refill.
+var rateLimitMinRetryAfter = envDuration("S3_RATE_LIMIT_MIN_RETRY_AFTER", 0)
+
+const (
+	clientLimiterIdleTimeout   = 10 * time.Minute
+	clientLimiterSweepInterval = time.Minute
+)
+
+func init() {
+	if clientRateLimits != nil {
+		go clientRateLimits.sweepEvery(clientLimiterSweepInterval, clientLimiterIdleTimeout)
+	}
+}
+
+// bucketRateLimiter holds one token bucket per limited bucket. The map is
+// built once and never modified, and rate.Limiter is safe for concurrent use.
+type bucketRateLimiter struct {
+	limiters map[string]*rate.Limiter
+}
+
+// parseBucketRateLimits parses a comma separated list of bucket=rate pairs.
+// Each bucket may burst up to one second worth of requests.
+func parseBucketRateLimits(s string) *bucketRateLimiter {
+	l := &bucketRateLimiter{limiters: make(map[string]*rate.Limiter)}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		bucket, value, found := strings.Cut(entry, "=")
+		bucket = strings.TrimSpace(bucket)
+		limit, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if !found || bucket == "" || err != nil || limit <= 0 {
+			glog.Warningf("S3_BUCKET_RATE_LIMITS: skipping invalid entry %q", entry)
+			continue
+		}
+		burst := int(limit)
+		if burst < 1 {
+			burst = 1
+		}
+		l.limiters[bucket] = rate.NewLimiter(rate.Limit(limit), burst)
+	}
+	return l
+}
+
+// allow reports whether a request to bucket at now is within its rate limit.
+func (l *bucketRateLimiter) allow(bucket string, now time.Time) bool {
+	limiter, ok := l.limiters[bucket]
+	if !ok {
+		return true
+	}
+	return limiter.AllowN(now, 1)
+}
+
+// retryAfter returns how long after now the token bucket of bucket has a
+// token for another request.
+func (l *bucketRateLimiter) retryAfter(bucket string, now time.Time) time.Duration {
+	limiter, ok := l.limiters[bucket]
+	if !ok {
+		return 0
+	}
+	return refillTime(limiter, now)
+}
+
+// clientRateLimiter holds a token bucket per client network prefix. Buckets
+// are created on demand and evicted by sweep once idle to bound memory.
+type clientRateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu      sync.Mutex
+	clients map[netip.Prefix]*clientLimiter
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newClientRateLimiter(perSecond int) *clientRateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &clientRateLimiter{
+		limit:   rate.Limit(perSecond),
+		burst:   perSecond,
+		clients: make(map[netip.Prefix]*clientLimiter),
+	}
+}
+
+// rejected reports whether r exceeds the rate limit of its client network and
+// returns that network. Internal clients are never limited.
+func (l *clientRateLimiter) rejected(r *http.Request, now time.Time) (netip.Prefix, bool) {
+	if l == nil {
+		return netip.Prefix{}, false
+	}
+	client, internal := requestClientIP(r)
+	if internal {
+		return netip.Prefix{}, false
+	}
+	prefix, ok := clientNetwork(client)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+	return prefix, !l.allow(prefix, now)
+}
+
+// allow reports whether a request from prefix at now is within the limit.
+func (l *clientRateLimiter) allow(prefix netip.Prefix, now time.Time) bool {
+	l.mu.Lock()
+	c, ok := l.clients[prefix]
+	if !ok {
+		c = &clientLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[prefix] = c
+	}
+	c.lastSeen = now
+	l.mu.Unlock()
+	return c.limiter.AllowN(now, 1)
+}
+
+// retryAfter returns how long after now the token bucket of prefix has a
+// token for another request.
+func (l *clientRateLimiter) retryAfter(prefix netip.Prefix, now time.Time) time.Duration {
+	l.mu.Lock()
+	c, ok := l.clients[prefix]
+	l.mu.Unlock()
+	if !ok {
+		return 0
+	}
+	return refillTime(c.limiter, now)
+}
+
+// sweep evicts the token buckets of clients not seen for longer than idle.
+func (l *clientRateLimiter) sweep(now time.Time, idle time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for prefix, c := range l.clients {
+		if now.Sub(c.lastSeen) > idle {
+			delete(l.clients, prefix)
+		}
+	}
+}
+
+func (l *clientRateLimiter) sweepEvery(interval, idle time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		l.sweep(now, idle)
+	}
+}
+
+// refillTime returns how long after now limiter has a whole token again.
+func refillTime(limiter *rate.Limiter, now time.Time) time.Duration {
+	missing := 1 - limiter.TokensAt(now)
+	if missing <= 0 || limiter.Limit() <= 0 {
+		return 0
+	}
+	return time.Duration(missing / float64(limiter.Limit()) * float64(time.Second))
+}
+
+// setRetryAfter sets the Retry-After header of a rate limited response to d,
+// but at least rateLimitMinRetryAfter, in whole seconds rounded up. It is
+// never less than one second, the smallest delay the header can express.
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	if d < rateLimitMinRetryAfter {
+		d = rateLimitMinRetryAfter
+	}
+	seconds := int64((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+}
@@ -0,0 +1,276 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func TestParseBucketRateLimits(t *testing.T) {
+	l := parseBucketRateLimits(" a=100, b = 2.5 ,bogus, c=-1, =5, d=x")
+	if len(l.limiters) != 2 {
+		t.Fatalf("limited buckets = %d, want 2", len(l.limiters))
+	}
+	if got := l.limiters["a"].Limit(); got != 100 {
+		t.Errorf("a limit = %v, want 100", got)
+	}
+	if got := l.limiters["b"].Burst(); got != 2 {
+		t.Errorf("b burst = %v, want 2", got)
+	}
+}
+
+func TestBucketRateLimiterBurst(t *testing.T) {
+	l := parseBucketRateLimits("limited=10")
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		if !l.allow("limited", now) {
+			t.Fatalf("request %d within the burst was rejected", i)
+		}
+	}
+	if l.allow("limited", now) {
+		t.Error("request beyond the burst was allowed")
+	}
+}
+
+func TestBucketRateLimiterSteadyState(t *testing.T) {
+	l := parseBucketRateLimits("limited=10")
+	now := time.Now()
+	for l.allow("limited", now) {
+	}
+	// Ten requests per second refill one token every 100ms.
+	allowed := 0
+	for i := 1; i <= 20; i++ {
+		if l.allow("limited", now.Add(time.Duration(i)*50*time.Millisecond)) {
+			allowed++
+		}
+	}
+	if allowed != 10 {
+		t.Errorf("allowed %d requests in one second at 10/s, want 10", allowed)
+	}
+}
+
+func TestBucketRateLimiterUnlimited(t *testing.T) {
+	l := parseBucketRateLimits("limited=1")
+	now := time.Now()
+	for i := 0; i < 1000; i++ {
+		if !l.allow("other", now) || !l.allow("", now) {
+			t.Fatal("unconfigured bucket was rate limited")
+		}
+	}
+}
+
+func TestTrackRejectsRateLimitedBuckets(t *testing.T) {
+	const bucket = "stats-rate-limited"
+	old := bucketRateLimits
+	bucketRateLimits = parseBucketRateLimits(bucket + "=5")
+	t.Cleanup(func() { bucketRateLimits = old })
+	rejectedBefore := testutil.ToFloat64(stats_collect.S3RateLimitedCounter.WithLabelValues(bucket))
+	unavailable := stats_collect.S3RequestCounter.WithLabelValues("GET", "503", bucket, noAccessKey)
+	serverErrors := stats_collect.S3StatusClassCounter.WithLabelValues(bucket, "5")
+	unavailableBefore, serverErrorsBefore := testutil.ToFloat64(unavailable), testutil.ToFloat64(serverErrors)
+
+	var handled atomic.Int64
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		handled.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}
+	var wg sync.WaitGroup
+	var slowDown atomic.Int64
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			track(authDisabled(ok), "GET")(w, newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+			if w.Code == http.StatusServiceUnavailable && strings.Contains(w.Body.String(), "<Code>SlowDown</Code>") {
+				slowDown.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The burst of five usually covers everything admitted during the test,
+	// but a slow machine may refill a token or two.
+	if got := handled.Load(); got < 5 || got+slowDown.Load() != 20 {
+		t.Errorf("handled %d and rejected %d of 20 requests", got, slowDown.Load())
+	}
+	if got := testutil.ToFloat64(stats_collect.S3RateLimitedCounter.WithLabelValues(bucket)) - rejectedBefore; got != float64(slowDown.Load()) {
+		t.Errorf("rate limited counter = %v, want %d", got, slowDown.Load())
+	}
+	// Rejections are requests too.
+	if got := testutil.ToFloat64(unavailable) - unavailableBefore; got != float64(slowDown.Load()) {
+		t.Errorf(`requests{code="503"} = %v, want %d`, got, slowDown.Load())
+	}
+	if got := testutil.ToFloat64(serverErrors) - serverErrorsBefore; got != float64(slowDown.Load()) {
+		t.Errorf("5xx status class = %v, want %d", got, slowDown.Load())
+	}
+}
+
+func TestClientRateLimiterThrottlesExternalClients(t *testing.T) {
+	withInternalCIDRs(t, "10.0.0.0/8")
+	withPrivateAsInternal(t, true)
+	old := clientRateLimits
+	clientRateLimits = newClientRateLimiter(2)
+	t.Cleanup(func() { clientRateLimits = old })
+
+	now := time.Now()
+	rejected := func(remoteAddr string) bool {
+		_, rejected := clientRateLimits.rejected(newStatsRequest(http.MethodGet, "b", "k", remoteAddr), now)
+		return rejected
+	}
+	// Both addresses share a /24 and therefore one bucket of two requests.
+	if rejected("198.51.100.1:1234") || rejected("198.51.100.2:1234") {
+		t.Fatal("requests within the burst were rejected")
+	}
+	if !rejected("198.51.100.3:1234") {
+		t.Error("third request from the same /24 was allowed")
+	}
+	if rejected("203.0.113.1:1234") {
+		t.Error("request from another network was rejected")
+	}
+	for i := 0; i < 10; i++ {
+		if rejected("10.1.2.3:1234") {
+			t.Fatal("internal client was rate limited")
+		}
+	}
+}
+
+func TestClientRateLimiterKeysAreNotAnonymized(t *testing.T) {
+	withInternalCIDRs(t, "")
+	withAnonymizeClientIP(t, true)
+	oldLimits, oldBits := clientRateLimits, clientEgressPrefixBitsV4
+	clientRateLimits, clientEgressPrefixBitsV4 = newClientRateLimiter(1), 32
+	t.Cleanup(func() { clientRateLimits, clientEgressPrefixBitsV4 = oldLimits, oldBits })
+
+	now := time.Now()
+	limit := func(remoteAddr string) (netip.Prefix, bool) {
+		return clientRateLimits.rejected(newStatsRequest(http.MethodGet, "b", "k", remoteAddr), now)
+	}
+	if _, rejected := limit("192.0.2.7:1234"); rejected {
+		t.Fatal("first request was rejected")
+	}
+	// Anonymized, both addresses would share 192.0.2.0/32 and one token.
+	if _, rejected := limit("192.0.2.8:1234"); rejected {
+		t.Error("request from another /32 was rejected")
+	}
+	prefix, rejected := limit("192.0.2.8:1234")
+	if !rejected {
+		t.Fatal("second request from the same /32 was allowed")
+	}
+	if got := clientNetworkLabel(prefix); got != "192.0.2.0/32" {
+		t.Errorf("label = %q, want the anonymized 192.0.2.0/32", got)
+	}
+}
+
+func TestTrackRejectsRateLimitedClients(t *testing.T) {
+	withInternalCIDRs(t, "")
+	old := clientRateLimits
+	clientRateLimits = newClientRateLimiter(1)
+	t.Cleanup(func() { clientRateLimits = old })
+	const prefix = "192.0.2.0/24"
+	before := testutil.ToFloat64(stats_collect.S3ClientRateLimitedCounter.WithLabelValues(prefix))
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	codes := make([]int, 3)
+	var retryAfter string
+	for i := range codes {
+		w := httptest.NewRecorder()
+		track(ok, "GET")(w, newStatsRequest(http.MethodGet, "stats-client-rate", "k", "192.0.2.7:1234"))
+		codes[i] = w.Code
+		retryAfter = w.Header().Get("Retry-After")
+	}
+	if codes[0] != http.StatusOK {
+		t.Errorf("first request = %d, want 200", codes[0])
+	}
+	if codes[2] != http.StatusServiceUnavailable {
+		t.Errorf("third request = %d, want 503", codes[2])
+	}
+	if got := retryAfter; got != "1" {
+		t.Errorf("Retry-After = %q, want 1 second at one request per second", got)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3ClientRateLimitedCounter.WithLabelValues(prefix)) - before; got < 1 {
+		t.Errorf("client rate limited counter = %v, want at least 1", got)
+	}
+}
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	now := time.Now()
+	buckets := parseBucketRateLimits("slow=0.2")
+	if !buckets.allow("slow", now) || buckets.allow("slow", now) {
+		t.Fatal("expected a burst of one request")
+	}
+	// One token every five seconds.
+	if got := buckets.retryAfter("slow", now); got < 4900*time.Millisecond || got > 5*time.Second {
+		t.Errorf("retry after = %v, want about 5s", got)
+	}
+	if got := buckets.retryAfter("slow", now.Add(2*time.Second)); got < 2900*time.Millisecond || got > 3*time.Second {
+		t.Errorf("retry after 2s = %v, want about 3s", got)
+	}
+	if got := buckets.retryAfter("unlimited", now); got != 0 {
+		t.Errorf("retry after for an unlimited bucket = %v, want 0", got)
+	}
+
+	clients := newClientRateLimiter(4)
+	prefix := netip.MustParsePrefix("198.51.100.0/24")
+	for clients.allow(prefix, now) {
+	}
+	if got := clients.retryAfter(prefix, now); got <= 0 || got > 250*time.Millisecond {
+		t.Errorf("client retry after = %v, want at most 250ms", got)
+	}
+}
+
+func TestTrackSetsRetryAfter(t *testing.T) {
+	const bucket = "stats-retry-after"
+	old, oldMin := bucketRateLimits, rateLimitMinRetryAfter
+	t.Cleanup(func() { bucketRateLimits, rateLimitMinRetryAfter = old, oldMin })
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	throttled := func() *httptest.ResponseRecorder {
+		bucketRateLimits = parseBucketRateLimits(bucket + "=0.5")
+		track(authDisabled(ok), "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+		w := httptest.NewRecorder()
+		track(authDisabled(ok), "GET")(w, newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+		if w.Code != http.StatusServiceUnavailable {
+			t.Fatalf("status = %d, want 503", w.Code)
+		}
+		return w
+	}
+
+	// Half a request per second refills in two seconds.
+	if got := throttled().Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want 2", got)
+	}
+	rateLimitMinRetryAfter = 30 * time.Second
+	if got := throttled().Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q with a 30s minimum, want 30", got)
+	}
+}
+
+func TestClientRateLimiterSweep(t *testing.T) {
+	l := newClientRateLimiter(1)
+	now := time.Now()
+	idle, active := netip.MustParsePrefix("198.51.100.0/24"), netip.MustParsePrefix("203.0.113.0/24")
+	l.allow(idle, now)
+	l.allow(active, now.Add(9*time.Minute))
+
+	l.sweep(now.Add(10*time.Minute+time.Second), 10*time.Minute)
+	if _, ok := l.clients[idle]; ok {
+		t.Error("idle client was not evicted")
+	}
+	if _, ok := l.clients[active]; !ok {
+		t.Error("active client was evicted")
+	}
+
+	// An evicted client starts over with a full bucket.
+	if !l.allow(idle, now.Add(11*time.Minute)) {
+		t.Error("evicted client was rejected on its next request")
+	}
+}
@@ -0,0 +1,37 @@
+package s3api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// sdkRequestHeader is sent by the AWS SDKs on every attempt of a request,
+// e.g. "attempt=2; max=3".
+const sdkRequestHeader = "Amz-Sdk-Request"
+
+// retryAttemptLabel returns the S3RetryAttemptCounter attempt label of r:
+// "1", "2", or "3+" for later attempts. It is empty when r carries no valid
+// attempt, as for clients other than the AWS SDKs.
+func retryAttemptLabel(r *http.Request) string {
+	header := r.Header.Get(sdkRequestHeader)
+	if header == "" {
+		return ""
+	}
+	for _, pair := range strings.Split(header, ";") {
+		key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || !strings.EqualFold(strings.TrimSpace(key), "attempt") {
+			continue
+		}
+		attempt, err := strconv.Atoi(strings.TrimSpace(value))
+		switch {
+		case err != nil || attempt < 1:
+			return ""
+		case attempt >= 3:
+			return "3+"
+		default:
+			return strconv.Itoa(attempt)
+		}
+	}
+	return ""
+}
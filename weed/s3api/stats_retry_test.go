@@ -0,0 +1,62 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func TestRetryAttemptLabel(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"attempt=1; max=3", "1"},
+		{"attempt=2; max=3", "2"},
+		{"max=5; attempt=3", "3+"},
+		{"attempt=7; max=10", "3+"},
+		{"Attempt = 2", "2"},
+		{"attempt=0; max=3", ""},
+		{"attempt=many", ""},
+		{"ttl=20240101T000000Z; max=3", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/bucket/key", nil)
+		if tt.header != "" {
+			r.Header.Set("amz-sdk-request", tt.header)
+		}
+		if got := retryAttemptLabel(r); got != tt.want {
+			t.Errorf("retryAttemptLabel(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestTrackCountsRetryAttempts(t *testing.T) {
+	const bucket = "stats-retry"
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	get := func(header string) {
+		r := newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234")
+		if header != "" {
+			r.Header.Set("amz-sdk-request", header)
+		}
+		track(ok, "GET")(httptest.NewRecorder(), r)
+	}
+
+	get("")
+	get("attempt=1; max=3")
+	get("attempt=1; max=3")
+	get("attempt=2; max=3")
+	get("attempt=3; max=3")
+	get("attempt=4; max=5")
+
+	for attempt, want := range map[string]float64{"1": 2, "2": 1, "3+": 2} {
+		if got := testutil.ToFloat64(stats_collect.S3RetryAttemptCounter.WithLabelValues(bucket, attempt)); got != want {
+			t.Errorf("attempt %s requests = %v, want %v", attempt, got, want)
+		}
+	}
+}
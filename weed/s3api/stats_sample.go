@@ -0,0 +1,34 @@
+package s3api
+
+import (
+	"math/rand/v2"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+)
+
+// histogramSampleRate is the fraction of requests whose latency is observed
+// in S3RequestHistogram and S3RequestHistogramByOrigin, read from
+// S3_HISTOGRAM_SAMPLE_RATE. Sampling scales the histograms' _count and _sum
+// by the rate, so divide them by it to estimate request totals; quantiles
+// are unaffected. The request counters are always exact.
+var histogramSampleRate = parseSampleRate("S3_HISTOGRAM_SAMPLE_RATE", envFloat("S3_HISTOGRAM_SAMPLE_RATE", 1))
+
+func parseSampleRate(name string, rate float64) float64 {
+	if !(rate >= 0 && rate <= 1) {
+		glog.Warningf("ignoring out of range %s=%v", name, rate)
+		return 1
+	}
+	return rate
+}
+
+// sampleHistogram reports whether the latency of the current request should
+// be observed. The top-level math/rand/v2 generator is lock free.
+func sampleHistogram() bool {
+	switch histogramSampleRate {
+	case 1:
+		return true
+	case 0:
+		return false
+	}
+	return rand.Float64() < histogramSampleRate
+}
@@ -0,0 +1,37 @@
+package s3api
+
+import (
+	"math"
+	"sync/atomic"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// maxConcurrent is the number of concurrent requests the gateway is sized
+// for, S3_MAX_CONCURRENT. S3SaturationGauge is the share of it in use, and
+// NaN when it is not configured.
+var maxConcurrent = envInt("S3_MAX_CONCURRENT", 0)
+
+// inFlightTotal is the number of requests in track, of every action.
+var inFlightTotal atomic.Int64
+
+func init() {
+	stats_collect.SetS3SaturationFunc(saturation)
+}
+
+// enterSaturation counts a request entering track and returns the function
+// to call when it leaves.
+func enterSaturation() (leave func()) {
+	inFlightTotal.Add(1)
+	return func() { inFlightTotal.Add(-1) }
+}
+
+// saturation is the value of S3SaturationGauge, computed from inFlightTotal
+// when it is scraped. It exceeds 1 when more requests are in flight than the
+// gateway is sized for.
+func saturation() float64 {
+	if maxConcurrent <= 0 {
+		return math.NaN()
+	}
+	return float64(inFlightTotal.Load()) / float64(maxConcurrent)
+}
@@ -0,0 +1,78 @@
+package s3api
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// withMaxConcurrent sets maxConcurrent for the duration of the test.
+func withMaxConcurrent(t *testing.T, limit int) {
+	t.Helper()
+	old := maxConcurrent
+	maxConcurrent = limit
+	t.Cleanup(func() { maxConcurrent = old })
+}
+
+func TestSaturationScalesWithInFlight(t *testing.T) {
+	withMaxConcurrent(t, 4)
+	base := inFlightTotal.Load()
+	saturation := func() float64 { return testutil.ToFloat64(stats_collect.S3SaturationGauge) }
+
+	var leaves []func()
+	for i := 1; i <= 4; i++ {
+		leaves = append(leaves, enterSaturation())
+		if got, want := saturation(), float64(base+int64(i))/4; got != want {
+			t.Errorf("saturation with %d in flight = %v, want %v", i, got, want)
+		}
+	}
+	for _, leave := range leaves {
+		leave()
+	}
+	if got, want := saturation(), float64(base)/4; got != want {
+		t.Errorf("saturation after the requests left = %v, want %v", got, want)
+	}
+
+	// A request in track counts while its handler runs.
+	var during float64
+	handler := func(w http.ResponseWriter, r *http.Request) { during = saturation() }
+	track(handler, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, "stats-saturation", "k", "10.0.0.1:1234"))
+	if want := float64(base+1) / 4; during != want {
+		t.Errorf("saturation in the handler = %v, want %v", during, want)
+	}
+}
+
+func TestSaturationWithoutLimit(t *testing.T) {
+	withMaxConcurrent(t, 0)
+	leave := enterSaturation()
+	defer leave()
+	if got := testutil.ToFloat64(stats_collect.S3SaturationGauge); !math.IsNaN(got) {
+		t.Errorf("saturation without a limit = %v, want NaN", got)
+	}
+}
+
+func TestSaturationAfterConcurrentRequests(t *testing.T) {
+	withMaxConcurrent(t, 4)
+	base := inFlightTotal.Load()
+	var wg sync.WaitGroup
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			leave := enterSaturation()
+			leave()
+		}()
+	}
+	wg.Wait()
+	// Interleaved updates can never leave a stale value behind, as the gauge
+	// is computed when it is read.
+	if got, want := testutil.ToFloat64(stats_collect.S3SaturationGauge), float64(base)/4; got != want {
+		t.Errorf("saturation after concurrent requests = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,21 @@
+package s3api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// isSigV2 reports whether r is signed with the deprecated signature version
+// 2, in its Authorization header or, presigned, in its query string. It
+// only looks at the form of the request, whether or not the signature is
+// valid.
+func isSigV2(r *http.Request) bool {
+	if strings.HasPrefix(r.Header.Get("Authorization"), signV2Algorithm+" ") {
+		return true
+	}
+	if !strings.Contains(r.URL.RawQuery, "Signature=") && !strings.Contains(r.URL.RawQuery, "AWSAccessKeyId=") {
+		return false
+	}
+	query := r.URL.Query()
+	return query.Has("Signature") || query.Has("AWSAccessKeyId")
+}
@@ -0,0 +1,56 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func TestIsSigV2(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		authorization string
+		want          bool
+	}{
+		{"header signed v2", "", "AWS AKID:abc", true},
+		{"presigned v2", "AWSAccessKeyId=AKID&Expires=1700000000&Signature=abc", "", true},
+		{"v2 signature only", "Signature=abc", "", true},
+		{"header signed v4", "", "AWS4-HMAC-SHA256 Credential=AKID/20250101/us-east-1/s3/aws4_request, SignedHeaders=host, Signature=abc", false},
+		{"presigned v4", "X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Credential=AKID%2F20250101%2Fus-east-1%2Fs3%2Faws4_request&X-Amz-Signature=abc", "", false},
+		{"signature in a parameter value", "prefix=Signature=x", "", false},
+		{"anonymous", "", "", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/bucket/object?"+tt.query, nil)
+		if tt.authorization != "" {
+			r.Header.Set("Authorization", tt.authorization)
+		}
+		if got := isSigV2(r); got != tt.want {
+			t.Errorf("%s: isSigV2() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTrackCountsSigV2Requests(t *testing.T) {
+	const bucket = "stats-track-sigv2"
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	for _, authorization := range []string{
+		"AWS AKID:abc",
+		"AWS4-HMAC-SHA256 Credential=AKID/20250101/us-east-1/s3/aws4_request, SignedHeaders=host, Signature=abc",
+		"",
+	} {
+		r := newStatsRequest(http.MethodGet, bucket, "k", "203.0.113.5:1234")
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		track(ok, "GET")(httptest.NewRecorder(), r)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3SigV2Counter.WithLabelValues(bucket)); got != 1 {
+		t.Errorf("sigv2 requests = %v, want 1", got)
+	}
+}
@@ -0,0 +1,159 @@
+package s3api
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+	"github.com/seaweedfs/seaweedfs/weed/security"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+const statsStatusPath = "/status/s3/stats"
+
+var registerStatusHandlersOnce sync.Once
+
+// statusAdminSigningKey signs the JWTs that authorize the status endpoints
+// changing gateway state, such as billingResetPath. They are disabled while
+// S3_STATUS_ADMIN_JWT_KEY is unset.
+var statusAdminSigningKey = security.SigningKey(os.Getenv("S3_STATUS_ADMIN_JWT_KEY"))
+
+// registerStatusHandlers exposes the S3 status endpoints on the default mux.
+// It is served by the metrics and debug listeners only, never by the S3 API
+// listener, which routes through its own mux.
+func registerStatusHandlers() {
+	registerStatusHandlersOnce.Do(func() {
+		http.HandleFunc(statsStatusPath, statsStatusHandler)
+		http.HandleFunc(classifyIPPath, classifyIPHandler)
+		http.HandleFunc(billingStatusPath, billingStatusHandler)
+		http.HandleFunc(billingResetPath, requireStatusAdmin(billingResetHandler))
+		http.HandleFunc(topBucketsPath, topBucketsHandler)
+	})
+}
+
+// requireStatusAdmin only runs f for requests carrying a JWT signed with
+// statusAdminSigningKey, in the jwt query parameter or an Authorization
+// bearer header. The default mux is reachable by anyone who can scrape the
+// metrics, so endpoints that change state must not rely on the listener.
+func requireStatusAdmin(f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(statusAdminSigningKey) == 0 {
+			http.Error(w, "set S3_STATUS_ADMIN_JWT_KEY to enable this endpoint", http.StatusForbidden)
+			return
+		}
+		tokenStr := security.GetJwt(r)
+		if tokenStr == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		token, err := security.DecodeJwt(statusAdminSigningKey, tokenStr, &jwt.RegisteredClaims{})
+		if err != nil || !token.Valid {
+			glog.V(1).Infof("status admin jwt from %s rejected: %v", r.RemoteAddr, err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f(w, r)
+	}
+}
+
+// bucketStatsSnapshot is the current value of the per-bucket counters.
+type bucketStatsSnapshot struct {
+	Requests              uint64 `json:"requests"`
+	Reads                 uint64 `json:"reads"`
+	Writes                uint64 `json:"writes"`
+	BytesReceived         uint64 `json:"bytes_received"`
+	BytesSent             uint64 `json:"bytes_sent"`
+	ExternalBytesReceived uint64 `json:"external_bytes_received"`
+	ExternalBytesSent     uint64 `json:"external_bytes_sent"`
+}
+
+type statsSnapshot struct {
+	Buckets map[string]*bucketStatsSnapshot `json:"buckets"`
+}
+
+// counter returns the field holding the s3 counter with the given name, or
+// nil when the counter is not part of the snapshot.
+func (s *bucketStatsSnapshot) counter(name string) *uint64 {
+	switch name {
+	case "request_total":
+		return &s.Requests
+	case "read_requests_total":
+		return &s.Reads
+	case "write_requests_total":
+		return &s.Writes
+	case "bucket_traffic_received_bytes_total":
+		return &s.BytesReceived
+	case "bucket_traffic_sent_bytes_total":
+		return &s.BytesSent
+	case "bucket_traffic_external_received_bytes_total":
+		return &s.ExternalBytesReceived
+	case "bucket_traffic_external_sent_bytes_total":
+		return &s.ExternalBytesSent
+	}
+	return nil
+}
+
+// snapshotBucketStats collects the per-bucket counters from the metrics
+// registry, summing over their other labels.
+func snapshotBucketStats(gatherer prometheus.Gatherer) (*statsSnapshot, error) {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+	prefix := stats_collect.Namespace + "_s3_"
+	snapshot := &statsSnapshot{Buckets: make(map[string]*bucketStatsSnapshot)}
+	var probe bucketStatsSnapshot
+	for _, family := range families {
+		name, ok := strings.CutPrefix(family.GetName(), prefix)
+		if !ok || probe.counter(name) == nil {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			bucket := labelValue(metric, "bucket")
+			if bucket == "" {
+				continue
+			}
+			stats, ok := snapshot.Buckets[bucket]
+			if !ok {
+				stats = &bucketStatsSnapshot{}
+				snapshot.Buckets[bucket] = stats
+			}
+			*stats.counter(name) += uint64(metric.GetCounter().GetValue())
+		}
+	}
+	return snapshot, nil
+}
+
+func labelValue(metric *dto.Metric, name string) string {
+	for _, label := range metric.GetLabel() {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
+
+// statsStatusHandler serves the per-bucket counters as JSON.
+func statsStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	snapshot, err := snapshotBucketStats(stats_collect.Gather)
+	if err != nil {
+		glog.Errorf("snapshot s3 stats: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		glog.V(1).Infof("write s3 stats: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package s3api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/seaweedfs/seaweedfs/weed/security"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func TestStatsStatusHandler(t *testing.T) {
+	withInternalCIDRs(t, "10.0.0.0/8")
+	const bucket = "stats-status"
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	track(ok, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	track(ok, "PUT")(httptest.NewRecorder(), newStatsRequest(http.MethodPut, bucket, "k", "10.0.0.1:1234"))
+	track(ok, "PUT")(httptest.NewRecorder(), newStatsRequest(http.MethodPut, bucket, "k", "10.0.0.1:1234"))
+	BucketTrafficReceived(300, newStatsRequest(http.MethodPut, bucket, "k", "10.0.0.1:1234"))
+	BucketTrafficSent(100, newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	BucketTrafficSent(40, newStatsRequest(http.MethodGet, bucket, "k", "203.0.113.5:1234"))
+
+	w := httptest.NewRecorder()
+	statsStatusHandler(w, httptest.NewRequest(http.MethodGet, statsStatusPath, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	var body struct {
+		Buckets map[string]map[string]uint64 `json:"buckets"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s: %v", w.Body.String(), err)
+	}
+	want := map[string]uint64{
+		"requests":                3,
+		"reads":                   1,
+		"writes":                  2,
+		"bytes_received":          300,
+		"bytes_sent":              140,
+		"external_bytes_received": 0,
+		"external_bytes_sent":     40,
+	}
+	got := body.Buckets[bucket]
+	if len(got) != len(want) {
+		t.Errorf("bucket fields = %v, want %v", got, want)
+	}
+	for field, value := range want {
+		if v, ok := got[field]; !ok || v != value {
+			t.Errorf("%s = %v (present %v), want %v", field, v, ok, value)
+		}
+	}
+}
+
+func TestStatsStatusHandlerRejectsPost(t *testing.T) {
+	w := httptest.NewRecorder()
+	statsStatusHandler(w, httptest.NewRequest(http.MethodPost, statsStatusPath, nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want 405", w.Code)
+	}
+}
+
+func TestRequireStatusAdmin(t *testing.T) {
+	withBillingSnapshot(t, stats_collect.NewBillingSnapshot())
+	old := statusAdminSigningKey
+	t.Cleanup(func() { statusAdminSigningKey = old })
+	reset := requireStatusAdmin(billingResetHandler)
+	post := func(token security.EncodedJwt) int {
+		r := httptest.NewRequest(http.MethodPost, billingResetPath, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+string(token))
+		}
+		w := httptest.NewRecorder()
+		reset(w, r)
+		return w.Code
+	}
+
+	statusAdminSigningKey = nil
+	if got := post(security.GenJwtForFilerServer(security.SigningKey("secret"), 60)); got != http.StatusForbidden {
+		t.Errorf("status without a configured key = %d, want 403", got)
+	}
+
+	statusAdminSigningKey = security.SigningKey("secret")
+	tests := []struct {
+		name  string
+		token security.EncodedJwt
+		want  int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"garbage token", "not-a-jwt", http.StatusUnauthorized},
+		{"wrong key", security.GenJwtForFilerServer(security.SigningKey("other"), 60), http.StatusUnauthorized},
+		{"valid token", security.GenJwtForFilerServer(security.SigningKey("secret"), 60), http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		if got := post(tt.token); got != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
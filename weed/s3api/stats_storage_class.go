@@ -0,0 +1,28 @@
+package s3api
+
+import (
+	"net/http"
+
+	"github.com/seaweedfs/seaweedfs/weed/s3api/s3_constants"
+)
+
+const (
+	// defaultStorageClass is the storage class of writes without an
+	// x-amz-storage-class header.
+	defaultStorageClass = "STANDARD"
+	// otherStorageClass replaces storage classes S3 does not define, so that
+	// clients cannot add labels.
+	otherStorageClass = "OTHER"
+)
+
+// storageClassLabel returns the S3WriteCounter storage class label of r.
+func storageClassLabel(r *http.Request) string {
+	sc := r.Header.Get(s3_constants.AmzStorageClass)
+	if sc == "" {
+		return defaultStorageClass
+	}
+	if !validateStorageClass(sc) {
+		return otherStorageClass
+	}
+	return sc
+}
@@ -0,0 +1,50 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/seaweedfs/seaweedfs/weed/s3api/s3_constants"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func TestTrackLabelsWritesByStorageClass(t *testing.T) {
+	const bucket = "stats-storage-class"
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	put := func(storageClass string) {
+		r := newStatsRequest(http.MethodPut, bucket, "k", "10.0.0.1:1234")
+		if storageClass != "" {
+			r.Header.Set(s3_constants.AmzStorageClass, storageClass)
+		}
+		track(ok, "PUT")(httptest.NewRecorder(), r)
+	}
+
+	put("")
+	put("REDUCED_REDUNDANCY")
+	put("GLACIER")
+	put("GLACIER")
+	put("bogus-class")
+	put("standard")
+
+	for storageClass, want := range map[string]float64{
+		defaultStorageClass:  1,
+		"REDUCED_REDUNDANCY": 1,
+		"GLACIER":            2,
+		otherStorageClass:    2,
+	} {
+		if got := testutil.ToFloat64(stats_collect.S3WriteCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier, storageClass)); got != want {
+			t.Errorf("%s writes = %v, want %v", storageClass, got, want)
+		}
+	}
+
+	// Reads don't specify a storage class and are not labeled with one.
+	r := newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234")
+	r.Header.Set(s3_constants.AmzStorageClass, "GLACIER")
+	track(ok, "GET")(httptest.NewRecorder(), r)
+	if got := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier)); got != 1 {
+		t.Errorf("reads = %v, want 1", got)
+	}
+}
@@ -0,0 +1,929 @@
+package s3api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/seaweedfs/seaweedfs/weed/s3api/s3err"
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// newStatsRequest builds a request routed to bucket/object as mux would,
+// arriving from remoteAddr.
+func newStatsRequest(method, bucket, object, remoteAddr string) *http.Request {
+	r := httptest.NewRequest(method, "/"+bucket+"/"+object, nil)
+	r.RemoteAddr = remoteAddr
+	return mux.SetURLVars(r, map[string]string{"bucket": bucket, "object": object})
+}
+
+func TestBucketTrafficSentExternal(t *testing.T) {
+	withInternalCIDRs(t, "10.0.0.0/8")
+	const bucket = "stats-sent-external"
+
+	BucketTrafficSent(100, newStatsRequest(http.MethodGet, bucket, "a", "10.1.2.3:1234"))
+	BucketTrafficSent(40, newStatsRequest(http.MethodGet, bucket, "a", "203.0.113.5:1234"))
+
+	if got := testutil.ToFloat64(stats_collect.S3BucketTrafficSentBytesCounter.WithLabelValues(bucket, noAccount)); got != 140 {
+		t.Errorf("sent bytes = %v, want 140", got)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3BucketExternalSentBytesCounter.WithLabelValues(bucket)); got != 40 {
+		t.Errorf("external sent bytes = %v, want 40", got)
+	}
+}
+
+func TestBucketTrafficSentByNetwork(t *testing.T) {
+	withInternalCIDRs(t, "10.0.0.0/8")
+	withSemiInternalCIDRs(t, "198.51.100.0/24")
+	const bucket = "stats-sent-network"
+
+	BucketTrafficSent(100, newStatsRequest(http.MethodGet, bucket, "a", "10.1.2.3:1234"))
+	BucketTrafficSent(20, newStatsRequest(http.MethodGet, bucket, "a", "198.51.100.7:1234"))
+	BucketTrafficSent(3, newStatsRequest(http.MethodGet, bucket, "a", "203.0.113.5:1234"))
+
+	for _, tt := range []struct {
+		name    string
+		counter *prometheus.CounterVec
+		want    float64
+	}{
+		{"internal", stats_collect.S3BucketInternalSentBytesCounter, 100},
+		{"semi-internal", stats_collect.S3BucketSemiInternalSentBytesCounter, 20},
+		{"external", stats_collect.S3BucketExternalSentBytesCounter, 3},
+		{"total", stats_collect.S3BucketTrafficSentBytesCounter.MustCurryWith(prometheus.Labels{"account": noAccount}), 123},
+	} {
+		if got := testutil.ToFloat64(tt.counter.WithLabelValues(bucket)); got != tt.want {
+			t.Errorf("%s sent bytes = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBucketTrafficReceivedExternal(t *testing.T) {
+	withInternalCIDRs(t, "10.0.0.0/8")
+	const bucket = "stats-received-external"
+
+	BucketTrafficReceived(100, newStatsRequest(http.MethodPut, bucket, "a", "10.1.2.3:1234"))
+	BucketTrafficReceived(40, newStatsRequest(http.MethodPut, bucket, "a", "203.0.113.5:1234"))
+
+	if got := testutil.ToFloat64(stats_collect.S3BucketTrafficReceivedBytesCounter.WithLabelValues(bucket, noAccount)); got != 140 {
+		t.Errorf("received bytes = %v, want 140", got)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3BucketExternalReceivedBytesCounter.WithLabelValues(bucket)); got != 40 {
+		t.Errorf("external received bytes = %v, want 40", got)
+	}
+}
+
+func TestTrackBillsReadsAndWrites(t *testing.T) {
+	const bucket = "stats-track-rw"
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	readsBefore := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier))
+	writesBefore := testutil.ToFloat64(stats_collect.S3WriteCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier, defaultStorageClass))
+
+	track(ok, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	track(ok, "PUT")(httptest.NewRecorder(), newStatsRequest(http.MethodPut, bucket, "k", "10.0.0.1:1234"))
+	track(ok, "PUT")(httptest.NewRecorder(), newStatsRequest(http.MethodPut, bucket, "k", "10.0.0.1:1234"))
+
+	if got := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier)) - readsBefore; got != 1 {
+		t.Errorf("reads = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3WriteCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier, defaultStorageClass)) - writesBefore; got != 2 {
+		t.Errorf("writes = %v, want 2", got)
+	}
+}
+
+func TestTrackBillsListObjectsV2AsList(t *testing.T) {
+	const bucket = "stats-track-list"
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	listsBefore := testutil.ToFloat64(stats_collect.S3ListCounter.WithLabelValues(bucket))
+	writesBefore := testutil.ToFloat64(stats_collect.S3WriteCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier, defaultStorageClass))
+	readsBefore := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier))
+
+	r := newStatsRequest(http.MethodGet, bucket, "", "10.0.0.1:1234")
+	r.URL.RawQuery = "list-type=2"
+	track(ok, "LIST")(httptest.NewRecorder(), r)
+
+	if got := testutil.ToFloat64(stats_collect.S3ListCounter.WithLabelValues(bucket)) - listsBefore; got != 1 {
+		t.Errorf("lists = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3WriteCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier, defaultStorageClass)) - writesBefore; got != 0 {
+		t.Errorf("writes = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier)) - readsBefore; got != 0 {
+		t.Errorf("reads = %v, want 0", got)
+	}
+}
+
+func TestTrackBillsConditionalWriteAsRead(t *testing.T) {
+	const bucket = "stats-track-conditional"
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	old := billConditionalWriteAsRead
+	t.Cleanup(func() { billConditionalWriteAsRead = old })
+
+	for _, enabled := range []bool{true, false} {
+		billConditionalWriteAsRead = enabled
+		readsBefore := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier))
+		writesBefore := testutil.ToFloat64(stats_collect.S3WriteCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier, defaultStorageClass))
+
+		r := newStatsRequest(http.MethodPut, bucket, "k", "10.0.0.1:1234")
+		r.Header.Set("If-None-Match", "*")
+		track(ok, "PUT")(httptest.NewRecorder(), r)
+		track(ok, "PUT")(httptest.NewRecorder(), newStatsRequest(http.MethodPut, bucket, "k", "10.0.0.1:1234"))
+
+		wantReads := 0.0
+		if enabled {
+			wantReads = 1
+		}
+		if got := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier)) - readsBefore; got != wantReads {
+			t.Errorf("enabled=%v: reads = %v, want %v", enabled, got, wantReads)
+		}
+		if got := testutil.ToFloat64(stats_collect.S3WriteCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier, defaultStorageClass)) - writesBefore; got != 2 {
+			t.Errorf("enabled=%v: writes = %v, want 2", enabled, got)
+		}
+	}
+}
+
+func TestTrackBillsHeadSeparately(t *testing.T) {
+	const bucket = "stats-track-head"
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	headsBefore := testutil.ToFloat64(stats_collect.S3HeadCounter.WithLabelValues(bucket))
+	readsBefore := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier))
+	listsBefore := testutil.ToFloat64(stats_collect.S3ListCounter.WithLabelValues(bucket))
+
+	// HeadObject, HeadBucket, then a GetObject which stays a read.
+	track(ok, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodHead, bucket, "k", "10.0.0.1:1234"))
+	track(ok, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodHead, bucket, "", "10.0.0.1:1234"))
+	track(ok, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+
+	if got := testutil.ToFloat64(stats_collect.S3HeadCounter.WithLabelValues(bucket)) - headsBefore; got != 2 {
+		t.Errorf("heads = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier)) - readsBefore; got != 1 {
+		t.Errorf("reads = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3ListCounter.WithLabelValues(bucket)) - listsBefore; got != 0 {
+		t.Errorf("lists = %v, want 0", got)
+	}
+}
+
+func TestTrackCountsMetadataOperations(t *testing.T) {
+	const bucket = "stats-track-metadata"
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	send := func(method, object, query string) {
+		r := newStatsRequest(method, bucket, object, "10.0.0.1:1234")
+		r.URL.RawQuery = query
+		track(ok, method)(httptest.NewRecorder(), r)
+	}
+
+	send(http.MethodGet, "", "location")
+	send(http.MethodGet, "", "versioning")
+	send(http.MethodPut, "", "acl")
+	send(http.MethodPut, "k", "acl")
+	send(http.MethodDelete, "", "cors")
+	// Object data stays on read and write.
+	send(http.MethodGet, "k", "")
+	send(http.MethodPut, "k", "")
+
+	for _, tt := range []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"metadata gets", testutil.ToFloat64(stats_collect.S3MetadataOpCounter.WithLabelValues(bucket, http.MethodGet)), 2},
+		{"metadata puts", testutil.ToFloat64(stats_collect.S3MetadataOpCounter.WithLabelValues(bucket, http.MethodPut)), 2},
+		{"metadata deletes", testutil.ToFloat64(stats_collect.S3MetadataOpCounter.WithLabelValues(bucket, http.MethodDelete)), 1},
+		{"reads", testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier)), 1},
+		{"writes", testutil.ToFloat64(stats_collect.S3WriteCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier, defaultStorageClass)), 1},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestTrackCountsUpgradeRequests(t *testing.T) {
+	const bucket = "stats-track-upgrade"
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	r := newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234")
+	r.Header.Set("Connection", "keep-alive, Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	track(ok, "GET")(httptest.NewRecorder(), r)
+	r = newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234")
+	r.Header.Set("Connection", "upgrade")
+	track(ok, "GET")(httptest.NewRecorder(), r)
+	// keep-alive alone is no upgrade.
+	r = newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234")
+	r.Header.Set("Connection", "keep-alive")
+	track(ok, "GET")(httptest.NewRecorder(), r)
+
+	for _, tt := range []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"upgrades", testutil.ToFloat64(stats_collect.S3UpgradeRequestCounter.WithLabelValues(bucket)), 2},
+		{"others", testutil.ToFloat64(stats_collect.S3OtherCounter.WithLabelValues(bucket)), 0},
+		{"reads", testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier)), 1},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestTrackCountsCorsPreflight(t *testing.T) {
+	const bucket = "stats-track-preflight"
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	r := newStatsRequest(http.MethodOptions, bucket, "k", "10.0.0.1:1234")
+	r.Header.Set("Origin", "https://example.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	track(ok, "OPTIONS")(httptest.NewRecorder(), r)
+	track(ok, "OPTIONS")(httptest.NewRecorder(), newStatsRequest(http.MethodOptions, bucket, "", "10.0.0.1:1234"))
+
+	for _, tt := range []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"preflights", testutil.ToFloat64(stats_collect.S3CorsPreflightCounter.WithLabelValues(bucket)), 2},
+		{"others", testutil.ToFloat64(stats_collect.S3OtherCounter.WithLabelValues(bucket)), 0},
+		{"reads", testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier)), 0},
+		{"writes", testutil.ToFloat64(stats_collect.S3WriteCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier, defaultStorageClass)), 0},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestTrackLabelsAccessKey(t *testing.T) {
+	const bucket = "stats-track-access-key"
+	old := metricsIncludeAccessKey
+	metricsIncludeAccessKey = true
+	t.Cleanup(func() { metricsIncludeAccessKey = old })
+
+	iam := &IdentityAccessManagement{}
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	authenticated := func(w http.ResponseWriter, r *http.Request) {
+		iam.handleAuthResult(w, r, &Identity{
+			Name:        "tenant",
+			Credentials: []*Credential{{AccessKey: "AKIDOTHER"}, {AccessKey: "AKIDSTATS"}},
+		}, s3err.ErrNone, ok)
+	}
+	signed := func(accessKey string) *http.Request {
+		r := newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234")
+		r.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/20260101/us-east-1/s3/aws4_request, SignedHeaders=host, Signature=00")
+		return r
+	}
+	readsBefore := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, "AKIDSTATS", defaultBillingTier))
+	forgedBefore := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, "AKIDFORGED", defaultBillingTier))
+	anonymousBefore := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, anonymousAccessKey, defaultBillingTier))
+	disabledBefore := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier))
+
+	r := signed("AKIDSTATS")
+	track(authenticated, "GET")(httptest.NewRecorder(), r)
+	// Unauthenticated requests and keys the identity does not own are
+	// labeled anonymous, whatever key their signature names.
+	track(ok, "GET")(httptest.NewRecorder(), signed("AKIDFORGED"))
+	track(authenticated, "GET")(httptest.NewRecorder(), signed("AKIDFORGED"))
+
+	if got := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, "AKIDSTATS", defaultBillingTier)) - readsBefore; got != 1 {
+		t.Errorf("authenticated reads = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, "AKIDFORGED", defaultBillingTier)) - forgedBefore; got != 0 {
+		t.Errorf("reads labeled with a forged key = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, anonymousAccessKey, defaultBillingTier)) - anonymousBefore; got != 2 {
+		t.Errorf("anonymous reads = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3RequestCounter.WithLabelValues("GET", "200", bucket, "AKIDSTATS")); got != 1 {
+		t.Errorf("authenticated requests = %v, want 1", got)
+	}
+
+	metricsIncludeAccessKey = false
+	track(authenticated, "GET")(httptest.NewRecorder(), r)
+	if got := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier)) - disabledBefore; got != 1 {
+		t.Errorf("reads with label disabled = %v, want 1", got)
+	}
+}
+
+// observedHistogram returns the sample count and sum of a histogram series.
+func observedHistogram(t *testing.T, observer prometheus.Observer) (uint64, float64) {
+	t.Helper()
+	var m dto.Metric
+	if err := observer.(prometheus.Metric).Write(&m); err != nil {
+		t.Fatalf("read histogram: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
+
+func TestUploadCompletionTime(t *testing.T) {
+	const bucket = "stats-upload-completion"
+	durations := stats_collect.S3UploadCompletionHistogram.WithLabelValues(http.MethodPut, bucket)
+	throughput := stats_collect.S3UploadThroughputHistogram.WithLabelValues(http.MethodPut, bucket)
+	upload := newStatsRequest(http.MethodPut, bucket, "k", "10.0.0.1:1234")
+
+	start := time.Now().Add(-2 * time.Second)
+	UploadCompletionTime(http.MethodPut, start, 8<<20, upload)
+	if count, sum := observedHistogram(t, durations); count != 1 || sum < 2 {
+		t.Errorf("upload durations = %d observations summing to %v, want 1 of at least 2s", count, sum)
+	}
+	count, sum := observedHistogram(t, throughput)
+	if count != 1 || sum <= 0 || sum > 4<<20 {
+		t.Errorf("upload throughput = %d observations summing to %v, want 1 of at most 4MiB/s", count, sum)
+	}
+
+	// An empty upload is timed, but has no throughput.
+	UploadCompletionTime(http.MethodPut, time.Now(), 0, upload)
+	if count, _ := observedHistogram(t, durations); count != 2 {
+		t.Errorf("upload durations = %d observations, want 2", count)
+	}
+	if count, _ := observedHistogram(t, throughput); count != 1 {
+		t.Errorf("upload throughput = %d observations, want 1", count)
+	}
+}
+
+func TestTimeToFirstByteMissingStart(t *testing.T) {
+	const bucket = "stats-ttfb-missing-start"
+	ttfb := stats_collect.S3TimeToFirstByteHistogram.WithLabelValues(http.MethodGet, bucket)
+	missing := stats_collect.S3TTFBMissingStartCounter.WithLabelValues(http.MethodGet)
+	before := testutil.ToFloat64(missing)
+	r := newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234")
+
+	TimeToFirstByte(http.MethodGet, time.Time{}, r)
+	if count, _ := observedHistogram(t, ttfb); count != 0 {
+		t.Errorf("time to first byte = %d observations, want none for a zero start", count)
+	}
+	if got := testutil.ToFloat64(missing) - before; got != 1 {
+		t.Errorf("missing start = %v, want 1", got)
+	}
+
+	TimeToFirstByte(http.MethodGet, time.Now(), r)
+	if count, _ := observedHistogram(t, ttfb); count != 1 {
+		t.Errorf("time to first byte = %d observations, want 1", count)
+	}
+}
+
+func TestObjectSizeHistogram(t *testing.T) {
+	const bucket = "stats-object-size"
+	writes := stats_collect.S3ObjectSizeHistogram.WithLabelValues(bucket, "write")
+	reads := stats_collect.S3ObjectSizeHistogram.WithLabelValues(bucket, "read")
+
+	upload := newStatsRequest(http.MethodPut, bucket, "k", "10.0.0.1:1234")
+	ObjectUploaded(4096, upload)
+	ObjectUploaded(3000, upload)
+	// Request bodies are traffic, but not object sizes.
+	BucketTrafficReceived(512, upload)
+
+	serve := func(w http.ResponseWriter, r *http.Request) { w.Write(make([]byte, 2048)) }
+	track(serve, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	// Response bodies other than object reads are not object sizes.
+	track(serve, "LIST")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "", "10.0.0.1:1234"))
+
+	if count, sum := observedHistogram(t, writes); count != 2 || sum != 4096+3000 {
+		t.Errorf("write sizes: count=%d sum=%v, want count=2 sum=%v", count, sum, 4096+3000)
+	}
+	if count, sum := observedHistogram(t, reads); count != 1 || sum != 2048 {
+		t.Errorf("read sizes: count=%d sum=%v, want count=1 sum=2048", count, sum)
+	}
+}
+
+func TestTrackCountsS3ErrorCodes(t *testing.T) {
+	const bucket = "stats-track-error-code"
+	fail := func(code s3err.ErrorCode) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) { s3err.WriteErrorResponse(w, r, code) }
+	}
+	counter := func(bucket, code string) float64 {
+		return testutil.ToFloat64(stats_collect.S3ErrorCodeCounter.WithLabelValues("GET", bucket, code))
+	}
+	deniedBefore := counter("", "AccessDenied")
+	signatureBefore := counter("", "SignatureDoesNotMatch")
+	missingBefore := counter(bucket, "NoSuchKey")
+
+	track(fail(s3err.ErrAccessDenied), "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	track(fail(s3err.ErrSignatureDoesNotMatch), "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	track(fail(s3err.ErrNoSuchKey), "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	track(fail(s3err.ErrNoSuchKey), "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+
+	// Forbidden requests are not attributed to a bucket, like the other metrics.
+	if got := counter("", "AccessDenied") - deniedBefore; got != 1 {
+		t.Errorf("AccessDenied = %v, want 1", got)
+	}
+	if got := counter("", "SignatureDoesNotMatch") - signatureBefore; got != 1 {
+		t.Errorf("SignatureDoesNotMatch = %v, want 1", got)
+	}
+	if got := counter(bucket, "NoSuchKey") - missingBefore; got != 2 {
+		t.Errorf("NoSuchKey = %v, want 2", got)
+	}
+}
+
+func TestTrackInFlightByClass(t *testing.T) {
+	const bucket = "stats-track-in-flight"
+	const reads, writes = 5, 3
+	gauge := func(class rwClass) float64 {
+		return testutil.ToFloat64(stats_collect.S3InFlightByClass.WithLabelValues(class.String()))
+	}
+	readsBefore, writesBefore := gauge(rwRead), gauge(rwWrite)
+
+	var entered, done sync.WaitGroup
+	release := make(chan struct{})
+	blocking := func(w http.ResponseWriter, r *http.Request) {
+		entered.Done()
+		<-release
+	}
+	start := func(method string, n int) {
+		for i := 0; i < n; i++ {
+			entered.Add(1)
+			done.Add(1)
+			go func() {
+				defer done.Done()
+				track(blocking, method)(httptest.NewRecorder(), newStatsRequest(method, bucket, "k", "10.0.0.1:1234"))
+			}()
+		}
+	}
+	start(http.MethodGet, reads)
+	start(http.MethodPut, writes)
+	entered.Wait()
+
+	if got := gauge(rwRead) - readsBefore; got != reads {
+		t.Errorf("in-flight reads = %v, want %d", got, reads)
+	}
+	if got := gauge(rwWrite) - writesBefore; got != writes {
+		t.Errorf("in-flight writes = %v, want %d", got, writes)
+	}
+
+	close(release)
+	done.Wait()
+	if got := gauge(rwRead) - readsBefore; got != 0 {
+		t.Errorf("in-flight reads after completion = %v, want 0", got)
+	}
+	if got := gauge(rwWrite) - writesBefore; got != 0 {
+		t.Errorf("in-flight writes after completion = %v, want 0", got)
+	}
+}
+
+func TestTrackCountsUntrustedForwardedHeaders(t *testing.T) {
+	const bucket = "stats-track-untrusted-xff"
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	counter := func() float64 {
+		return testutil.ToFloat64(stats_collect.S3UntrustedForwardedHeaderCounter.WithLabelValues(bucket))
+	}
+
+	tests := []struct {
+		name       string
+		hops       int
+		remoteAddr string
+		header     string
+		value      string
+		untrusted  bool
+	}{
+		{"trusted proxy", 1, "10.0.0.1:1234", "X-Forwarded-For", "198.51.100.17", false},
+		{"untrusted xff", 1, "203.0.113.5:1234", "X-Forwarded-For", "198.51.100.17", true},
+		{"untrusted forwarded", 1, "203.0.113.5:1234", "Forwarded", "for=198.51.100.17", true},
+		{"no header", 1, "203.0.113.5:1234", "", "", false},
+		{"no trusted hops", 0, "10.0.0.1:1234", "X-Forwarded-For", "198.51.100.17", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withTrustedProxies(t, tt.hops, "10.0.0.0/8")
+			r := newStatsRequest(http.MethodGet, bucket, "k", tt.remoteAddr)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+			before := counter()
+			track(ok, "GET")(httptest.NewRecorder(), r)
+
+			want := 0.0
+			if tt.untrusted {
+				want = 1
+			}
+			if got := counter() - before; got != want {
+				t.Errorf("untrusted forwarded headers = %v, want %v", got, want)
+			}
+			if tt.untrusted && getClientIP(r) != remoteAddr(r) {
+				t.Errorf("client IP = %v, want the direct peer", getClientIP(r))
+			}
+		})
+	}
+}
+
+func TestTrackRequestHistogramByOrigin(t *testing.T) {
+	withInternalCIDRs(t, "10.0.0.0/8")
+	const bucket = "stats-latency-origin"
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	internal := stats_collect.S3RequestHistogramByOrigin.WithLabelValues("GET", bucket, "internal")
+	external := stats_collect.S3RequestHistogramByOrigin.WithLabelValues("GET", bucket, "external")
+
+	track(ok, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	track(ok, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "203.0.113.5:1234"))
+	track(ok, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "203.0.113.6:1234"))
+
+	if got, _ := observedHistogram(t, internal); got != 1 {
+		t.Errorf("internal observations = %d, want 1", got)
+	}
+	if got, _ := observedHistogram(t, external); got != 2 {
+		t.Errorf("external observations = %d, want 2", got)
+	}
+	if got, _ := observedHistogram(t, stats_collect.S3RequestHistogram.WithLabelValues("GET", bucket)); got != 3 {
+		t.Errorf("request histogram observations = %d, want 3", got)
+	}
+}
+
+func TestTrackCountsRequestsByOrigin(t *testing.T) {
+	withPrivateAsInternal(t, false)
+	withInternalCIDRs(t, "10.0.0.0/8")
+	withSemiInternalCIDRs(t, "198.51.100.0/24")
+	const bucket = "stats-requests-origin"
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	track(ok, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	track(ok, "PUT")(httptest.NewRecorder(), newStatsRequest(http.MethodPut, bucket, "k", "10.0.0.2:1234"))
+	track(ok, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "203.0.113.5:1234"))
+	// Semi-internal clients are not internal.
+	track(ok, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "198.51.100.7:1234"))
+
+	if got := testutil.ToFloat64(stats_collect.S3InternalRequestCounter.WithLabelValues(bucket)); got != 2 {
+		t.Errorf("internal requests = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3ExternalRequestCounter.WithLabelValues(bucket)); got != 2 {
+		t.Errorf("external requests = %v, want 2", got)
+	}
+}
+
+func TestTrackStatusClass(t *testing.T) {
+	const bucket = "stats-status-class"
+	tests := []struct {
+		status int
+		class  string
+	}{
+		{http.StatusOK, "2"},
+		{http.StatusNoContent, "2"},
+		{http.StatusNotModified, "3"},
+		{http.StatusNotFound, "4"},
+		{http.StatusPreconditionFailed, "4"},
+		{http.StatusServiceUnavailable, "5"},
+	}
+	for _, tt := range tests {
+		if got := statusClass(tt.status); got != tt.class {
+			t.Errorf("statusClass(%d) = %q, want %q", tt.status, got, tt.class)
+		}
+		before := testutil.ToFloat64(stats_collect.S3StatusClassCounter.WithLabelValues(bucket, tt.class))
+		handler := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(tt.status) }
+		track(handler, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+		if got := testutil.ToFloat64(stats_collect.S3StatusClassCounter.WithLabelValues(bucket, tt.class)) - before; got != 1 {
+			t.Errorf("status %d counted %v times in class %s, want 1", tt.status, got, tt.class)
+		}
+	}
+}
+
+func TestTrackOperationErrors(t *testing.T) {
+	const bucket = "stats-operation-errors"
+	total := stats_collect.S3OperationTotal.WithLabelValues("GET", bucket)
+	errors := stats_collect.S3OperationErrors.WithLabelValues("GET", bucket)
+	for _, status := range []int{http.StatusOK, http.StatusNotModified, http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError} {
+		handler := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(status) }
+		track(handler, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	}
+	if got := testutil.ToFloat64(total); got != 5 {
+		t.Errorf("operations = %v, want 5", got)
+	}
+	if got := testutil.ToFloat64(errors); got != 3 {
+		t.Errorf("operation errors = %v, want 3", got)
+	}
+}
+
+func TestTrackForbiddenBucket(t *testing.T) {
+	const bucket = "stats-track-forbidden"
+	deny := func(w http.ResponseWriter, r *http.Request) { s3err.WriteErrorResponse(w, r, s3err.ErrAccessDenied) }
+	requests := func(bucket string) float64 {
+		return testutil.ToFloat64(stats_collect.S3RequestCounter.WithLabelValues("GET", "403", bucket, noAccessKey))
+	}
+
+	for _, blank := range []bool{true, false} {
+		previous := blankBucketOnForbidden
+		blankBucketOnForbidden = blank
+		want := bucket
+		if blank {
+			want = ""
+		}
+		before := requests(want)
+		track(deny, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+		got := requests(want) - before
+		blankBucketOnForbidden = previous
+
+		if got != 1 {
+			t.Errorf("blank=%v: %v requests recorded for bucket %q, want 1", blank, got, want)
+		}
+	}
+}
+
+func TestTrackDoesNotBillAuthFailures(t *testing.T) {
+	const bucket = "stats-track-auth-failure"
+	withBlank := blankBucketOnForbidden
+	blankBucketOnForbidden = false
+	t.Cleanup(func() { blankBucketOnForbidden = withBlank })
+	fail := func(code s3err.ErrorCode) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) { s3err.WriteErrorResponse(w, r, code) }
+	}
+	readsBefore := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier))
+	writesBefore := testutil.ToFloat64(stats_collect.S3WriteCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier, defaultStorageClass))
+
+	track(fail(s3err.ErrAccessDenied), "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	track(fail(s3err.ErrAccessDenied), "PUT")(httptest.NewRecorder(), newStatsRequest(http.MethodPut, bucket, "k", "10.0.0.1:1234"))
+	track(fail(s3err.ErrSignatureDoesNotMatch), "PUT")(httptest.NewRecorder(), newStatsRequest(http.MethodPut, bucket, "k", "10.0.0.1:1234"))
+	// Other client errors are still billed.
+	track(fail(s3err.ErrNoSuchKey), "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+
+	if got := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier)) - readsBefore; got != 1 {
+		t.Errorf("reads = %v, want only the 404 billed", got)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3WriteCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier, defaultStorageClass)) - writesBefore; got != 0 {
+		t.Errorf("writes = %v, want denied writes not billed", got)
+	}
+}
+
+func TestTrackHistogramSampleRate(t *testing.T) {
+	const bucket = "stats-histogram-sample"
+	previous := histogramSampleRate
+	t.Cleanup(func() { histogramSampleRate = previous })
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	histogram := stats_collect.S3RequestHistogram.WithLabelValues("GET", bucket)
+	requests := stats_collect.S3RequestCounter.WithLabelValues("GET", "200", bucket, noAccessKey)
+
+	for _, tt := range []struct {
+		rate float64
+		want uint64
+	}{{0, 0}, {1, 10}} {
+		histogramSampleRate = tt.rate
+		observedBefore, _ := observedHistogram(t, histogram)
+		requestsBefore := testutil.ToFloat64(requests)
+		for i := 0; i < 10; i++ {
+			track(ok, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+		}
+		observed, _ := observedHistogram(t, histogram)
+		if observed-observedBefore != tt.want {
+			t.Errorf("rate %v: %d observations, want %d", tt.rate, observed-observedBefore, tt.want)
+		}
+		if got := testutil.ToFloat64(requests) - requestsBefore; got != 10 {
+			t.Errorf("rate %v: %v requests counted, want all 10", tt.rate, got)
+		}
+	}
+}
+
+func TestParseSampleRate(t *testing.T) {
+	for rate, want := range map[float64]float64{0: 0, 0.25: 0.25, 1: 1, -0.5: 1, 2: 1} {
+		if got := parseSampleRate("S3_HISTOGRAM_SAMPLE_RATE", rate); got != want {
+			t.Errorf("parseSampleRate(%v) = %v, want %v", rate, got, want)
+		}
+	}
+}
+
+func TestBucketTrafficSentCacheStatus(t *testing.T) {
+	const bucket = "stats-sent-cache"
+	hits := stats_collect.S3CacheHitBytesCounter.WithLabelValues(bucket)
+	misses := stats_collect.S3CacheMissBytesCounter.WithLabelValues(bucket)
+
+	BucketTrafficSentWithCacheStatus(100, newStatsRequest(http.MethodGet, bucket, "small", "10.0.0.1:1234"), true)
+	BucketTrafficSentWithCacheStatus(30, newStatsRequest(http.MethodGet, bucket, "large", "10.0.0.1:1234"), false)
+	// Without a cache status the bytes are a miss.
+	BucketTrafficSent(12, newStatsRequest(http.MethodGet, bucket, "large", "10.0.0.1:1234"))
+
+	if got := testutil.ToFloat64(hits); got != 100 {
+		t.Errorf("cache hit bytes = %v, want 100", got)
+	}
+	if got := testutil.ToFloat64(misses); got != 42 {
+		t.Errorf("cache miss bytes = %v, want 42", got)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3BucketTrafficSentBytesCounter.WithLabelValues(bucket, noAccount)); got != 142 {
+		t.Errorf("sent bytes = %v, want 142", got)
+	}
+}
+
+func TestTrackCountsResponseBytes(t *testing.T) {
+	withInternalCIDRs(t, "10.0.0.0/8")
+	const bucket = "stats-track-response-bytes"
+	sent := stats_collect.S3BucketTrafficSentBytesCounter.WithLabelValues(bucket, noAccount)
+	external := stats_collect.S3BucketExternalSentBytesCounter.WithLabelValues(bucket)
+	hits := stats_collect.S3CacheHitBytesCounter.WithLabelValues(bucket)
+	misses := stats_collect.S3CacheMissBytesCounter.WithLabelValues(bucket)
+
+	write := func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 100))
+		w.Write(make([]byte, 23))
+	}
+	copyBody := func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, strings.NewReader(strings.Repeat("x", 1000)))
+	}
+	inline := func(w http.ResponseWriter, r *http.Request) {
+		markCacheHit(w)
+		w.Write(make([]byte, 7))
+	}
+	track(write, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	track(copyBody, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "203.0.113.5:1234"))
+	track(inline, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	track(func(w http.ResponseWriter, r *http.Request) {}, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+
+	if got := testutil.ToFloat64(sent); got != 1130 {
+		t.Errorf("sent bytes = %v, want 1130", got)
+	}
+	if got := testutil.ToFloat64(external); got != 1000 {
+		t.Errorf("external sent bytes = %v, want 1000", got)
+	}
+	if got := testutil.ToFloat64(hits); got != 7 {
+		t.Errorf("cache hit bytes = %v, want 7", got)
+	}
+	if got := testutil.ToFloat64(misses); got != 1123 {
+		t.Errorf("cache miss bytes = %v, want 1123", got)
+	}
+}
+
+func TestTrackListResponseHasNoCacheStatus(t *testing.T) {
+	const bucket = "stats-track-list-bytes"
+	sent := stats_collect.S3BucketTrafficSentBytesCounter.WithLabelValues(bucket, noAccount)
+	hits := stats_collect.S3CacheHitBytesCounter.WithLabelValues(bucket)
+	misses := stats_collect.S3CacheMissBytesCounter.WithLabelValues(bucket)
+
+	list := func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 250))
+	}
+	r := newStatsRequest(http.MethodGet, bucket, "", "10.0.0.1:1234")
+	r.URL.RawQuery = "list-type=2"
+	track(list, "LIST")(httptest.NewRecorder(), r)
+
+	if got := testutil.ToFloat64(sent); got != 250 {
+		t.Errorf("sent bytes = %v, want 250", got)
+	}
+	if got := testutil.ToFloat64(hits); got != 0 {
+		t.Errorf("cache hit bytes = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(misses); got != 0 {
+		t.Errorf("cache miss bytes = %v, want 0", got)
+	}
+}
+
+func TestTrackSplitsProcessingAndTransferTime(t *testing.T) {
+	const bucket = "stats-processing-transfer"
+	const delay = 20 * time.Millisecond
+	processing := stats_collect.S3ProcessingTimeHistogram.WithLabelValues("GET", bucket)
+	transfer := stats_collect.S3TransferTimeHistogram.WithLabelValues("GET", bucket)
+
+	slowClient := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first"))
+		time.Sleep(delay)
+		w.Write([]byte("last"))
+	}
+	track(slowClient, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+
+	processingCount, processingSum := observedHistogram(t, processing)
+	transferCount, transferSum := observedHistogram(t, transfer)
+	if processingCount != 1 || transferCount != 1 {
+		t.Fatalf("observations = %d processing, %d transfer, want 1 each", processingCount, transferCount)
+	}
+	if transferSum < delay.Seconds() {
+		t.Errorf("transfer time = %vs, want at least the %v between writes", transferSum, delay)
+	}
+	if processingSum >= delay.Seconds() {
+		t.Errorf("processing time = %vs, want it to exclude the %v between writes", processingSum, delay)
+	}
+
+	// Without a body the whole request is processing time.
+	noBody := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.WriteHeader(http.StatusNoContent)
+	}
+	track(noBody, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	processingCount, processingSum = observedHistogram(t, processing)
+	transferCount, _ = observedHistogram(t, transfer)
+	if processingCount != 2 || transferCount != 1 {
+		t.Fatalf("observations = %d processing, %d transfer, want 2 and 1", processingCount, transferCount)
+	}
+	if processingSum < delay.Seconds() {
+		t.Errorf("processing time = %vs, want at least %v", processingSum, delay)
+	}
+}
+
+func TestTrackCountsSlowRequests(t *testing.T) {
+	const bucket = "stats-slow"
+	old := slowRequestThreshold
+	t.Cleanup(func() { slowRequestThreshold = old })
+	slowRequestThreshold = 20 * time.Millisecond
+	slow := stats_collect.S3SlowRequestCounter.WithLabelValues("GET", bucket)
+
+	fast := func(w http.ResponseWriter, r *http.Request) {}
+	sleepy := func(w http.ResponseWriter, r *http.Request) { time.Sleep(40 * time.Millisecond) }
+	track(fast, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	track(sleepy, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	if got := testutil.ToFloat64(slow); got != 1 {
+		t.Errorf("slow requests = %v, want 1", got)
+	}
+
+	// Without a threshold nothing is counted.
+	slowRequestThreshold = 0
+	track(sleepy, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	if got := testutil.ToFloat64(slow); got != 1 {
+		t.Errorf("slow requests = %v with the counter disabled, want 1", got)
+	}
+}
+
+func TestTrackObservesRequestAndResponseSizes(t *testing.T) {
+	const bucket = "stats-track-body-sizes"
+	echo := func(w http.ResponseWriter, r *http.Request) { io.Copy(w, r.Body) }
+	send := func(body string) {
+		r := newStatsRequest(http.MethodPut, bucket, "k", "10.0.0.1:1234")
+		if body != "" {
+			r.Body, r.ContentLength = io.NopCloser(strings.NewReader(body)), int64(len(body))
+		} else {
+			r.Body = http.NoBody
+		}
+		track(authDisabled(echo), "PUT")(httptest.NewRecorder(), r)
+	}
+	send(strings.Repeat("x", 100))
+	send(strings.Repeat("x", 5000))
+	// Requests and responses without a body are not observed.
+	send("")
+
+	for name, observer := range map[string]prometheus.Observer{
+		"request":  stats_collect.S3RequestBytesHistogram.WithLabelValues(bucket),
+		"response": stats_collect.S3ResponseBytesHistogram.WithLabelValues(bucket),
+	} {
+		count, sum := observedHistogram(t, observer)
+		if count != 2 || sum != 5100 {
+			t.Errorf("%s sizes: %d observations of %v bytes, want 2 of 5100", name, count, sum)
+		}
+	}
+}
+
+func TestTrackCountsNotModified(t *testing.T) {
+	const bucket = "stats-not-modified"
+	respond := func(status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte("body"))
+		}
+	}
+	get := func(status int, conditional bool) {
+		r := newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234")
+		if conditional {
+			r.Header.Set("If-None-Match", `"etag"`)
+		}
+		track(respond(status), "GET")(httptest.NewRecorder(), r)
+	}
+
+	get(http.StatusNotModified, true)
+	get(http.StatusOK, true)
+	get(http.StatusOK, false)
+
+	if got := testutil.ToFloat64(stats_collect.S3NotModifiedCounter.WithLabelValues(bucket)); got != 1 {
+		t.Errorf("not modified responses = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3ConditionalReadCounter.WithLabelValues(bucket)); got != 2 {
+		t.Errorf("conditional reads = %v, want 2", got)
+	}
+	// Only the two 200 responses are egress.
+	if got := testutil.ToFloat64(stats_collect.S3BucketTrafficSentBytesCounter.WithLabelValues(bucket, noAccount)); got != 8 {
+		t.Errorf("sent bytes = %v, want 8", got)
+	}
+}
+
+func TestTrackRecordsLastServerError(t *testing.T) {
+	const bucket = "stats-last-error"
+	respond := func(status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(status) }
+	}
+	lastError := stats_collect.S3BucketLastErrorTime.WithLabelValues(bucket)
+
+	track(respond(http.StatusNotFound), "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	if got := testutil.ToFloat64(lastError); got != 0 {
+		t.Errorf("last error time = %v after a 404, want 0", got)
+	}
+
+	before := float64(time.Now().Unix())
+	track(respond(http.StatusServiceUnavailable), "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	if got := testutil.ToFloat64(lastError); got < before || got > float64(time.Now().Unix()+1) {
+		t.Errorf("last error time = %v after a 503, want about %v", got, before)
+	}
+}
+
+func TestTrackCountsRedirects(t *testing.T) {
+	const bucket = "stats-redirect"
+	respond := func(status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(status) }
+	}
+	for _, status := range []int{http.StatusTemporaryRedirect, http.StatusTemporaryRedirect, http.StatusMovedPermanently, http.StatusNotModified, http.StatusOK} {
+		track(respond(status), "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+	}
+	for status, want := range map[string]float64{"307": 2, "301": 1, "304": 0, "200": 0} {
+		if got := testutil.ToFloat64(stats_collect.S3RedirectCounter.WithLabelValues(bucket, status)); got != want {
+			t.Errorf("%s redirects = %v, want %v", status, got, want)
+		}
+	}
+}
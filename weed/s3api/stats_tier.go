@@ -0,0 +1,69 @@
+package s3api
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+)
+
+// defaultBillingTier is the tier of objects not matched by S3_BILLING_TIERS.
+const defaultBillingTier = "standard"
+
+// billingTiers assigns the read and write counters a tier by object key
+// prefix. It is read from S3_BILLING_TIERS, e.g. "cold/=cold,archive/=archive",
+// and a rule is limited to one bucket with "bucket:prefix=tier". Only the
+// tiers named there, plus the default, ever appear as label values.
+var billingTiers = parseBillingTiers(os.Getenv("S3_BILLING_TIERS"))
+
+type billingTierRule struct {
+	bucket string // empty matches every bucket
+	prefix string
+	tier   string
+}
+
+// parseBillingTiers parses a comma separated list of [bucket:]prefix=tier
+// rules and orders them so that the first match is the longest prefix, with
+// bucket scoped rules before global ones of the same length.
+func parseBillingTiers(s string) []billingTierRule {
+	var rules []billingTierRule
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, tier, found := strings.Cut(entry, "=")
+		tier = strings.TrimSpace(tier)
+		if !found || tier == "" {
+			glog.Warningf("S3_BILLING_TIERS: skipping invalid entry %q", entry)
+			continue
+		}
+		rule := billingTierRule{prefix: strings.TrimSpace(key), tier: tier}
+		if bucket, prefix, scoped := strings.Cut(rule.prefix, ":"); scoped {
+			rule.bucket, rule.prefix = bucket, prefix
+		}
+		rule.prefix = strings.TrimPrefix(rule.prefix, "/")
+		rules = append(rules, rule)
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		if len(rules[i].prefix) != len(rules[j].prefix) {
+			return len(rules[i].prefix) > len(rules[j].prefix)
+		}
+		return rules[i].bucket != "" && rules[j].bucket == ""
+	})
+	return rules
+}
+
+// classifyTier returns the billing tier of object in bucket.
+func classifyTier(bucket, object string) string {
+	for _, rule := range billingTiers {
+		if rule.bucket != "" && rule.bucket != bucket {
+			continue
+		}
+		if strings.HasPrefix(object, rule.prefix) {
+			return rule.tier
+		}
+	}
+	return defaultBillingTier
+}
@@ -0,0 +1,65 @@
+package s3api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func withBillingTiers(t *testing.T, s string) {
+	previous := billingTiers
+	billingTiers = parseBillingTiers(s)
+	t.Cleanup(func() { billingTiers = previous })
+}
+
+func TestClassifyTier(t *testing.T) {
+	withBillingTiers(t, "cold/=cold, cold/deep/=archive,logs:cold/=logs-cold,archive/=archive,bad,empty=")
+
+	tests := []struct {
+		bucket, object, want string
+	}{
+		{"a", "cold/x", "cold"},
+		{"a", "cold/deep/x", "archive"},
+		{"a", "archive/2024/x", "archive"},
+		{"logs", "cold/x", "logs-cold"},
+		{"logs", "cold/deep/x", "archive"},
+		{"a", "hot/x", defaultBillingTier},
+		{"a", "coldish", defaultBillingTier},
+		{"a", "", defaultBillingTier},
+		{"a", "empty", defaultBillingTier},
+	}
+	for _, tt := range tests {
+		if got := classifyTier(tt.bucket, tt.object); got != tt.want {
+			t.Errorf("classifyTier(%q, %q) = %q, want %q", tt.bucket, tt.object, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyTierUnconfigured(t *testing.T) {
+	withBillingTiers(t, "")
+	if got := classifyTier("a", "cold/x"); got != defaultBillingTier {
+		t.Errorf("classifyTier without tiers = %q, want %q", got, defaultBillingTier)
+	}
+}
+
+func TestTrackLabelsTier(t *testing.T) {
+	withBillingTiers(t, "cold/=cold")
+	const bucket = "stats-track-tier"
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	coldBefore := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, noAccessKey, "cold"))
+	standardBefore := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier))
+
+	track(ok, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "cold/a", "127.0.0.1:1234"))
+	track(ok, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "hot/a", "127.0.0.1:1234"))
+
+	if got := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, noAccessKey, "cold")) - coldBefore; got != 1 {
+		t.Errorf("cold reads = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(stats_collect.S3ReadCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier)) - standardBefore; got != 1 {
+		t.Errorf("standard reads = %v, want 1", got)
+	}
+}
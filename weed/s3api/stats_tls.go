@@ -0,0 +1,49 @@
+package s3api
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+// tlsVersionLabel returns the S3TLSVersionCounter label of the connection's
+// TLS version, "none" without TLS and "other" for versions that are not
+// named, which keeps the label bounded.
+func tlsVersionLabel(state *tls.ConnectionState) string {
+	if state == nil {
+		return "none"
+	}
+	switch state.Version {
+	case tls.VersionTLS10:
+		return "TLS1.0"
+	case tls.VersionTLS11:
+		return "TLS1.1"
+	case tls.VersionTLS12:
+		return "TLS1.2"
+	case tls.VersionTLS13:
+		return "TLS1.3"
+	default:
+		return "other"
+	}
+}
+
+// tlsCipherLabel returns the S3TLSCipherCounter label of a cipher suite, or
+// "other" for suites that Go does not know by name.
+func tlsCipherLabel(id uint16) string {
+	name := tls.CipherSuiteName(id)
+	if strings.HasPrefix(name, "0x") {
+		return "other"
+	}
+	return name
+}
+
+// trackTLS counts the TLS version, and for TLS requests the cipher suite, r
+// was received with.
+func trackTLS(r *http.Request, bucket string) {
+	stats_collect.S3TLSVersionCounter.WithLabelValues(bucket, tlsVersionLabel(r.TLS)).Inc()
+	if r.TLS != nil {
+		stats_collect.S3TLSCipherCounter.WithLabelValues(tlsCipherLabel(r.TLS.CipherSuite)).Inc()
+	}
+}
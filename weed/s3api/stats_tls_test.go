@@ -0,0 +1,63 @@
+package s3api
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func TestTLSVersionLabel(t *testing.T) {
+	tests := []struct {
+		state *tls.ConnectionState
+		want  string
+	}{
+		{nil, "none"},
+		{&tls.ConnectionState{Version: tls.VersionTLS10}, "TLS1.0"},
+		{&tls.ConnectionState{Version: tls.VersionTLS11}, "TLS1.1"},
+		{&tls.ConnectionState{Version: tls.VersionTLS12}, "TLS1.2"},
+		{&tls.ConnectionState{Version: tls.VersionTLS13}, "TLS1.3"},
+		{&tls.ConnectionState{Version: 0x0300}, "other"},
+	}
+	for _, tt := range tests {
+		if got := tlsVersionLabel(tt.state); got != tt.want {
+			t.Errorf("tlsVersionLabel(%+v) = %q, want %q", tt.state, got, tt.want)
+		}
+	}
+	if got := tlsCipherLabel(tls.TLS_AES_128_GCM_SHA256); got != "TLS_AES_128_GCM_SHA256" {
+		t.Errorf("tlsCipherLabel(TLS_AES_128_GCM_SHA256) = %q", got)
+	}
+	if got := tlsCipherLabel(0xfefe); got != "other" {
+		t.Errorf("tlsCipherLabel(0xfefe) = %q, want other", got)
+	}
+}
+
+func TestTrackCountsTLSVersions(t *testing.T) {
+	const bucket = "stats-track-tls"
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	request := func(state *tls.ConnectionState) *http.Request {
+		r := newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234")
+		r.TLS = state
+		return r
+	}
+	cipher := stats_collect.S3TLSCipherCounter.WithLabelValues("TLS_AES_256_GCM_SHA384")
+	cipherBefore := testutil.ToFloat64(cipher)
+
+	track(ok, "GET")(httptest.NewRecorder(), request(nil))
+	track(ok, "GET")(httptest.NewRecorder(), request(&tls.ConnectionState{Version: tls.VersionTLS12, CipherSuite: tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}))
+	track(ok, "GET")(httptest.NewRecorder(), request(&tls.ConnectionState{Version: tls.VersionTLS13, CipherSuite: tls.TLS_AES_256_GCM_SHA384}))
+	track(ok, "GET")(httptest.NewRecorder(), request(&tls.ConnectionState{Version: tls.VersionTLS13, CipherSuite: tls.TLS_AES_256_GCM_SHA384}))
+
+	for version, want := range map[string]float64{"none": 1, "TLS1.2": 1, "TLS1.3": 2} {
+		if got := testutil.ToFloat64(stats_collect.S3TLSVersionCounter.WithLabelValues(bucket, version)); got != want {
+			t.Errorf("%s requests = %v, want %v", version, got, want)
+		}
+	}
+	if got := testutil.ToFloat64(cipher) - cipherBefore; got != 2 {
+		t.Errorf("TLS_AES_256_GCM_SHA384 requests = %v, want 2", got)
+	}
+}
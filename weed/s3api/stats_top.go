@@ -0,0 +1,142 @@
+package s3api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+)
+
+const (
+	topBucketsPath = "/status/s3/top"
+	// defaultTopBuckets and maxTopBuckets bound the n parameter of
+	// topBucketsPath.
+	defaultTopBuckets = 20
+	maxTopBuckets     = 1000
+	// maxTopBucketsTracked bounds the buckets counted in a window; requests to
+	// further buckets are not counted until the next window.
+	maxTopBucketsTracked = 10000
+)
+
+// topBucketsWindow is how long bucket request counts accumulate before they
+// are reset, S3_TOP_BUCKETS_WINDOW.
+var topBucketsWindow = envDuration("S3_TOP_BUCKETS_WINDOW", 5*time.Minute)
+
+// bucketRequestWindow counts the requests of every bucket in the current
+// window, for on-call engineers to see the busiest buckets without Prometheus.
+var bucketRequestWindow = newRequestWindows()
+
+func init() {
+	if topBucketsWindow > 0 {
+		go bucketRequestWindow.resetEvery(topBucketsWindow)
+	}
+}
+
+// requestWindows holds the counts of the current window. Counting is a map
+// lookup and an atomic add; reset swaps in an empty window.
+type requestWindows struct {
+	current atomic.Pointer[requestWindow]
+}
+
+type requestWindow struct {
+	start   time.Time
+	counts  sync.Map // bucket -> *atomic.Uint64
+	buckets atomic.Int64
+}
+
+func newRequestWindows() *requestWindows {
+	w := &requestWindows{}
+	w.reset(time.Now())
+	return w
+}
+
+// add counts a request to bucket.
+func (w *requestWindows) add(bucket string) {
+	if bucket == "" {
+		return
+	}
+	window := w.current.Load()
+	if count, ok := window.counts.Load(bucket); ok {
+		count.(*atomic.Uint64).Add(1)
+		return
+	}
+	if window.buckets.Load() >= maxTopBucketsTracked {
+		return
+	}
+	count, loaded := window.counts.LoadOrStore(bucket, new(atomic.Uint64))
+	if !loaded {
+		window.buckets.Add(1)
+	}
+	count.(*atomic.Uint64).Add(1)
+}
+
+// reset starts a new, empty window at now.
+func (w *requestWindows) reset(now time.Time) {
+	w.current.Store(&requestWindow{start: now})
+}
+
+func (w *requestWindows) resetEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		w.reset(now)
+	}
+}
+
+// bucketRequests is the request count of a bucket in topBuckets.
+type bucketRequests struct {
+	Bucket   string `json:"bucket"`
+	Requests uint64 `json:"requests"`
+}
+
+type topBucketsSnapshot struct {
+	WindowStart time.Time        `json:"window_start"`
+	Buckets     []bucketRequests `json:"buckets"`
+}
+
+// top returns the n buckets with the most requests in the current window,
+// busiest first and ties by name.
+func (w *requestWindows) top(n int) topBucketsSnapshot {
+	window := w.current.Load()
+	buckets := []bucketRequests{}
+	window.counts.Range(func(key, value any) bool {
+		buckets = append(buckets, bucketRequests{Bucket: key.(string), Requests: value.(*atomic.Uint64).Load()})
+		return true
+	})
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].Requests != buckets[j].Requests {
+			return buckets[i].Requests > buckets[j].Requests
+		}
+		return buckets[i].Bucket < buckets[j].Bucket
+	})
+	if len(buckets) > n {
+		buckets = buckets[:n]
+	}
+	return topBucketsSnapshot{WindowStart: window.start.UTC(), Buckets: buckets}
+}
+
+// topBucketsHandler serves the busiest buckets of the current window as JSON,
+// as many as the n query parameter asks for.
+func topBucketsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	n := defaultTopBuckets
+	if value := r.URL.Query().Get("n"); value != "" {
+		var err error
+		if n, err = strconv.Atoi(value); err != nil || n < 1 || n > maxTopBuckets {
+			http.Error(w, "n must be between 1 and "+strconv.Itoa(maxTopBuckets), http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(bucketRequestWindow.top(n)); err != nil {
+		glog.V(1).Infof("write top s3 buckets: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package s3api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// withRequestWindow counts the tracked requests in a fresh window for the
+// duration of the test.
+func withRequestWindow(t *testing.T) {
+	t.Helper()
+	old := bucketRequestWindow
+	bucketRequestWindow = newRequestWindows()
+	t.Cleanup(func() { bucketRequestWindow = old })
+}
+
+func TestTopBucketsHandler(t *testing.T) {
+	withRequestWindow(t)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	for bucket, requests := range map[string]int{"warm": 3, "hot": 5, "cold": 1, "also-warm": 3} {
+		for i := 0; i < requests; i++ {
+			track(ok, "GET")(httptest.NewRecorder(), newStatsRequest(http.MethodGet, bucket, "k", "10.0.0.1:1234"))
+		}
+	}
+
+	w := httptest.NewRecorder()
+	topBucketsHandler(w, httptest.NewRequest(http.MethodGet, topBucketsPath+"?n=3", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var body topBucketsSnapshot
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s: %v", w.Body.String(), err)
+	}
+	want := []bucketRequests{{"hot", 5}, {"also-warm", 3}, {"warm", 3}}
+	if len(body.Buckets) != len(want) {
+		t.Fatalf("buckets = %v, want %v", body.Buckets, want)
+	}
+	for i := range want {
+		if body.Buckets[i] != want[i] {
+			t.Errorf("buckets[%d] = %v, want %v", i, body.Buckets[i], want[i])
+		}
+	}
+
+	// A new window starts empty.
+	bucketRequestWindow.reset(time.Now())
+	if got := bucketRequestWindow.top(defaultTopBuckets).Buckets; len(got) != 0 {
+		t.Errorf("buckets after reset = %v, want none", got)
+	}
+}
+
+func TestTopBucketsHandlerRejectsBadN(t *testing.T) {
+	for _, n := range []string{"0", "-1", "many", "100000"} {
+		w := httptest.NewRecorder()
+		topBucketsHandler(w, httptest.NewRequest(http.MethodGet, topBucketsPath+"?n="+n, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("n=%s: status = %d, want 400", n, w.Code)
+		}
+	}
+}
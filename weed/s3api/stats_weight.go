@@ -0,0 +1,51 @@
+package s3api
+
+import (
+	"context"
+	"net/http"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+type requestWeightKey struct{}
+
+// requestWeight carries the number of billed units a request stands for from
+// its handler, which parses the request body anyway, back out to track. The
+// handler only runs once the request is authenticated, so that anonymous
+// clients cannot make the gateway parse bodies just to weigh them.
+type requestWeight struct {
+	action string
+	units  int
+}
+
+// withRequestWeight prepares r to record its weight, 1 unless its handler
+// reports otherwise.
+func withRequestWeight(r *http.Request, action string) (*http.Request, *requestWeight) {
+	w := &requestWeight{action: action, units: 1}
+	return r.WithContext(context.WithValue(r.Context(), requestWeightKey{}, w)), w
+}
+
+// recordRequestWeight reports that r stands for n billed units, the keys of a
+// DeleteObjects batch or the parts of a CompleteMultipartUpload, up to max.
+func recordRequestWeight(r *http.Request, n, max int) {
+	w, ok := r.Context().Value(requestWeightKey{}).(*requestWeight)
+	if !ok {
+		return
+	}
+	switch {
+	case n < 1:
+		w.units = 1
+	case n > max:
+		w.units = max
+	default:
+		w.units = n
+	}
+}
+
+// recordRequestWeightError counts a request body that the handler of r could
+// not parse in S3RequestWeightParseErrors. Such requests weigh 1.
+func recordRequestWeightError(r *http.Request, reason string) {
+	if w, ok := r.Context().Value(requestWeightKey{}).(*requestWeight); ok {
+		stats_collect.S3RequestWeightParseErrors.WithLabelValues(w.action, reason).Inc()
+	}
+}
@@ -0,0 +1,86 @@
+package s3api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	stats_collect "github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+const deleteThreeObjects = `<Delete><Quiet>true</Quiet><Object><Key>a</Key></Object><Object><Key>b</Key></Object><Object><Key>c</Key><VersionId>v1</VersionId></Object></Delete>`
+
+func newWeightRequest(target, bucket, object, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	r.RemoteAddr = "10.0.0.1:1234"
+	return mux.SetURLVars(r, map[string]string{"bucket": bucket, "object": object})
+}
+
+func TestRecordRequestWeight(t *testing.T) {
+	tests := []struct {
+		name  string
+		units int
+		want  int
+	}{
+		{"keys", 3, 3},
+		{"empty batch", 0, 1},
+		{"capped", deleteMultipleObjectsLimit + 5, deleteMultipleObjectsLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, weight := withRequestWeight(newWeightRequest("/b?delete", "b", "", ""), "DELETE")
+			recordRequestWeight(r, tt.units, deleteMultipleObjectsLimit)
+			if weight.units != tt.want {
+				t.Errorf("weight = %d, want %d", weight.units, tt.want)
+			}
+		})
+	}
+	// Requests outside track are not weighed.
+	recordRequestWeight(newWeightRequest("/b?delete", "b", "", ""), 3, deleteMultipleObjectsLimit)
+}
+
+func TestTrackWeightsBatchDelete(t *testing.T) {
+	const bucket = "stats-track-batch-delete"
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		recordRequestWeight(r, 3, deleteMultipleObjectsLimit)
+	}
+	writes := stats_collect.S3WriteCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier, defaultStorageClass)
+	requests := stats_collect.S3RequestCounter.WithLabelValues("DELETE", "200", bucket, noAccessKey)
+	writesBefore, requestsBefore := testutil.ToFloat64(writes), testutil.ToFloat64(requests)
+
+	track(authDisabled(handler), "DELETE")(httptest.NewRecorder(), newWeightRequest("/"+bucket+"?delete", bucket, "", deleteThreeObjects))
+
+	if got := testutil.ToFloat64(writes) - writesBefore; got != 3 {
+		t.Errorf("writes = %v, want one per deleted key", got)
+	}
+	if got := testutil.ToFloat64(requests) - requestsBefore; got != 1 {
+		t.Errorf("requests = %v, want 1", got)
+	}
+}
+
+func TestDeleteObjectsCountsMalformedBodies(t *testing.T) {
+	const bucket = "stats-track-malformed-delete"
+	errors := stats_collect.S3RequestWeightParseErrors.WithLabelValues("DELETE", "malformed")
+	writes := stats_collect.S3WriteCounter.WithLabelValues(bucket, noAccessKey, defaultBillingTier, defaultStorageClass)
+	errorsBefore, writesBefore := testutil.ToFloat64(errors), testutil.ToFloat64(writes)
+
+	s3a := &S3ApiServer{}
+	w := httptest.NewRecorder()
+	track(authDisabled(s3a.DeleteMultipleObjectsHandler), "DELETE")(w, newWeightRequest("/"+bucket+"?delete", bucket, "", `<Delete><Object><Key>a</Key></Object`))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+	if got := testutil.ToFloat64(errors) - errorsBefore; got != 1 {
+		t.Errorf("malformed parse errors = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(writes) - writesBefore; got != 1 {
+		t.Errorf("writes = %v, want the request weighed 1", got)
+	}
+}
@@ -0,0 +1,75 @@
+package stats
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const defaultActiveBucketsWindow = 5 * time.Minute
+
+var activeS3Buckets = newActiveBuckets(defaultActiveBucketsWindow, S3ActiveBucketsGauge, time.Now)
+
+// SetActiveBucketsWindow sets how long a bucket counts as active in
+// S3ActiveBucketsGauge after its last request.
+func SetActiveBucketsWindow(window time.Duration) {
+	if window > 0 {
+		activeS3Buckets.window.Store(int64(window))
+	}
+}
+
+// activeBuckets tracks the buckets seen within a sliding window. Entries are
+// kept in a sync.Map so that recording never waits for a prune, and pruning
+// deletes entries one at a time instead of locking during the whole scan.
+type activeBuckets struct {
+	window atomic.Int64 // time.Duration
+	gauge  prometheus.Gauge
+	now    func() time.Time
+
+	lastSeen sync.Map // bucket -> *atomic.Int64 unix nanoseconds
+}
+
+func newActiveBuckets(window time.Duration, gauge prometheus.Gauge, now func() time.Time) *activeBuckets {
+	a := &activeBuckets{gauge: gauge, now: now}
+	a.window.Store(int64(window))
+	return a
+}
+
+func (a *activeBuckets) record(bucket string) {
+	if bucket == "" {
+		return
+	}
+	ts := a.now().UnixNano()
+	if seen, ok := a.lastSeen.Load(bucket); ok {
+		seen.(*atomic.Int64).Store(ts)
+		return
+	}
+	seen := &atomic.Int64{}
+	seen.Store(ts)
+	if existing, loaded := a.lastSeen.LoadOrStore(bucket, seen); loaded {
+		existing.(*atomic.Int64).Store(ts)
+		return
+	}
+	a.gauge.Inc()
+}
+
+// prune forgets the buckets not seen within the window.
+func (a *activeBuckets) prune() {
+	cutoff := a.now().Add(-time.Duration(a.window.Load())).UnixNano()
+	a.lastSeen.Range(func(bucket, value any) bool {
+		if value.(*atomic.Int64).Load() < cutoff && a.lastSeen.CompareAndDelete(bucket, value) {
+			a.gauge.Dec()
+		}
+		return true
+	})
+}
+
+// pruneEvery prunes a tenth of the window after the previous prune.
+func (a *activeBuckets) pruneEvery() {
+	for {
+		time.Sleep(time.Duration(a.window.Load()) / 10)
+		a.prune()
+	}
+}
@@ -0,0 +1,49 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestActiveBucketsSlidingWindow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "active_buckets"})
+	a := newActiveBuckets(5*time.Minute, gauge, func() time.Time { return now })
+	active := func() float64 { return testutil.ToFloat64(gauge) }
+
+	a.record("a")
+	a.record("b")
+	a.record("a")
+	a.record("")
+	if got := active(); got != 2 {
+		t.Fatalf("active buckets = %v, want 2", got)
+	}
+
+	now = now.Add(3 * time.Minute)
+	a.record("b")
+	a.record("c")
+	a.prune()
+	if got := active(); got != 3 {
+		t.Fatalf("active buckets after 3m = %v, want 3", got)
+	}
+
+	now = now.Add(3 * time.Minute)
+	a.prune()
+	if got := active(); got != 2 {
+		t.Fatalf("active buckets after 6m = %v, want 2, a expired", got)
+	}
+
+	now = now.Add(10 * time.Minute)
+	a.prune()
+	if got := active(); got != 0 {
+		t.Fatalf("active buckets after 16m = %v, want 0", got)
+	}
+
+	a.record("a")
+	if got := active(); got != 1 {
+		t.Fatalf("active buckets after a returns = %v, want 1", got)
+	}
+}
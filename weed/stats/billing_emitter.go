@@ -0,0 +1,219 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+)
+
+// BillingUsage is the usage of one bucket during one emitter interval.
+type BillingUsage struct {
+	Bucket        string `json:"bucket"`
+	Timestamp     int64  `json:"timestamp"`
+	Reads         uint64 `json:"reads"`
+	Writes        uint64 `json:"writes"`
+	BytesReceived uint64 `json:"bytes_received"`
+	BytesSent     uint64 `json:"bytes_sent"`
+}
+
+type billingTotals struct {
+	reads, writes, bytesReceived, bytesSent atomic.Uint64
+}
+
+type billingCounts struct {
+	reads, writes, bytesReceived, bytesSent uint64
+}
+
+// BillingEmitter pushes per-bucket usage deltas to a webhook. It keeps its
+// own cumulative counters, which the request path feeds, and every interval
+// POSTs the difference to the previous snapshot as a JSON array. Batches
+// that cannot be delivered are queued, up to a bound, and retried on the
+// next interval. A nil *BillingEmitter ignores all usage.
+type BillingEmitter struct {
+	url      string
+	client   *http.Client
+	interval time.Duration
+
+	// maxAttempts and retryBackoff control how often a batch is retried
+	// within one interval; the backoff doubles after each failed attempt.
+	maxAttempts  int
+	retryBackoff time.Duration
+	// maxQueued bounds the undelivered batches; the oldest are dropped.
+	maxQueued int
+
+	totals sync.Map // bucket -> *billingTotals
+
+	// Only touched by the flushing goroutine.
+	last  map[string]billingCounts
+	queue [][]BillingUsage
+
+	stop chan struct{}
+}
+
+func NewBillingEmitter(url string, interval time.Duration) *BillingEmitter {
+	return &BillingEmitter{
+		url:          url,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		interval:     interval,
+		maxAttempts:  3,
+		retryBackoff: time.Second,
+		maxQueued:    100,
+		last:         make(map[string]billingCounts),
+		stop:         make(chan struct{}),
+	}
+}
+
+// Start flushes usage every interval until Stop is called.
+func (e *BillingEmitter) Start() {
+	go func() {
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				e.flush()
+			case <-e.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (e *BillingEmitter) Stop() {
+	close(e.stop)
+}
+
+func (e *BillingEmitter) AddReads(bucket string, n uint64) {
+	if t := e.bucketTotals(bucket); t != nil {
+		t.reads.Add(n)
+	}
+}
+
+func (e *BillingEmitter) AddWrites(bucket string, n uint64) {
+	if t := e.bucketTotals(bucket); t != nil {
+		t.writes.Add(n)
+	}
+}
+
+func (e *BillingEmitter) AddBytesReceived(bucket string, n uint64) {
+	if t := e.bucketTotals(bucket); t != nil {
+		t.bytesReceived.Add(n)
+	}
+}
+
+func (e *BillingEmitter) AddBytesSent(bucket string, n uint64) {
+	if t := e.bucketTotals(bucket); t != nil {
+		t.bytesSent.Add(n)
+	}
+}
+
+func (e *BillingEmitter) bucketTotals(bucket string) *billingTotals {
+	if e == nil {
+		return nil
+	}
+	return loadBillingTotals(&e.totals, bucket)
+}
+
+// loadBillingTotals returns the totals of bucket in totals, adding them on
+// first use. Usage without a bucket is not billed and has no totals.
+func loadBillingTotals(totals *sync.Map, bucket string) *billingTotals {
+	if bucket == "" {
+		return nil
+	}
+	if t, ok := totals.Load(bucket); ok {
+		return t.(*billingTotals)
+	}
+	t, _ := totals.LoadOrStore(bucket, &billingTotals{})
+	return t.(*billingTotals)
+}
+
+func (t *billingTotals) load() billingCounts {
+	return billingCounts{
+		reads:         t.reads.Load(),
+		writes:        t.writes.Load(),
+		bytesReceived: t.bytesReceived.Load(),
+		bytesSent:     t.bytesSent.Load(),
+	}
+}
+
+// flush queues the usage since the previous flush and delivers the queue.
+func (e *BillingEmitter) flush() {
+	if batch := e.diff(time.Now()); len(batch) > 0 {
+		e.queue = append(e.queue, batch)
+		if dropped := len(e.queue) - e.maxQueued; dropped > 0 {
+			glog.Warningf("billing webhook %s unavailable, dropping %d usage batches", e.url, dropped)
+			e.queue = e.queue[dropped:]
+		}
+	}
+	for len(e.queue) > 0 {
+		if err := e.send(e.queue[0]); err != nil {
+			glog.Warningf("billing webhook %s: %v, %d usage batches queued", e.url, err, len(e.queue))
+			return
+		}
+		e.queue = e.queue[1:]
+	}
+}
+
+// diff snapshots the totals and returns the per-bucket usage since the
+// previous snapshot, leaving out buckets without usage.
+func (e *BillingEmitter) diff(now time.Time) []BillingUsage {
+	var batch []BillingUsage
+	e.totals.Range(func(key, value any) bool {
+		bucket, t := key.(string), value.(*billingTotals)
+		current := t.load()
+		previous := e.last[bucket]
+		e.last[bucket] = current
+		if current == previous {
+			return true
+		}
+		batch = append(batch, BillingUsage{
+			Bucket:        bucket,
+			Timestamp:     now.Unix(),
+			Reads:         current.reads - previous.reads,
+			Writes:        current.writes - previous.writes,
+			BytesReceived: current.bytesReceived - previous.bytesReceived,
+			BytesSent:     current.bytesSent - previous.bytesSent,
+		})
+		return true
+	})
+	return batch
+}
+
+// send POSTs batch, retrying with exponential backoff.
+func (e *BillingEmitter) send(batch []BillingUsage) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	backoff := e.retryBackoff
+	for attempt := 1; ; attempt++ {
+		err = e.post(body)
+		if err == nil || attempt >= e.maxAttempts {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-e.stop:
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+func (e *BillingEmitter) post(body []byte) error {
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package stats
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+type billingWebhook struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+	batches  [][]BillingUsage
+}
+
+func (h *billingWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.attempts++
+	if h.failures > 0 {
+		h.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var batch []BillingUsage
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	sort.Slice(batch, func(i, j int) bool { return batch[i].Bucket < batch[j].Bucket })
+	h.batches = append(h.batches, batch)
+}
+
+func newTestBillingEmitter(t *testing.T, h *billingWebhook) *BillingEmitter {
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+	e := NewBillingEmitter(server.URL, time.Hour)
+	e.retryBackoff = time.Millisecond
+	return e
+}
+
+func TestBillingEmitterBatchesDeltas(t *testing.T) {
+	h := &billingWebhook{}
+	e := newTestBillingEmitter(t, h)
+
+	e.AddReads("a", 2)
+	e.AddBytesSent("a", 100)
+	e.AddWrites("b", 1)
+	e.AddBytesReceived("b", 50)
+	e.AddReads("", 1)
+	e.flush()
+
+	e.AddReads("a", 1)
+	e.flush()
+	// Nothing changed, nothing is sent.
+	e.flush()
+
+	if len(h.batches) != 2 {
+		t.Fatalf("got %d batches, want 2", len(h.batches))
+	}
+	first := h.batches[0]
+	if len(first) != 2 {
+		t.Fatalf("first batch = %+v, want buckets a and b", first)
+	}
+	if u := first[0]; u.Bucket != "a" || u.Reads != 2 || u.BytesSent != 100 || u.Writes != 0 {
+		t.Errorf("bucket a usage = %+v", u)
+	}
+	if u := first[1]; u.Bucket != "b" || u.Writes != 1 || u.BytesReceived != 50 || u.Reads != 0 {
+		t.Errorf("bucket b usage = %+v", u)
+	}
+	second := h.batches[1]
+	if len(second) != 1 || second[0].Bucket != "a" || second[0].Reads != 1 || second[0].BytesSent != 0 {
+		t.Errorf("second batch = %+v, want only the new read of bucket a", second)
+	}
+}
+
+func TestBillingEmitterRetries(t *testing.T) {
+	h := &billingWebhook{failures: 2}
+	e := newTestBillingEmitter(t, h)
+
+	e.AddWrites("a", 1)
+	e.flush()
+
+	if h.attempts != 3 || len(h.batches) != 1 {
+		t.Fatalf("attempts = %d, batches = %d, want delivery on the third attempt", h.attempts, len(h.batches))
+	}
+	if len(e.queue) != 0 {
+		t.Errorf("queue = %d batches after delivery, want 0", len(e.queue))
+	}
+}
+
+func TestBillingEmitterQueuesWhileDown(t *testing.T) {
+	h := &billingWebhook{failures: 1 << 30}
+	e := newTestBillingEmitter(t, h)
+	e.maxAttempts = 1
+	e.maxQueued = 2
+
+	for i := 0; i < 3; i++ {
+		e.AddReads("a", uint64(i+1))
+		e.flush()
+	}
+	if len(e.queue) != 2 {
+		t.Fatalf("queue = %d batches, want it bounded at 2", len(e.queue))
+	}
+
+	h.mu.Lock()
+	h.failures = 0
+	h.mu.Unlock()
+	e.flush()
+
+	if len(e.queue) != 0 || len(h.batches) != 2 {
+		t.Fatalf("queue = %d, delivered = %d, want the 2 queued batches delivered", len(e.queue), len(h.batches))
+	}
+	// The oldest batch was dropped; the queued ones are delivered in order.
+	if h.batches[0][0].Reads != 2 || h.batches[1][0].Reads != 3 {
+		t.Errorf("delivered reads = %d, %d, want 2, 3", h.batches[0][0].Reads, h.batches[1][0].Reads)
+	}
+}
+
+func TestBillingEmitterNil(t *testing.T) {
+	var e *BillingEmitter
+	e.AddReads("a", 1)
+	e.AddWrites("a", 1)
+	e.AddBytesReceived("a", 1)
+	e.AddBytesSent("a", 1)
+}
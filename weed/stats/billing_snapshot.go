@@ -0,0 +1,92 @@
+package stats
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// BillingSnapshot is a resettable view of the per-bucket billing usage, fed
+// alongside the Prometheus counters, which must never decrease. It lets test
+// and staging environments zero the usage between runs without a restart.
+// A nil *BillingSnapshot ignores all usage.
+type BillingSnapshot struct {
+	totals sync.Map // bucket -> *billingTotals
+}
+
+func NewBillingSnapshot() *BillingSnapshot {
+	return &BillingSnapshot{}
+}
+
+func (s *BillingSnapshot) AddReads(bucket string, n uint64) {
+	if t := s.bucketTotals(bucket); t != nil {
+		t.reads.Add(n)
+	}
+}
+
+func (s *BillingSnapshot) AddWrites(bucket string, n uint64) {
+	if t := s.bucketTotals(bucket); t != nil {
+		t.writes.Add(n)
+	}
+}
+
+func (s *BillingSnapshot) AddBytesReceived(bucket string, n uint64) {
+	if t := s.bucketTotals(bucket); t != nil {
+		t.bytesReceived.Add(n)
+	}
+}
+
+func (s *BillingSnapshot) AddBytesSent(bucket string, n uint64) {
+	if t := s.bucketTotals(bucket); t != nil {
+		t.bytesSent.Add(n)
+	}
+}
+
+func (s *BillingSnapshot) bucketTotals(bucket string) *billingTotals {
+	if s == nil {
+		return nil
+	}
+	return loadBillingTotals(&s.totals, bucket)
+}
+
+// Usage returns the usage of every bucket since the last Reset, sorted by
+// bucket and leaving out buckets without usage.
+func (s *BillingSnapshot) Usage(now time.Time) []BillingUsage {
+	usage := []BillingUsage{}
+	if s == nil {
+		return usage
+	}
+	s.totals.Range(func(key, value any) bool {
+		current := value.(*billingTotals).load()
+		if current == (billingCounts{}) {
+			return true
+		}
+		usage = append(usage, BillingUsage{
+			Bucket:        key.(string),
+			Timestamp:     now.Unix(),
+			Reads:         current.reads,
+			Writes:        current.writes,
+			BytesReceived: current.bytesReceived,
+			BytesSent:     current.bytesSent,
+		})
+		return true
+	})
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Bucket < usage[j].Bucket })
+	return usage
+}
+
+// Reset zeroes the usage of every bucket. Usage added while it runs may be
+// kept or zeroed, but is never counted twice.
+func (s *BillingSnapshot) Reset() {
+	if s == nil {
+		return
+	}
+	s.totals.Range(func(_, value any) bool {
+		t := value.(*billingTotals)
+		t.reads.Store(0)
+		t.writes.Store(0)
+		t.bytesReceived.Store(0)
+		t.bytesSent.Store(0)
+		return true
+	})
+}
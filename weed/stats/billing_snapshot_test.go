@@ -0,0 +1,46 @@
+package stats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBillingSnapshotReset(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := NewBillingSnapshot()
+	s.AddReads("a", 3)
+	s.AddWrites("a", 2)
+	s.AddBytesReceived("a", 100)
+	s.AddBytesSent("b", 40)
+	s.AddReads("", 5)
+
+	want := []BillingUsage{
+		{Bucket: "a", Timestamp: now.Unix(), Reads: 3, Writes: 2, BytesReceived: 100},
+		{Bucket: "b", Timestamp: now.Unix(), BytesSent: 40},
+	}
+	if got := s.Usage(now); !reflect.DeepEqual(got, want) {
+		t.Fatalf("usage = %+v, want %+v", got, want)
+	}
+
+	s.Reset()
+	if got := s.Usage(now); len(got) != 0 {
+		t.Fatalf("usage after reset = %+v, want none", got)
+	}
+
+	s.AddReads("b", 1)
+	want = []BillingUsage{{Bucket: "b", Timestamp: now.Unix(), Reads: 1}}
+	if got := s.Usage(now); !reflect.DeepEqual(got, want) {
+		t.Errorf("usage after reset and read = %+v, want %+v", got, want)
+	}
+}
+
+func TestNilBillingSnapshot(t *testing.T) {
+	var s *BillingSnapshot
+	s.AddReads("a", 1)
+	s.AddBytesSent("a", 1)
+	s.Reset()
+	if got := s.Usage(time.Now()); len(got) != 0 {
+		t.Errorf("nil snapshot usage = %+v", got)
+	}
+}
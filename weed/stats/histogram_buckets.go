@@ -0,0 +1,57 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+)
+
+// Histogram buckets that can be overridden with a comma separated list of
+// upper bounds, e.g. S3_REQUEST_LATENCY_BUCKETS=0.01,0.05,0.1,0.5,1,5. They
+// are read once, before the histograms are registered, because the buckets
+// of a registered histogram cannot change.
+var (
+	// s3RequestLatencyBuckets are in seconds, for S3RequestHistogram and
+	// S3RequestHistogramByOrigin.
+	s3RequestLatencyBuckets = envBuckets("S3_REQUEST_LATENCY_BUCKETS", prometheus.ExponentialBuckets(0.0001, 2, 24))
+	// s3TimeToFirstByteBuckets are in milliseconds, for S3TimeToFirstByteHistogram.
+	s3TimeToFirstByteBuckets = envBuckets("S3_TTFB_BUCKETS", []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000})
+)
+
+// envBuckets returns the histogram buckets listed in the named variable, or
+// def when it is unset or not a list of increasing finite numbers.
+func envBuckets(name string, def []float64) []float64 {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def
+	}
+	buckets, err := parseBuckets(value)
+	if err != nil {
+		glog.Warningf("ignoring invalid %s=%q: %v", name, value, err)
+		return def
+	}
+	return buckets
+}
+
+func parseBuckets(value string) ([]float64, error) {
+	var buckets []float64
+	for _, field := range strings.Split(value, ",") {
+		bound, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, err
+		}
+		if math.IsNaN(bound) || math.IsInf(bound, 0) {
+			return nil, fmt.Errorf("bucket %v is not finite", bound)
+		}
+		if len(buckets) > 0 && bound <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("bucket %v does not exceed %v", bound, buckets[len(buckets)-1])
+		}
+		buckets = append(buckets, bound)
+	}
+	return buckets, nil
+}
@@ -0,0 +1,68 @@
+package stats
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func histogramBuckets(t *testing.T, observer prometheus.Observer) []float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := observer.(prometheus.Metric).Write(&m); err != nil {
+		t.Fatalf("read histogram: %v", err)
+	}
+	var bounds []float64
+	for _, bucket := range m.GetHistogram().GetBucket() {
+		bounds = append(bounds, bucket.GetUpperBound())
+	}
+	return bounds
+}
+
+func TestEnvBuckets(t *testing.T) {
+	def := []float64{1, 2, 3}
+	tests := []struct {
+		value string
+		want  []float64
+	}{
+		{"", def},
+		{"0.01,0.05,0.1,0.5,1,5", []float64{0.01, 0.05, 0.1, 0.5, 1, 5}},
+		{" 0.5 , 2 ", []float64{0.5, 2}},
+		{"0.1,bogus,1", def},
+		{"1,0.5", def},
+		{"1,1", def},
+		{"0.1,NaN", def},
+		{"0.1,+Inf", def},
+		{"0.1,,1", def},
+	}
+	for _, tt := range tests {
+		t.Setenv("S3_TEST_BUCKETS", tt.value)
+		if got := envBuckets("S3_TEST_BUCKETS", def); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("envBuckets(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestEnvBucketsRegistered(t *testing.T) {
+	t.Setenv("S3_REQUEST_LATENCY_BUCKETS", "0.01,0.05,0.1,0.5,1,5")
+	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "env_buckets_seconds",
+		Buckets: envBuckets("S3_REQUEST_LATENCY_BUCKETS", prometheus.DefBuckets),
+	}, []string{"type"})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(histogram)
+	want := []float64{0.01, 0.05, 0.1, 0.5, 1, 5}
+	if got := histogramBuckets(t, histogram.WithLabelValues("GET")); !reflect.DeepEqual(got, want) {
+		t.Errorf("registered buckets = %v, want %v", got, want)
+	}
+
+	// The s3 histograms use the buckets read when the package was loaded.
+	if got := histogramBuckets(t, S3RequestHistogram.WithLabelValues("GET", "env-buckets")); !reflect.DeepEqual(got, s3RequestLatencyBuckets) {
+		t.Errorf("request histogram buckets = %v, want %v", got, s3RequestLatencyBuckets)
+	}
+	if got := histogramBuckets(t, S3TimeToFirstByteHistogram.WithLabelValues("GET", "env-buckets")); !reflect.DeepEqual(got, s3TimeToFirstByteBuckets) {
+		t.Errorf("time to first byte buckets = %v, want %v", got, s3TimeToFirstByteBuckets)
+	}
+}
@@ -1,14 +1,34 @@
 package stats
 
-import "net/http"
+import (
+	"io"
+	"net/http"
+	"time"
+)
 
 type StatusRecorder struct {
 	http.ResponseWriter
 	Status int
+	// CacheHit is set by handlers that served the body without fetching it
+	// from a volume server.
+	CacheHit bool
+	// ErrorCode is the S3 error code written to the response, if any.
+	ErrorCode string
+	// BytesWritten is the size of the response body written so far.
+	BytesWritten int64
+	// FirstWrite and LastWrite are when the response body was first and last
+	// written to, zero until it is.
+	FirstWrite, LastWrite time.Time
+	// WriteFailed is set once writing the response body failed, usually
+	// because the client went away.
+	WriteFailed bool
+	// BackendBytes is the size of the body data handlers fetched from the
+	// volume servers for the response, as reported by them.
+	BackendBytes int64
 }
 
 func NewStatusResponseWriter(w http.ResponseWriter) *StatusRecorder {
-	return &StatusRecorder{w, http.StatusOK}
+	return &StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
 }
 
 func (r *StatusRecorder) WriteHeader(status int) {
@@ -16,6 +36,36 @@ func (r *StatusRecorder) WriteHeader(status int) {
 	r.ResponseWriter.WriteHeader(status)
 }
 
+func (r *StatusRecorder) Write(b []byte) (int, error) {
+	now := time.Now()
+	if r.FirstWrite.IsZero() {
+		r.FirstWrite = now
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.BytesWritten += int64(n)
+	if err != nil {
+		r.WriteFailed = true
+	}
+	r.LastWrite = time.Now()
+	return n, err
+}
+
+// ReadFrom copies src through Write, so that the bytes are counted. It keeps
+// io.Copy from bypassing the recorder via the wrapped writer's ReadFrom.
+func (r *StatusRecorder) ReadFrom(src io.Reader) (int64, error) {
+	return io.Copy(writerOnly{r}, src)
+}
+
+// writerOnly hides every method of a writer but Write.
+type writerOnly struct {
+	io.Writer
+}
+
+// RecordErrorCode remembers the S3 error code of the response.
+func (r *StatusRecorder) RecordErrorCode(code string) {
+	r.ErrorCode = code
+}
+
 func (r *StatusRecorder) Flush() {
 	r.ResponseWriter.(http.Flusher).Flush()
 }
@@ -30,6 +30,28 @@ var SetVersionInfo = func() func(string, string, string) {
 	}
 }()
 
+// SetS3BuildInfo sets the S3BuildInfo metric once, when the S3 gateway
+// starts. Later calls have no effect.
+var SetS3BuildInfo = func() func(string, string) {
+	var once sync.Once
+	return func(version, commitHash string) {
+		once.Do(func() {
+			S3BuildInfo.WithLabelValues(version, runtime.Version(), commitHash).Set(1)
+		})
+	}
+}()
+
+// s3ZoneFromEnv returns S3_ZONE, falling back to S3_REGION and then to
+// "default".
+func s3ZoneFromEnv() string {
+	for _, name := range []string{"S3_ZONE", "S3_REGION"} {
+		if zone := strings.TrimSpace(os.Getenv(name)); zone != "" {
+			return zone
+		}
+	}
+	return "default"
+}
+
 // Readonly volume types
 const (
 	Namespace        = "SeaweedFS"
@@ -46,6 +68,13 @@ var bucketLastActiveLock sync.Mutex
 var (
 	Gather = prometheus.NewRegistry()
 
+	// S3Zone is the zone of the S3 gateway, from S3_ZONE or S3_REGION.
+	S3Zone = s3ZoneFromEnv()
+	// S3ZoneRegisterer registers the key S3 billing and traffic counters in
+	// Gather with a constant zone label, so that the series of several
+	// gateways scraped by one Prometheus can be told apart.
+	S3ZoneRegisterer = prometheus.WrapRegistererWith(prometheus.Labels{"zone": S3Zone}, Gather)
+
 	BuildInfo = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: Namespace,
@@ -352,7 +381,288 @@ var (
 			Subsystem: "s3",
 			Name:      "request_total",
 			Help:      "Counter of s3 requests.",
-		}, []string{"type", "code", "bucket"})
+		}, []string{"type", "code", "bucket", "accessKey"})
+
+	S3StatusClassCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "status_class_total",
+			Help:      "Counter of s3 requests by status code class, 2 for 2xx and so on.",
+		}, []string{"bucket", "class"})
+
+	S3ClientGroupRequestCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "client_group_requests_total",
+			Help:      "Counter of s3 requests by the S3_INTERNAL_CIDRS_GROUPED group of the client, - for none.",
+		}, []string{"bucket", "group"})
+
+	S3RedirectCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "redirects_total",
+			Help:      "Counter of s3 requests answered with a 3xx redirect, by status code.",
+		}, []string{"bucket", "status"})
+
+	S3BucketLastErrorTime = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "bucket_last_error_timestamp_seconds",
+			Help:      "Unix time of the last s3 request to a bucket answered with a 5xx status.",
+		}, []string{"bucket"})
+
+	S3AuthModeCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "auth_mode_total",
+			Help:      "Counter of s3 requests by how they were authenticated.",
+		}, []string{"bucket", "mode"})
+
+	S3OperationTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "operation_total",
+			Help:      "Counter of s3 operations, the denominator of S3OperationErrors.",
+		}, []string{"action", "bucket"})
+
+	S3OperationErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "operation_errors_total",
+			Help:      "Counter of s3 operations answered with a status of 400 or above.",
+		}, []string{"action", "bucket"})
+
+	S3ConditionalReadCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "conditional_reads_total",
+			Help:      "Counter of s3 GET and HEAD requests with a precondition header.",
+		}, []string{"bucket"})
+
+	S3NotModifiedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "not_modified_total",
+			Help:      "Counter of s3 GET and HEAD requests answered with 304 Not Modified.",
+		}, []string{"bucket"})
+
+	S3AddressingStyleCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "addressing_style_requests_total",
+			Help:      "Counter of s3 bucket requests by whether the bucket was addressed path style or virtual-hosted style.",
+		}, []string{"bucket", "style"})
+
+	S3ChunkedUploadCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "chunked_upload_requests_total",
+			Help:      "Counter of s3 requests with an aws-chunked streaming upload body.",
+		}, []string{"bucket"})
+
+	S3SigV2Counter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "sigv2_requests_total",
+			Help:      "Counter of s3 requests signed with the deprecated signature version 2.",
+		}, []string{"bucket"})
+
+	S3PresignedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "presigned_requests_total",
+			Help:      "Counter of s3 requests signed in the query string, as presigned URLs are.",
+		}, []string{"bucket", "method"})
+
+	S3TLSVersionCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "tls_version_total",
+			Help:      "Counter of s3 requests by negotiated TLS version, none for plaintext requests.",
+		}, []string{"bucket", "version"})
+
+	S3TLSCipherCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "tls_cipher_total",
+			Help:      "Counter of s3 requests over TLS by negotiated cipher suite.",
+		}, []string{"cipher"})
+
+	S3ProtocolCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "protocol_total",
+			Help:      "Counter of s3 requests by HTTP protocol version.",
+		}, []string{"bucket", "protocol"})
+
+	S3UnclassifiedActionCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "unclassified_action_total",
+			Help:      "Counter of s3 requests whose action has no billing class and was classified by HTTP method.",
+		}, []string{"action"})
+
+	S3SlowRequestCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "slow_requests_total",
+			Help:      "Counter of s3 requests slower than S3_SLOW_REQUEST_THRESHOLD.",
+		}, []string{"type", "bucket"})
+
+	S3BuildInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "build_info",
+			Help:      "A metric with a constant '1' value labeled by version, goversion and commit of the running S3 gateway.",
+		}, []string{"version", "goversion", "commit"})
+
+	S3QueueWaitHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "queue_wait_seconds",
+			Help:      "Bucketed histogram of the time s3 requests waited, e.g. for a concurrency slot, before their handler ran.",
+			Buckets:   s3RequestLatencyBuckets,
+		}, []string{"bucket"})
+
+	S3AuthFailureCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "auth_failures_total",
+			Help:      "Counter of s3 requests that failed authentication, by reason: no_credentials, bad_signature, expired or unknown_key.",
+		}, []string{"reason"})
+
+	S3ErrorCodeCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "error_code_total",
+			Help:      "Counter of s3 error responses by S3 error code.",
+		}, []string{"type", "bucket", "errorCode"})
+
+	S3ReadCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "read_requests_total",
+			Help:      "Counter of s3 requests billed as reads.",
+		}, []string{"bucket", "accessKey", "tier"})
+
+	S3WriteCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "write_requests_total",
+			Help:      "Counter of s3 requests billed as writes, by the x-amz-storage-class of the request.",
+		}, []string{"bucket", "accessKey", "tier", "storageClass"})
+
+	S3CacheHitBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "cache_hit_bytes_total",
+			Help:      "Bytes of s3 GET responses served without fetching from volume servers.",
+		}, []string{"bucket"})
+
+	S3CacheMissBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "cache_miss_bytes_total",
+			Help:      "Bytes of s3 GET responses fetched from volume servers.",
+		}, []string{"bucket"})
+
+	S3RangeRequestCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "range_requests_total",
+			Help:      "Counter of s3 object GETs with a Range header.",
+		}, []string{"bucket"})
+
+	S3ObjectReadCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "object_reads_total",
+			Help:      "Counter of successful s3 object GETs by whether the full object or a range was read.",
+		}, []string{"bucket", "read"})
+
+	S3ListCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "list_requests_total",
+			Help:      "Counter of s3 requests billed as listings.",
+		}, []string{"bucket"})
+
+	S3CustomClassCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "custom_class_requests_total",
+			Help:      "Counter of s3 requests billed in a request class registered by the operator.",
+		}, []string{"bucket", "class"})
+
+	S3HeadCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "head_requests_total",
+			Help:      "Counter of s3 HEAD requests billed as metadata reads.",
+		}, []string{"bucket"})
+
+	S3CorsPreflightCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "cors_preflight_requests_total",
+			Help:      "Counter of s3 CORS preflight OPTIONS requests.",
+		}, []string{"bucket"})
+
+	S3MetadataOpCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "metadata_requests_total",
+			Help:      "Counter of s3 requests reading or changing bucket configuration or ACLs, by HTTP method.",
+		}, []string{"bucket", "method"})
+
+	S3OtherCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "other_requests_total",
+			Help:      "Counter of s3 requests billed as neither reads nor writes.",
+		}, []string{"bucket"})
+
+	S3UpgradeRequestCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "upgrade_requests_total",
+			Help:      "Counter of s3 requests asking to upgrade the connection to another protocol, such as WebSocket.",
+		}, []string{"bucket"})
 
 	S3HandlerCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -362,12 +672,48 @@ var (
 			Help:      "Counter of s3 server handlers.",
 		}, []string{"type"})
 
+	S3BackendLatencyHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "backend_seconds",
+			Help:      "Bucketed histogram of the time s3 requests spent waiting on filer and volume servers.",
+			Buckets:   s3RequestLatencyBuckets,
+		}, []string{"operation"})
+
 	S3RequestHistogram = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: Namespace,
 			Subsystem: "s3",
 			Name:      "request_seconds",
 			Help:      "Bucketed histogram of s3 request processing time.",
+			Buckets:   s3RequestLatencyBuckets,
+		}, []string{"type", "bucket"})
+
+	S3RequestHistogramByOrigin = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "request_seconds_by_origin",
+			Help:      "Bucketed histogram of s3 request processing time by internal, semi-internal or external client origin.",
+			Buckets:   s3RequestLatencyBuckets,
+		}, []string{"type", "bucket", "origin"})
+
+	S3ProcessingTimeHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "processing_seconds",
+			Help:      "Bucketed histogram of s3 request time until the first response body byte, or the whole request without a body.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 24),
+		}, []string{"type", "bucket"})
+
+	S3TransferTimeHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "transfer_seconds",
+			Help:      "Bucketed histogram of s3 response time from the first to the last body byte written.",
 			Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 24),
 		}, []string{"type", "bucket"})
 
@@ -376,9 +722,78 @@ var (
 			Namespace: Namespace,
 			Subsystem: "s3",
 			Name:      "time_to_first_byte_millisecond",
-			Help:      "Bucketed histogram of s3 time to first byte request processing time.",
-			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 27),
+			Help:      "Bucketed histogram of s3 time to first byte request processing time, in milliseconds.",
+			Buckets:   s3TimeToFirstByteBuckets,
 		}, []string{"type", "bucket"})
+	S3TTFBMissingStartCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "time_to_first_byte_missing_start_total",
+			Help:      "Counter of s3 time to first byte observations skipped because no start time was captured.",
+		}, []string{"type"})
+	S3UploadCompletionHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "upload_completion_seconds",
+			Help:      "Bucketed histogram of s3 upload time until the uploaded data is stored.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 20),
+		}, []string{"type", "bucket"})
+	S3UploadThroughputHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "upload_throughput_bytes_per_second",
+			Help:      "Bucketed histogram of s3 upload throughput, not observed for empty uploads.",
+			Buckets:   prometheus.ExponentialBuckets(64*1024, 2, 16),
+		}, []string{"type", "bucket"})
+	S3RequestBytesHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "request_bytes",
+			Help:      "Bucketed histogram of s3 request body sizes, not observed for requests without a body.",
+			Buckets:   prometheus.ExponentialBuckets(64, 4, 14),
+		}, []string{"bucket"})
+	S3ResponseBytesHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "response_bytes",
+			Help:      "Bucketed histogram of s3 response body sizes, not observed for empty responses.",
+			Buckets:   prometheus.ExponentialBuckets(64, 4, 14),
+		}, []string{"bucket"})
+	S3ObjectSizeHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "object_size_bytes",
+			Help:      "Bucketed histogram of s3 object sizes read and written.",
+			Buckets:   prometheus.ExponentialBuckets(1024, 2, 21),
+		}, []string{"bucket", "operation"})
+	S3ActiveBucketsGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "active_buckets",
+			Help:      "Number of buckets with s3 requests within the active bucket window, 5 minutes by default.",
+		})
+	S3ActiveMultipartUploads = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "active_multipart_uploads",
+			Help:      "Current number of multipart uploads created but not yet completed or aborted.",
+		}, []string{"bucket"})
+	S3MultipartLifetimeHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "multipart_upload_lifetime_seconds",
+			Help:      "Bucketed histogram of the time from creating a multipart upload until it was completed or aborted.",
+			Buckets:   prometheus.ExponentialBuckets(1, 4, 12),
+		}, []string{"bucket", "outcome"})
 	S3InFlightRequestsGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: Namespace,
@@ -386,6 +801,20 @@ var (
 			Name:      "in_flight_requests",
 			Help:      "Current number of in-flight requests being handled by s3.",
 		}, []string{"type"})
+	S3SaturationGauge = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "saturation",
+			Help:      "In-flight s3 requests as a share of S3_MAX_CONCURRENT, NaN when it is not set.",
+		}, s3Saturation)
+	S3InFlightByClass = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "in_flight_requests_by_class",
+			Help:      "Current number of in-flight requests by billing class.",
+		}, []string{"class"})
 
 	S3InFlightUploadBytesGauge = prometheus.NewGauge(
 		prometheus.GaugeOpts{
@@ -408,17 +837,217 @@ var (
 			Namespace: Namespace,
 			Subsystem: "s3",
 			Name:      "bucket_traffic_received_bytes_total",
-			Help:      "Total number of bytes received by an S3 bucket from clients.",
-		}, []string{"bucket"})
+			Help:      "Total number of bytes received by an S3 bucket from clients, by the account owning the bucket.",
+		}, []string{"bucket", "account"})
 
 	S3BucketTrafficSentBytesCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: Namespace,
 			Subsystem: "s3",
 			Name:      "bucket_traffic_sent_bytes_total",
-			Help:      "Total number of bytes sent from an S3 bucket to clients.",
+			Help:      "Total number of bytes sent from an S3 bucket to clients, by the account owning the bucket.",
+		}, []string{"bucket", "account"})
+
+	S3BucketExternalReceivedBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "bucket_traffic_external_received_bytes_total",
+			Help:      "Total number of bytes received by an S3 bucket from clients outside the internal networks.",
+		}, []string{"bucket"})
+
+	S3ExternalRequestCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "bucket_external_requests_total",
+			Help:      "Counter of s3 requests to a bucket from clients outside the internal networks.",
+		}, []string{"bucket"})
+
+	S3InternalRequestCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "bucket_internal_requests_total",
+			Help:      "Counter of s3 requests to a bucket from clients in the internal networks.",
+		}, []string{"bucket"})
+
+	S3BucketInternalSentBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "bucket_traffic_internal_sent_bytes_total",
+			Help:      "Total number of bytes sent from an S3 bucket to clients in the internal networks.",
+		}, []string{"bucket"})
+
+	S3BucketSemiInternalSentBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "bucket_traffic_semi_internal_sent_bytes_total",
+			Help:      "Total number of bytes sent from an S3 bucket to clients in S3_SEMI_INTERNAL_CIDRS.",
+		}, []string{"bucket"})
+
+	S3BucketExternalSentBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "bucket_traffic_external_sent_bytes_total",
+			Help:      "Total number of bytes sent from an S3 bucket to clients outside the internal and semi-internal networks.",
+		}, []string{"bucket"})
+
+	S3BucketEgressRateGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "bucket_egress_bytes_per_second",
+			Help:      "Bytes per second sent from an S3 bucket to clients, averaged over the last 10 seconds.",
+		}, []string{"bucket"})
+
+	S3AbortedTransferBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "aborted_transfer_bytes_total",
+			Help:      "Total number of bytes fetched from the volume servers for s3 responses that never reached the client because it went away.",
+		}, []string{"bucket"})
+
+	S3ExternalEgressByCountry = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "external_egress_bytes_by_country_total",
+			Help:      "Total number of bytes sent to external clients by client country, with S3_GEOIP_DB configured.",
+		}, []string{"country"})
+
+	S3ClientEgressBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "client_egress_bytes_total",
+			Help:      "Total number of bytes sent to clients, aggregated by client network prefix.",
+		}, []string{"prefix"})
+
+	S3RateLimitedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "rate_limited_requests_total",
+			Help:      "Counter of s3 requests rejected by the per-bucket rate limit.",
+		}, []string{"bucket"})
+
+	S3ClientRateLimitedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "client_rate_limited_requests_total",
+			Help:      "Counter of s3 requests rejected by the per-client rate limit, aggregated by client network prefix.",
+		}, []string{"prefix"})
+
+	S3DisallowedMethodCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "disallowed_method_requests_total",
+			Help:      "Counter of s3 requests rejected because their HTTP method, such as TRACE or CONNECT, is never served.",
+		}, []string{"method"})
+
+	S3BlockedRequestCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "blocked_requests_total",
+			Help:      "Counter of s3 requests rejected because the client is in S3_BLOCKED_CIDRS, by blocked prefix.",
+		}, []string{"prefix"})
+
+	S3BucketIPDeniedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "bucket_ip_denied_requests_total",
+			Help:      "Counter of s3 requests rejected because the client is not in the allow-list of the bucket.",
+		}, []string{"bucket"})
+
+	S3QuotaExceededCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "quota_exceeded_requests_total",
+			Help:      "Counter of s3 requests rejected because the bucket used up its egress or ingress quota for the period.",
+		}, []string{"bucket", "direction"})
+
+	S3OversizedRequestCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "oversized_requests_total",
+			Help:      "Counter of s3 requests rejected because their Content-Length exceeds S3_MAX_OBJECT_SIZE.",
+		}, []string{"bucket"})
+
+	S3RetryAttemptCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "request_attempts_total",
+			Help:      "Counter of s3 requests from AWS SDKs by attempt number: 1, 2 or 3+.",
+		}, []string{"bucket", "attempt"})
+
+	S3CircuitBreakerState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "circuit_breaker_state",
+			Help:      "State of the per-bucket 5xx circuit breaker: 0 closed, 1 open, 2 half-open.",
+		}, []string{"bucket"})
+
+	S3ConcurrencyRejectedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "concurrency_rejected_requests_total",
+			Help:      "Counter of s3 requests rejected after waiting for a slot of the per-bucket concurrency limit.",
 		}, []string{"bucket"})
 
+	S3OversizedForwardedHeaderCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "oversized_forwarded_header_total",
+			Help:      "Counter of s3 requests whose X-Forwarded-For header was truncated to S3_XFF_MAX_LEN entries.",
+		})
+
+	S3UntrustedForwardedHeaderCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "untrusted_forwarded_header_total",
+			Help:      "Counter of s3 requests carrying client IP forwarding headers from a peer that is not a trusted proxy.",
+		}, []string{"bucket"})
+
+	S3RequestWeightParseErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "request_weight_parse_errors_total",
+			Help:      "Number of s3 request bodies that could not be parsed to weigh the request for billing.",
+		}, []string{"type", "reason"})
+
+	S3CIDRParseErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "cidr_parse_errors_total",
+			Help:      "Number of CIDR entries rejected as invalid while loading s3 network sets.",
+		}, []string{"source"})
+
+	S3InternalCIDRCount = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: "s3",
+			Name:      "internal_cidr_count",
+			Help:      "Number of prefixes in the currently loaded s3 internal network set, after exclusions.",
+		})
+
 	S3DeletedObjectsCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: Namespace,
@@ -505,14 +1134,89 @@ func init() {
 	Gather.MustRegister(VolumeServerInFlightUploadSize)
 
 	Gather.MustRegister(S3RequestCounter)
+	Gather.MustRegister(S3StatusClassCounter)
+	Gather.MustRegister(S3ClientGroupRequestCounter)
+	Gather.MustRegister(S3RedirectCounter)
+	Gather.MustRegister(S3BucketLastErrorTime)
+	Gather.MustRegister(S3AuthModeCounter)
+	Gather.MustRegister(S3OperationTotal)
+	Gather.MustRegister(S3OperationErrors)
+	Gather.MustRegister(S3PresignedCounter)
+	Gather.MustRegister(S3SigV2Counter)
+	Gather.MustRegister(S3ChunkedUploadCounter)
+	Gather.MustRegister(S3AddressingStyleCounter)
+	Gather.MustRegister(S3ConditionalReadCounter)
+	Gather.MustRegister(S3NotModifiedCounter)
+	Gather.MustRegister(S3TLSVersionCounter)
+	Gather.MustRegister(S3TLSCipherCounter)
+	Gather.MustRegister(S3ProtocolCounter)
+	Gather.MustRegister(S3ErrorCodeCounter)
+	Gather.MustRegister(S3AuthFailureCounter)
+	Gather.MustRegister(S3QueueWaitHistogram)
+	Gather.MustRegister(S3BuildInfo)
+	Gather.MustRegister(S3SlowRequestCounter)
+	Gather.MustRegister(S3UnclassifiedActionCounter)
+	S3ZoneRegisterer.MustRegister(S3ReadCounter)
+	S3ZoneRegisterer.MustRegister(S3WriteCounter)
+	Gather.MustRegister(S3CacheHitBytesCounter)
+	Gather.MustRegister(S3CacheMissBytesCounter)
+	Gather.MustRegister(S3RangeRequestCounter)
+	Gather.MustRegister(S3ObjectReadCounter)
+	S3ZoneRegisterer.MustRegister(S3ListCounter)
+	S3ZoneRegisterer.MustRegister(S3HeadCounter)
+	S3ZoneRegisterer.MustRegister(S3CorsPreflightCounter)
+	S3ZoneRegisterer.MustRegister(S3MetadataOpCounter)
+	Gather.MustRegister(S3CustomClassCounter)
+	S3ZoneRegisterer.MustRegister(S3OtherCounter)
+	S3ZoneRegisterer.MustRegister(S3UpgradeRequestCounter)
 	Gather.MustRegister(S3HandlerCounter)
 	Gather.MustRegister(S3RequestHistogram)
+	Gather.MustRegister(S3BackendLatencyHistogram)
+	Gather.MustRegister(S3RequestHistogramByOrigin)
+	Gather.MustRegister(S3ProcessingTimeHistogram)
+	Gather.MustRegister(S3TransferTimeHistogram)
+	Gather.MustRegister(S3ActiveMultipartUploads)
+	Gather.MustRegister(S3MultipartLifetimeHistogram)
+	Gather.MustRegister(S3ActiveBucketsGauge)
 	Gather.MustRegister(S3InFlightRequestsGauge)
+	Gather.MustRegister(S3SaturationGauge)
+	Gather.MustRegister(S3InFlightByClass)
 	Gather.MustRegister(S3InFlightUploadBytesGauge)
 	Gather.MustRegister(S3InFlightUploadCountGauge)
 	Gather.MustRegister(S3TimeToFirstByteHistogram)
-	Gather.MustRegister(S3BucketTrafficReceivedBytesCounter)
-	Gather.MustRegister(S3BucketTrafficSentBytesCounter)
+	Gather.MustRegister(S3TTFBMissingStartCounter)
+	Gather.MustRegister(S3RequestBytesHistogram)
+	Gather.MustRegister(S3ResponseBytesHistogram)
+	Gather.MustRegister(S3ObjectSizeHistogram)
+	Gather.MustRegister(S3UploadCompletionHistogram)
+	Gather.MustRegister(S3UploadThroughputHistogram)
+	S3ZoneRegisterer.MustRegister(S3BucketTrafficReceivedBytesCounter)
+	S3ZoneRegisterer.MustRegister(S3BucketTrafficSentBytesCounter)
+	S3ZoneRegisterer.MustRegister(S3BucketExternalReceivedBytesCounter)
+	S3ZoneRegisterer.MustRegister(S3ExternalRequestCounter)
+	S3ZoneRegisterer.MustRegister(S3InternalRequestCounter)
+	S3ZoneRegisterer.MustRegister(S3BucketInternalSentBytesCounter)
+	S3ZoneRegisterer.MustRegister(S3BucketSemiInternalSentBytesCounter)
+	S3ZoneRegisterer.MustRegister(S3BucketExternalSentBytesCounter)
+	Gather.MustRegister(S3BucketEgressRateGauge)
+	Gather.MustRegister(S3AbortedTransferBytes)
+	Gather.MustRegister(S3ExternalEgressByCountry)
+	Gather.MustRegister(S3ClientEgressBytes)
+	Gather.MustRegister(S3RateLimitedCounter)
+	Gather.MustRegister(S3ClientRateLimitedCounter)
+	Gather.MustRegister(S3BlockedRequestCounter)
+	Gather.MustRegister(S3BucketIPDeniedCounter)
+	Gather.MustRegister(S3DisallowedMethodCounter)
+	Gather.MustRegister(S3OversizedRequestCounter)
+	Gather.MustRegister(S3QuotaExceededCounter)
+	Gather.MustRegister(S3ConcurrencyRejectedCounter)
+	Gather.MustRegister(S3CircuitBreakerState)
+	Gather.MustRegister(S3RetryAttemptCounter)
+	Gather.MustRegister(S3UntrustedForwardedHeaderCounter)
+	Gather.MustRegister(S3OversizedForwardedHeaderCounter)
+	Gather.MustRegister(S3CIDRParseErrors)
+	Gather.MustRegister(S3RequestWeightParseErrors)
+	Gather.MustRegister(S3InternalCIDRCount)
 	Gather.MustRegister(S3DeletedObjectsCounter)
 	Gather.MustRegister(S3UploadedObjectsCounter)
 	Gather.MustRegister(S3BucketSizeBytesGauge)
@@ -520,6 +1224,7 @@ func init() {
 	Gather.MustRegister(S3BucketObjectCountGauge)
 
 	go bucketMetricTTLControl()
+	go activeS3Buckets.pruneEvery()
 }
 
 func LoopPushingMetric(name, instance, addr string, intervalSeconds int) {
@@ -571,6 +1276,18 @@ func RecordBucketActiveTime(bucket string) {
 	bucketLastActiveLock.Lock()
 	bucketLastActiveTsNs[bucket] = time.Now().UnixNano()
 	bucketLastActiveLock.Unlock()
+	activeS3Buckets.record(bucket)
+}
+
+// RecordS3Operation counts an s3 operation in S3OperationTotal and, when its
+// status is 400 or above, in S3OperationErrors. Both counters always exist
+// for an action and bucket, so their ratio is defined from the first request.
+func RecordS3Operation(action, bucket string, status int) {
+	S3OperationTotal.WithLabelValues(action, bucket).Inc()
+	errors := S3OperationErrors.WithLabelValues(action, bucket)
+	if status >= http.StatusBadRequest {
+		errors.Inc()
+	}
 }
 
 func DeleteCollectionMetrics(collection string) {
@@ -597,10 +1314,66 @@ func bucketMetricTTLControl() {
 
 				labels := prometheus.Labels{"bucket": bucket}
 				c := S3RequestCounter.DeletePartialMatch(labels)
+				c += S3StatusClassCounter.DeletePartialMatch(labels)
+				c += S3ClientGroupRequestCounter.DeletePartialMatch(labels)
+				c += S3RedirectCounter.DeletePartialMatch(labels)
+				c += S3BucketLastErrorTime.DeletePartialMatch(labels)
+				c += S3AuthModeCounter.DeletePartialMatch(labels)
+				c += S3OperationTotal.DeletePartialMatch(labels)
+				c += S3OperationErrors.DeletePartialMatch(labels)
+				c += S3PresignedCounter.DeletePartialMatch(labels)
+				c += S3SigV2Counter.DeletePartialMatch(labels)
+				c += S3ChunkedUploadCounter.DeletePartialMatch(labels)
+				c += S3AddressingStyleCounter.DeletePartialMatch(labels)
+				c += S3MultipartLifetimeHistogram.DeletePartialMatch(labels)
+				c += S3ConditionalReadCounter.DeletePartialMatch(labels)
+				c += S3NotModifiedCounter.DeletePartialMatch(labels)
+				c += S3TLSVersionCounter.DeletePartialMatch(labels)
+				c += S3ProtocolCounter.DeletePartialMatch(labels)
+				c += S3ErrorCodeCounter.DeletePartialMatch(labels)
+				c += S3ReadCounter.DeletePartialMatch(labels)
+				c += S3WriteCounter.DeletePartialMatch(labels)
+				c += S3CacheHitBytesCounter.DeletePartialMatch(labels)
+				c += S3CacheMissBytesCounter.DeletePartialMatch(labels)
+				c += S3RangeRequestCounter.DeletePartialMatch(labels)
+				c += S3ObjectReadCounter.DeletePartialMatch(labels)
+				c += S3ListCounter.DeletePartialMatch(labels)
+				c += S3HeadCounter.DeletePartialMatch(labels)
+				c += S3CustomClassCounter.DeletePartialMatch(labels)
+				c += S3CorsPreflightCounter.DeletePartialMatch(labels)
+				c += S3MetadataOpCounter.DeletePartialMatch(labels)
+				c += S3OtherCounter.DeletePartialMatch(labels)
+				c += S3UpgradeRequestCounter.DeletePartialMatch(labels)
 				c += S3RequestHistogram.DeletePartialMatch(labels)
+				c += S3RequestHistogramByOrigin.DeletePartialMatch(labels)
+				c += S3ProcessingTimeHistogram.DeletePartialMatch(labels)
+				c += S3TransferTimeHistogram.DeletePartialMatch(labels)
 				c += S3TimeToFirstByteHistogram.DeletePartialMatch(labels)
+				c += S3RequestBytesHistogram.DeletePartialMatch(labels)
+				c += S3ResponseBytesHistogram.DeletePartialMatch(labels)
+				c += S3ObjectSizeHistogram.DeletePartialMatch(labels)
+				c += S3UploadCompletionHistogram.DeletePartialMatch(labels)
+				c += S3UploadThroughputHistogram.DeletePartialMatch(labels)
 				c += S3BucketTrafficReceivedBytesCounter.DeletePartialMatch(labels)
 				c += S3BucketTrafficSentBytesCounter.DeletePartialMatch(labels)
+				c += S3BucketExternalReceivedBytesCounter.DeletePartialMatch(labels)
+				c += S3ExternalRequestCounter.DeletePartialMatch(labels)
+				c += S3InternalRequestCounter.DeletePartialMatch(labels)
+				c += S3BucketInternalSentBytesCounter.DeletePartialMatch(labels)
+				c += S3BucketSemiInternalSentBytesCounter.DeletePartialMatch(labels)
+				c += S3BucketExternalSentBytesCounter.DeletePartialMatch(labels)
+				c += S3BucketEgressRateGauge.DeletePartialMatch(labels)
+				c += S3AbortedTransferBytes.DeletePartialMatch(labels)
+				c += S3QueueWaitHistogram.DeletePartialMatch(labels)
+				c += S3SlowRequestCounter.DeletePartialMatch(labels)
+				c += S3BucketIPDeniedCounter.DeletePartialMatch(labels)
+				c += S3OversizedRequestCounter.DeletePartialMatch(labels)
+				c += S3QuotaExceededCounter.DeletePartialMatch(labels)
+				c += S3ConcurrencyRejectedCounter.DeletePartialMatch(labels)
+				c += S3CircuitBreakerState.DeletePartialMatch(labels)
+				c += S3RetryAttemptCounter.DeletePartialMatch(labels)
+				c += S3RateLimitedCounter.DeletePartialMatch(labels)
+				c += S3UntrustedForwardedHeaderCounter.DeletePartialMatch(labels)
 				c += S3DeletedObjectsCounter.DeletePartialMatch(labels)
 				c += S3UploadedObjectsCounter.DeletePartialMatch(labels)
 				c += S3BucketSizeBytesGauge.DeletePartialMatch(labels)
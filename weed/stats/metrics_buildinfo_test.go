@@ -79,3 +79,27 @@ func TestBuildInfo(t *testing.T) {
 		t.Error("BuildInfo metric not found in gathered metrics")
 	}
 }
+
+func TestS3BuildInfo(t *testing.T) {
+	stats.SetS3BuildInfo("30GB 4.11", "abc1234")
+	// Only the first call counts.
+	stats.SetS3BuildInfo("other", "other")
+
+	if count := testutil.CollectAndCount(stats.S3BuildInfo); count != 1 {
+		t.Fatalf("Expected 1 S3BuildInfo metric, got %d", count)
+	}
+	if got := testutil.ToFloat64(stats.S3BuildInfo.WithLabelValues("30GB 4.11", runtime.Version(), "abc1234")); got != 1 {
+		t.Errorf("Expected S3BuildInfo value to be 1, got %f", got)
+	}
+
+	metrics, err := stats.Gather.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	for _, mf := range metrics {
+		if mf.GetName() == "SeaweedFS_s3_build_info" {
+			return
+		}
+	}
+	t.Error("S3BuildInfo metric not found in gathered metrics")
+}
@@ -0,0 +1,83 @@
+package stats_test
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/seaweedfs/seaweedfs/weed/stats"
+)
+
+func TestTimeToFirstByteBuckets(t *testing.T) {
+	// Observations are in milliseconds; the buckets must bracket realistic
+	// time to first byte values from a millisecond up to ten seconds.
+	want := []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+	var m dto.Metric
+	observer := stats.S3TimeToFirstByteHistogram.WithLabelValues("GET", "ttfb-buckets")
+	if err := observer.(prometheus.Metric).Write(&m); err != nil {
+		t.Fatalf("read histogram: %v", err)
+	}
+	var got []float64
+	for _, bucket := range m.GetHistogram().GetBucket() {
+		got = append(got, bucket.GetUpperBound())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("time to first byte buckets = %v, want %v", got, want)
+	}
+}
+
+func TestRecordS3OperationErrorBoundary(t *testing.T) {
+	const bucket = "operation-errors"
+	tests := []struct {
+		status int
+		errors float64
+	}{
+		{200, 0},
+		{304, 0},
+		{399, 0},
+		{400, 1},
+		{404, 1},
+		{500, 1},
+	}
+	for _, tt := range tests {
+		action := "op-" + strconv.Itoa(tt.status)
+		stats.RecordS3Operation(action, bucket, tt.status)
+		if got := testutil.ToFloat64(stats.S3OperationTotal.WithLabelValues(action, bucket)); got != 1 {
+			t.Errorf("status %d: total = %v, want 1", tt.status, got)
+		}
+		if got := testutil.ToFloat64(stats.S3OperationErrors.WithLabelValues(action, bucket)); got != tt.errors {
+			t.Errorf("status %d: errors = %v, want %v", tt.status, got, tt.errors)
+		}
+	}
+}
+
+func TestS3ZoneLabel(t *testing.T) {
+	stats.S3ReadCounter.WithLabelValues("zone-label-bucket", "", "standard").Inc()
+
+	metrics, err := stats.Gather.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, mf := range metrics {
+		if mf.GetName() != "SeaweedFS_s3_read_requests_total" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "zone" {
+					if label.GetValue() != stats.S3Zone {
+						t.Errorf("zone = %q, want %q", label.GetValue(), stats.S3Zone)
+					}
+					return
+				}
+			}
+		}
+		t.Fatal("read_requests_total has no zone label")
+	}
+	t.Fatal("read_requests_total not gathered")
+}
@@ -0,0 +1,24 @@
+package stats
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// s3SaturationFunc computes S3SaturationGauge. It is read at scrape time, so
+// the gauge always agrees with the in-flight count it is derived from.
+var s3SaturationFunc atomic.Pointer[func() float64]
+
+// SetS3SaturationFunc sets the function S3SaturationGauge reports.
+func SetS3SaturationFunc(f func() float64) {
+	s3SaturationFunc.Store(&f)
+}
+
+// s3Saturation is the value of S3SaturationGauge, NaN until the s3 gateway
+// sets its function.
+func s3Saturation() float64 {
+	if f := s3SaturationFunc.Load(); f != nil {
+		return (*f)()
+	}
+	return math.NaN()
+}